@@ -21,18 +21,34 @@ import (
 	"github.com/spf13/viper"
 )
 
+// pageSize is the number of items per page of the lists the client gets.
+const pageSize = 100
+
+// ErrRepositoryNotFound is returned by GetRepository for repositories the
+// register doesn't have, and by PatchRepository and PatchRepositories for
+// entries that are gone.
+var ErrRepositoryNotFound = errors.New("repository not in the register")
+
 type APIClient struct {
 	baseURL         string
 	retryableClient *http.Client
-	token           string
 	xAPIKey         string
-	tokenFetcher    *KeycloakTokenFetcher
+	// tokenFetcher caches the bearer token; it's shared by the copies of an
+	// APIClient, so a refreshed token is seen by all of them.
+	tokenFetcher *KeycloakTokenFetcher
+	limiter      *rateLimiter
+	// batchSize is the number of repositories per bulk upsert, see
+	// PostRepositories.
+	batchSize int
+	bulk      *bulkSupport
 }
 
 type GitOrganisation struct {
 	ID           string               `json:"id"`
 	Organisation *OrganisationSummary `json:"organisation"`
 	URL          string               `json:"url"`
+	// PubliccodeRef is passed on as common.Publisher.PubliccodeRef.
+	PubliccodeRef string `json:"publiccodeRef,omitempty"`
 }
 
 type OrganisationSummary struct {
@@ -44,131 +60,201 @@ type Repository struct {
 	ID            string    `json:"id"`
 	RepositoryURL string    `json:"repositoryUrl"`
 	IsFork        bool      `json:"isFork"`
+	UpstreamURL   *string   `json:"upstreamUrl"`
 	Name          *string   `json:"name"`
 	Description   *string   `json:"description"`
 	PublicCodeURL *string   `json:"publicCodeUrl"`
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
 	LastActivity  time.Time `json:"lastActivity"`
+	// The fields below mirror RepositoryRequest.
+	PublicCodeRef        *string   `json:"publicCodeRef"`
+	Version              *string   `json:"version"`
+	DivergedFromUpstream *bool     `json:"divergedFromUpstream"`
+	Languages            []string  `json:"languages"`
+	License              *string   `json:"license"`
+	Topics               []string  `json:"topics"`
+	OrganisationURI      string    `json:"organisationUri"`
+	LastCrawledAt        time.Time `json:"lastCrawledAt"`
+}
+
+// RepositoryRequest is the payload sent to POST /repositories.
+type RepositoryRequest struct {
+	URL string `json:"url"`
+	// PreviousURL is the URL the register knows the repository by, set when
+	// the repository was renamed or transferred since the last crawl.
+	PreviousURL      *string `json:"previousUrl,omitempty"`
+	Name             *string `json:"name,omitempty"`
+	ShortDescription *string `json:"shortDescription,omitempty"`
+	PublicCodeURL    *string `json:"publicCodeUrl,omitempty"`
+	// PublicCodeRef is the branch or tag PublicCodeURL was read from and
+	// Version the release tag, if publiccode.yml came from a release.
+	PublicCodeRef *string `json:"publicCodeRef,omitempty"`
+	Version       *string `json:"version,omitempty"`
+	IsFork        *bool   `json:"isFork,omitempty"`
+	// UpstreamURL is the URL of the repository a fork was created from.
+	UpstreamURL          *string  `json:"upstreamUrl,omitempty"`
+	DivergedFromUpstream *bool    `json:"divergedFromUpstream,omitempty"`
+	Languages            []string `json:"languages,omitempty"`
+	// License is a SPDX identifier.
+	License         *string   `json:"license,omitempty"`
+	Topics          []string  `json:"topics,omitempty"`
+	OrganisationURI string    `json:"organisationUri"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastCrawledAt   time.Time `json:"lastCrawledAt"`
+	LastActivityAt  time.Time `json:"lastActivityAt,omitempty"`
 }
 
-type repositoryRequest struct {
-	URL              string    `json:"url"`
-	Name             *string   `json:"name,omitempty"`
-	ShortDescription *string   `json:"shortDescription,omitempty"`
-	PublicCodeURL    *string   `json:"publicCodeUrl,omitempty"`
-	IsFork           *bool     `json:"isFork,omitempty"`
-	OrganisationURI  string    `json:"organisationUri"`
-	CreatedAt        time.Time `json:"createdAt"`
-	LastCrawledAt    time.Time `json:"lastCrawledAt"`
-	LastActivityAt   time.Time `json:"lastActivityAt,omitempty"`
+// APIRequest registers an API specification found in a repository with the API
+// register, linking the API to the repository it's implemented in.
+type APIRequest struct {
+	// OasURL is the URL of the raw specification file.
+	OasURL string `json:"oasUrl"`
+	// SpecificationType is "openapi" or "asyncapi".
+	SpecificationType    string  `json:"specificationType"`
+	SpecificationVersion string  `json:"specificationVersion,omitempty"`
+	Title                *string `json:"title,omitempty"`
+	Version              *string `json:"version,omitempty"`
+	RepositoryURL        string  `json:"repositoryUrl"`
+	OrganisationURI      string  `json:"organisationUri"`
 }
 
-func NewClient() APIClient {
+// SBOMRequest submits the software bill of materials of a repository.
+type SBOMRequest struct {
+	RepositoryURL string `json:"repositoryUrl"`
+	// Format is the SBOM standard, e.g. CycloneDX.
+	Format      string          `json:"format"`
+	SpecVersion string          `json:"specVersion"`
+	SBOM        json.RawMessage `json:"sbom"`
+}
+
+// VulnerabilitiesRequest submits the known vulnerabilities in the dependencies
+// of a repository. It replaces the previous findings, so an empty list clears them.
+type VulnerabilitiesRequest struct {
+	RepositoryURL   string          `json:"repositoryUrl"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Vulnerability is an OSV entry affecting a dependency of a repository.
+type Vulnerability struct {
+	ID            string   `json:"id"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Ecosystem     string   `json:"ecosystem"`
+	Package       string   `json:"package"`
+	Version       string   `json:"version"`
+	FixedVersions []string `json:"fixedVersions,omitempty"`
+}
+
+type API struct {
+	ID      string `json:"id"`
+	OasURL  string `json:"oasUrl"`
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// NewClient creates a client for the API configured in the environment. It
+// fails if the Keycloak client credentials are set but invalid.
+func NewClient() (APIClient, error) {
 	rc := retryablehttp.NewClient()
 	rc.RetryMax = 3
 	rc.HTTPClient.Timeout = 60 * time.Second
 	retryableClient := rc.StandardClient()
-	token := ""
-	tokenFetcher := NewKeycloakTokenFetcherFromEnv()
 
-	if tokenFetcher != nil {
-		if fetched, err := tokenFetcher.Fetch(context.Background()); err == nil && fetched != "" {
-			token = "Bearer " + fetched
+	tokenFetcher, err := NewKeycloakTokenFetcherFromEnv()
+	if err != nil {
+		return APIClient{}, err
+	}
 
-			log.Infof("Fetched bearer token via KeycloakTokenFetcher")
-		} else if err != nil {
-			log.Warnf("API_BEARER_TOKEN not set and Keycloak fetch failed: %v", err)
-		}
-	} else {
-		log.Warn("API_BEARER_TOKEN not set; authenticated calls will fail")
+	if tokenFetcher == nil {
+		log.Warn("Keycloak client not configured; authenticated calls will fail")
+	}
+
+	batchSize := viper.GetInt("API_BATCH_SIZE")
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
 	}
 
 	return APIClient{
 		baseURL:         viper.GetString("API_BASEURL"),
 		retryableClient: retryableClient,
-		token:           token,
 		xAPIKey:         viper.GetString("API_X_API_KEY"),
 		tokenFetcher:    tokenFetcher,
-	}
+		limiter:         newRateLimiter(),
+		batchSize:       batchSize,
+		bulk:            &bulkSupport{},
+	}, nil
+}
+
+func (clt APIClient) Get(url string) (*http.Response, error) {
+	return clt.send(http.MethodGet, url, "", nil)
+}
+
+func (clt APIClient) Post(url string, body []byte) (*http.Response, error) {
+	return clt.send(http.MethodPost, url, "application/json", body)
+}
+
+// Patch sends body as a JSON merge patch (RFC 7396) to url.
+func (clt APIClient) Patch(url string, body []byte) (*http.Response, error) {
+	return clt.send(http.MethodPatch, url, "application/merge-patch+json", body)
 }
 
-func (clt *APIClient) Get(url string) (*http.Response, error) {
-	doRequest := func(authToken string) (*http.Response, error) {
-		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+// send makes the request with the current bearer token. If the API rejects the
+// token, it's replaced and the request made once more.
+func (clt APIClient) send(method, url, contentType string, body []byte) (*http.Response, error) {
+	doRequest := func(token string) (*http.Response, error) {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), method, url, reqBody)
 		if err != nil {
 			return nil, err
 		}
 
-		if authToken != "" {
-			req.Header.Add("Authorization", authToken)
+		if token != "" {
+			req.Header.Add("Authorization", "Bearer "+token)
 		}
 
 		if clt.xAPIKey != "" {
 			req.Header.Add("x-api-key", clt.xAPIKey)
 		}
 
-		return clt.retryableClient.Do(req)
-	}
-
-	res, err := doRequest(clt.token)
-	if err != nil {
-		return nil, err
-	}
+		if contentType != "" {
+			req.Header.Add("Content-Type", contentType)
+		}
 
-	if res.StatusCode != http.StatusUnauthorized {
-		return res, nil
+		return clt.do(req)
 	}
 
-	res.Body.Close()
+	token := ""
 
-	token, refreshErr := clt.refreshToken(context.Background())
-	if refreshErr != nil {
-		return nil, fmt.Errorf("GET %s unauthorized and token refresh failed: %w", url, refreshErr)
-	}
+	if clt.tokenFetcher != nil {
+		var err error
 
-	return doRequest(token)
-}
-
-func (clt *APIClient) Post(url string, body []byte) (*http.Response, error) {
-	doRequest := func(authToken string) (*http.Response, error) {
-		req, err := http.NewRequestWithContext(
-			context.Background(),
-			http.MethodPost,
-			url,
-			bytes.NewBuffer(body),
-		)
+		token, err = clt.tokenFetcher.Token(context.Background())
 		if err != nil {
-			return nil, err
-		}
-
-		if authToken != "" {
-			req.Header.Add("Authorization", authToken)
+			log.Warnf("can't fetch bearer token, sending %s %s without: %v", method, url, err)
 		}
-
-		if clt.xAPIKey != "" {
-			req.Header.Add("x-api-key", clt.xAPIKey)
-		}
-
-		req.Header.Add("Content-Type", "application/json")
-
-		return clt.retryableClient.Do(req)
 	}
 
-	res, err := doRequest(clt.token)
+	res, err := doRequest(token)
 	if err != nil {
 		return nil, err
 	}
 
-	if res.StatusCode != http.StatusUnauthorized {
+	if res.StatusCode != http.StatusUnauthorized || clt.tokenFetcher == nil {
 		return res, nil
 	}
 
 	res.Body.Close()
 
-	token, refreshErr := clt.refreshToken(context.Background())
-	if refreshErr != nil {
-		return nil, fmt.Errorf("POST %s unauthorized and token refresh failed: %w", url, refreshErr)
+	clt.tokenFetcher.invalidate(token)
+
+	token, err = clt.tokenFetcher.Token(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%s %s unauthorized and token refresh failed: %w", method, url, err)
 	}
 
 	return doRequest(token)
@@ -176,35 +262,14 @@ func (clt *APIClient) Post(url string, body []byte) (*http.Response, error) {
 
 // GetGitOrganisations returns git organisations and their code hosting URLs.
 func (clt APIClient) GetGitOrganisations() ([]common.Publisher, error) {
-	page := 1
-	perPage := 100
 	publishers := make([]common.Publisher, 0, 25)
 
-	for {
-		reqURL := fmt.Sprintf("%s?page=%d&perPage=%d", joinPath(clt.baseURL, "/git-organisations"), page, perPage)
-
-		res, err := clt.Get(reqURL)
-		if err != nil {
-			return nil, fmt.Errorf("can't get gitOrganisations %s: %w", reqURL, err)
-		}
-
-		log.Debugf("GET %s -> %s (rl-rem=%s)", reqURL, res.Status, res.Header.Get("RateLimit-Remaining"))
-
-		if res.StatusCode < 200 || res.StatusCode > 299 {
-			res.Body.Close()
-
-			return nil, fmt.Errorf("can't get gitOrganisations %s: HTTP status %s", reqURL, res.Status)
-		}
-
+	err := clt.getPages("/git-organisations", func(reqURL string, body io.Reader) error {
 		var gitOrgs []GitOrganisation
-		if err := json.NewDecoder(res.Body).Decode(&gitOrgs); err != nil {
-			res.Body.Close()
-
-			return nil, fmt.Errorf("can't parse GET %s response: %w", reqURL, err)
+		if err := json.NewDecoder(body).Decode(&gitOrgs); err != nil {
+			return fmt.Errorf("can't parse GET %s response: %w", reqURL, err)
 		}
 
-		res.Body.Close()
-
 		for _, org := range gitOrgs {
 			gitURL := org.URL
 
@@ -219,7 +284,7 @@ func (clt APIClient) GetGitOrganisations() ([]common.Publisher, error) {
 			if gitURL != "" {
 				u, err := url.Parse(gitURL)
 				if err != nil {
-					return nil, fmt.Errorf("can't parse organisation url %s: %w", gitURL, err)
+					return fmt.Errorf("can't parse organisation url %s: %w", gitURL, err)
 				}
 
 				orgURL = *u
@@ -241,64 +306,101 @@ func (clt APIClient) GetGitOrganisations() ([]common.Publisher, error) {
 				Organization:    (internalUrl.URL)(orgURL),
 				Repositories:    nil,
 				OrganisationURL: orgForPost,
+				PubliccodeRef:   org.PubliccodeRef,
 			})
 		}
 
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return publishers, nil
+}
+
+// ListRepositories returns every repository in the register.
+func (clt APIClient) ListRepositories() ([]Repository, error) {
+	var repositories []Repository
+
+	err := clt.getPages("/repositories", func(reqURL string, body io.Reader) error {
+		var page []Repository
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return fmt.Errorf("can't parse GET %s response: %w", reqURL, err)
+		}
+
+		repositories = append(repositories, page...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repositories, nil
+}
+
+// getPages GETs the list at path page by page, following the Link and
+// Total-Pages headers, and calls decode with the body of every page.
+func (clt APIClient) getPages(path string, decode func(reqURL string, body io.Reader) error) error {
+	page := 1
+
+	for {
+		reqURL := fmt.Sprintf("%s?page=%d&perPage=%d", joinPath(clt.baseURL, path), page, pageSize)
+
+		res, err := clt.Get(reqURL)
+		if err != nil {
+			return fmt.Errorf("can't get %s: %w", reqURL, err)
+		}
+
+		log.Debugf("GET %s -> %s (rl-rem=%s)", reqURL, res.Status, res.Header.Get("RateLimit-Remaining"))
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			res.Body.Close()
+
+			return fmt.Errorf("can't get %s: HTTP status %s", reqURL, res.Status)
+		}
+
+		err = decode(reqURL, res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
 		nextPage := parseNextPage(res.Header.Get("Link"))
 		totalPages := headerInt(res.Header.Get("Total-Pages"))
 
 		switch {
 		case nextPage > page:
 			page = nextPage
-
-			continue
 		case totalPages > 0 && page < totalPages:
 			page++
-
-			continue
 		default:
-			return publishers, nil
+			return nil
 		}
 	}
 }
 
-// PostRepository creates a new repository entry.
-func (clt APIClient) PostRepository(
-	repoURL string,
-	name *string,
-	description *string,
-	publiccodeYml *string,
-	isFork *bool,
-	organisationURI string,
-	createdAt time.Time,
-	lastCrawledAt time.Time,
-	lastActivityAt time.Time,
-) (*Repository, error) {
-	body, err := json.Marshal(repositoryRequest{
-		URL:              repoURL,
-		Name:             name,
-		ShortDescription: description,
-		PublicCodeURL:    publiccodeYml,
-		IsFork:           isFork,
-		OrganisationURI:  organisationURI,
-		CreatedAt:        createdAt,
-		LastCrawledAt:    lastCrawledAt,
-		LastActivityAt:   lastActivityAt,
-	})
+// PostRepository creates a new repository entry, or updates the existing one.
+// If PreviousURL is set, the entry registered under that URL is moved to URL.
+func (clt APIClient) PostRepository(repository RepositoryRequest) (*Repository, error) {
+	body, err := json.Marshal(repository)
 	if err != nil {
 		return nil, fmt.Errorf("can't marshal repository: %w", err)
 	}
 
 	endpoint := joinPath(clt.baseURL, "/repositories")
 	log.Debugf(
-		"POST %s (repoUrl=%s name=%s descPresent=%t publiccode=%t isFork=%t orgUri=%s)",
+		"POST %s (repoUrl=%s previousUrl=%s name=%s descPresent=%t publiccode=%t isFork=%t orgUri=%s)",
 		endpoint,
-		repoURL,
-		deref(name),
-		description != nil,
-		publiccodeYml != nil,
-		derefBool(isFork),
-		organisationURI,
+		repository.URL,
+		deref(repository.PreviousURL),
+		deref(repository.Name),
+		repository.ShortDescription != nil,
+		repository.PublicCodeURL != nil,
+		derefBool(repository.IsFork),
+		repository.OrganisationURI,
 	)
 
 	if log.IsLevelEnabled(log.DebugLevel) {
@@ -329,19 +431,172 @@ func (clt APIClient) PostRepository(
 	return created, nil
 }
 
-func (clt *APIClient) refreshToken(ctx context.Context) (string, error) {
-	if clt.tokenFetcher == nil {
-		return "", errors.New("token fetcher not configured")
+// GetRepository returns the register entry for the repository at repoURL, or
+// ErrRepositoryNotFound.
+func (clt APIClient) GetRepository(repoURL string) (*Repository, error) {
+	reqURL := joinPath(clt.baseURL, "/repositories") + "?url=" + url.QueryEscape(repoURL)
+
+	res, err := clt.Get(reqURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't get repository %s: %w", repoURL, err)
+	}
+
+	defer res.Body.Close()
+
+	log.Debugf("GET %s -> %s (rl-rem=%s)", reqURL, res.Status, res.Header.Get("RateLimit-Remaining"))
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrRepositoryNotFound
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("can't get repository %s: HTTP status %s", repoURL, res.Status)
+	}
+
+	var repositories []Repository
+	if err := json.NewDecoder(res.Body).Decode(&repositories); err != nil {
+		return nil, fmt.Errorf("can't parse GET %s response: %w", reqURL, err)
+	}
+
+	// Match the URL here too, in case the API ignores the filter.
+	for _, repository := range repositories {
+		if strings.EqualFold(repository.RepositoryURL, repoURL) {
+			return &repository, nil
+		}
+	}
+
+	return nil, ErrRepositoryNotFound
+}
+
+// PatchRepository changes only the given fields of the register entry with ID
+// id. fields uses the JSON names of RepositoryRequest.
+func (clt APIClient) PatchRepository(id string, fields map[string]json.RawMessage) (*Repository, error) {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal repository patch: %w", err)
+	}
+
+	endpoint := joinPath(clt.baseURL, "/repositories", url.PathEscape(id))
+
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.Debugf("PATCH %s payload=%s", endpoint, strings.TrimSpace(string(body)))
 	}
 
-	fetched, err := clt.tokenFetcher.Fetch(ctx)
+	res, err := clt.Patch(endpoint, body)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("can't update repository: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	log.Debugf("PATCH %s -> %s (rl-rem=%s)", endpoint, res.Status, res.Header.Get("RateLimit-Remaining"))
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("can't update repository %s: %w", id, ErrRepositoryNotFound)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		respBody, _ := io.ReadAll(res.Body)
+
+		return nil, fmt.Errorf(
+			"can't update repository: API replied with HTTP %s: %s", res.Status, strings.TrimSpace(string(respBody)),
+		)
+	}
+
+	updated := &Repository{}
+	if err := json.NewDecoder(res.Body).Decode(updated); err != nil {
+		return nil, fmt.Errorf("can't parse PATCH /repositories response: %w", err)
+	}
+
+	return updated, nil
+}
+
+// PostAPI registers an API specification, or updates the API already
+// registered with the same OasURL.
+func (clt APIClient) PostAPI(api APIRequest) (*API, error) {
+	created := &API{}
+	if err := clt.postJSON("/apis", api, created); err != nil {
+		return nil, fmt.Errorf("can't register API %s: %w", api.OasURL, err)
+	}
+
+	return created, nil
+}
+
+// PostSBOM stores the software bill of materials of a repository, replacing
+// the previous one.
+func (clt APIClient) PostSBOM(sbom SBOMRequest) error {
+	if err := clt.postJSON("/sboms", sbom, nil); err != nil {
+		return fmt.Errorf("can't post SBOM for %s: %w", sbom.RepositoryURL, err)
+	}
+
+	return nil
+}
+
+// PostVulnerabilities stores the vulnerabilities found in the dependencies of a
+// repository.
+func (clt APIClient) PostVulnerabilities(req VulnerabilitiesRequest) error {
+	if err := clt.postJSON("/vulnerabilities", req, nil); err != nil {
+		return fmt.Errorf("can't post vulnerabilities for %s: %w", req.RepositoryURL, err)
+	}
+
+	return nil
+}
+
+// postJSON POSTs payload as JSON to path and, if out isn't nil, decodes the
+// response into it.
+func (clt APIClient) postJSON(path string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("can't marshal request: %w", err)
+	}
+
+	endpoint := joinPath(clt.baseURL, path)
+
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.Debugf("POST %s payload=%s", endpoint, strings.TrimSpace(string(body)))
+	}
+
+	res, err := clt.Post(endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	log.Debugf("POST %s -> %s (rl-rem=%s)", endpoint, res.Status, res.Header.Get("RateLimit-Remaining"))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		respBody, _ := io.ReadAll(res.Body)
+
+		return fmt.Errorf("API replied with HTTP %s: %s", res.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("can't parse POST %s response: %w", path, err)
+	}
+
+	return nil
+}
+
+// do sends req once the rate limit allows it and records the limit in the
+// response.
+func (clt APIClient) do(req *http.Request) (*http.Response, error) {
+	if err := clt.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	res, err := clt.retryableClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
 
-	clt.token = "Bearer " + fetched
+	clt.limiter.observe(res)
 
-	return clt.token, nil
+	return res, nil
 }
 
 func joinPath(base string, paths ...string) string {
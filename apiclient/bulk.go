@@ -0,0 +1,255 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultBatchSize is used when API_BATCH_SIZE isn't set.
+const defaultBatchSize = 50
+
+var errBulkUnsupported = errors.New("bulk endpoint not supported")
+
+// bulkSupport remembers that the API has no bulk endpoint for POST or PATCH,
+// so it's asked only once. It's shared by the copies of an APIClient.
+type bulkSupport struct {
+	unsupported      atomic.Bool
+	patchUnsupported atomic.Bool
+}
+
+// BulkResult is the outcome for one repository of PostRepositories or
+// PatchRepositories.
+type BulkResult struct {
+	Repository *Repository
+	Err        error
+}
+
+// RepositoryPatch changes Fields of the register entry with ID, see
+// PatchRepository.
+type RepositoryPatch struct {
+	ID     string
+	Fields map[string]json.RawMessage
+}
+
+// bulkItem is the per-repository result in the response of
+// POST and PATCH /repositories/bulk. POST results are identified by URL, PATCH
+// results by ID.
+type bulkItem struct {
+	URL        string      `json:"url,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Status     int         `json:"status"`
+	Repository *Repository `json:"repository,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// BatchSize returns how many repositories PostRepositories and
+// PatchRepositories send per request.
+func (clt APIClient) BatchSize() int {
+	if clt.batchSize <= 0 {
+		return 1
+	}
+
+	return clt.batchSize
+}
+
+// PostRepositories creates or updates repositories like PostRepository, in
+// batches of BatchSize through POST /repositories/bulk. The results are in
+// the order of repositories; one repository failing doesn't fail the others.
+// If the API has no bulk endpoint, the repositories are posted one by one.
+func (clt APIClient) PostRepositories(repositories []RepositoryRequest) []BulkResult {
+	results := make([]BulkResult, 0, len(repositories))
+
+	for start := 0; start < len(repositories); start += clt.BatchSize() {
+		batch := repositories[start:min(start+clt.BatchSize(), len(repositories))]
+
+		results = append(results, clt.postBatch(batch)...)
+	}
+
+	return results
+}
+
+// PatchRepositories changes register entries like PatchRepository, in batches
+// of BatchSize through PATCH /repositories/bulk, with the same results as
+// PostRepositories. If the API has no bulk endpoint, the entries are patched
+// one by one.
+func (clt APIClient) PatchRepositories(patches []RepositoryPatch) []BulkResult {
+	results := make([]BulkResult, 0, len(patches))
+
+	for start := 0; start < len(patches); start += clt.BatchSize() {
+		batch := patches[start:min(start+clt.BatchSize(), len(patches))]
+
+		results = append(results, clt.patchBatch(batch)...)
+	}
+
+	return results
+}
+
+func (clt APIClient) postBatch(batch []RepositoryRequest) []BulkResult {
+	if len(batch) > 1 && (clt.bulk == nil || !clt.bulk.unsupported.Load()) {
+		urls := make([]string, len(batch))
+		for i, repository := range batch {
+			urls[i] = repository.URL
+		}
+
+		results, err := clt.sendBulk(http.MethodPost, batch, urls)
+		if !errors.Is(err, errBulkUnsupported) {
+			return resultsOrError(results, err, len(batch))
+		}
+
+		log.Info("The API has no bulk endpoint, posting repositories one by one")
+
+		if clt.bulk != nil {
+			clt.bulk.unsupported.Store(true)
+		}
+	}
+
+	results := make([]BulkResult, len(batch))
+	for i, repository := range batch {
+		results[i].Repository, results[i].Err = clt.PostRepository(repository)
+	}
+
+	return results
+}
+
+func (clt APIClient) patchBatch(batch []RepositoryPatch) []BulkResult {
+	if len(batch) > 1 && (clt.bulk == nil || !clt.bulk.patchUnsupported.Load()) {
+		ids := make([]string, len(batch))
+		items := make([]map[string]json.RawMessage, len(batch))
+
+		for i, patch := range batch {
+			ids[i] = patch.ID
+
+			items[i] = make(map[string]json.RawMessage, len(patch.Fields)+1)
+			for field, value := range patch.Fields {
+				items[i][field] = value
+			}
+
+			items[i]["id"], _ = json.Marshal(patch.ID)
+		}
+
+		results, err := clt.sendBulk(http.MethodPatch, items, ids)
+		if !errors.Is(err, errBulkUnsupported) {
+			return resultsOrError(results, err, len(batch))
+		}
+
+		log.Info("The API has no bulk endpoint for PATCH, patching repositories one by one")
+
+		if clt.bulk != nil {
+			clt.bulk.patchUnsupported.Store(true)
+		}
+	}
+
+	results := make([]BulkResult, len(batch))
+	for i, patch := range batch {
+		results[i].Repository, results[i].Err = clt.PatchRepository(patch.ID, patch.Fields)
+	}
+
+	return results
+}
+
+// resultsOrError returns results, or n results failing with err if it's set.
+func resultsOrError(results []BulkResult, err error, n int) []BulkResult {
+	if err == nil {
+		return results
+	}
+
+	results = make([]BulkResult, n)
+	for i := range results {
+		results[i].Err = err
+	}
+
+	return results
+}
+
+// sendBulk sends payload, a list of repositories, with method to
+// /repositories/bulk and returns a result per key: the URLs for POST, the IDs
+// for PATCH.
+func (clt APIClient) sendBulk(method string, payload any, keys []string) ([]BulkResult, error) {
+	what := "upsert"
+	if method == http.MethodPatch {
+		what = "update"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal repositories: %w", err)
+	}
+
+	endpoint := joinPath(clt.baseURL, "/repositories/bulk")
+
+	var res *http.Response
+	if method == http.MethodPatch {
+		res, err = clt.Patch(endpoint, body)
+	} else {
+		res, err = clt.Post(endpoint, body)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't %s repositories: %w", what, err)
+	}
+
+	defer res.Body.Close()
+
+	log.Debugf("%s %s (%d repositories) -> %s (rl-rem=%s)",
+		method, endpoint, len(keys), res.Status, res.Header.Get("RateLimit-Remaining"))
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed ||
+		res.StatusCode == http.StatusNotImplemented:
+		_, _ = io.Copy(io.Discard, res.Body)
+
+		return nil, errBulkUnsupported
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		respBody, _ := io.ReadAll(res.Body)
+
+		return nil, fmt.Errorf(
+			"can't %s repositories: API replied with HTTP %s: %s", what, res.Status, strings.TrimSpace(string(respBody)),
+		)
+	}
+
+	var items []bulkItem
+	if err := json.NewDecoder(res.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("can't parse %s /repositories/bulk response: %w", method, err)
+	}
+
+	byKey := make(map[string]bulkItem, len(items))
+
+	for _, item := range items {
+		if method == http.MethodPatch {
+			byKey[item.ID] = item
+		} else {
+			byKey[item.URL] = item
+		}
+	}
+
+	action := "create"
+	if method == http.MethodPatch {
+		action = "update"
+	}
+
+	results := make([]BulkResult, len(keys))
+
+	for i, key := range keys {
+		item, ok := byKey[key]
+
+		switch {
+		case !ok:
+			results[i].Err = fmt.Errorf("can't %s repository: missing from the bulk response", action)
+		case item.Status == http.StatusNotFound && method == http.MethodPatch:
+			results[i].Err = fmt.Errorf("can't %s repository %s: %w", action, key, ErrRepositoryNotFound)
+		case item.Status < 200 || item.Status > 299:
+			results[i].Err = fmt.Errorf("can't %s repository: API replied with HTTP %d: %s", action, item.Status, item.Error)
+		default:
+			results[i].Repository = item.Repository
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,221 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func repositoryRequests(urls ...string) []RepositoryRequest {
+	requests := make([]RepositoryRequest, len(urls))
+	for i, u := range urls {
+		requests[i] = RepositoryRequest{URL: u}
+	}
+
+	return requests
+}
+
+func TestPostRepositoriesBulk(t *testing.T) {
+	var batches [][]RepositoryRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repositories" {
+			_, _ = w.Write([]byte(`{"id":"single"}`))
+
+			return
+		}
+
+		require.Equal(t, "/repositories/bulk", r.URL.Path)
+
+		var batch []RepositoryRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		batches = append(batches, batch)
+
+		items := make([]map[string]any, 0, len(batch))
+		for _, repository := range batch {
+			if repository.URL == "https://github.com/acme/bad" {
+				items = append(items, map[string]any{"url": repository.URL, "status": 422, "error": "invalid license"})
+
+				continue
+			}
+
+			items = append(items, map[string]any{
+				"url": repository.URL, "status": 200, "repository": map[string]any{"id": repository.URL},
+			})
+		}
+
+		w.WriteHeader(http.StatusMultiStatus)
+		require.NoError(t, json.NewEncoder(w).Encode(items))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client(), batchSize: 2, bulk: &bulkSupport{}}
+
+	results := client.PostRepositories(repositoryRequests(
+		"https://github.com/acme/a", "https://github.com/acme/bad", "https://github.com/acme/c",
+	))
+
+	// A batch of one is an ordinary POST.
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0], 2)
+
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "https://github.com/acme/a", results[0].Repository.ID)
+	assert.ErrorContains(t, results[1].Err, "invalid license")
+	require.NoError(t, results[2].Err)
+	assert.Equal(t, "single", results[2].Repository.ID)
+}
+
+func TestPostRepositoriesFallsBackToSinglePosts(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		if r.URL.Path == "/repositories/bulk" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"repo"}`))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client(), batchSize: 2, bulk: &bulkSupport{}}
+
+	results := client.PostRepositories(repositoryRequests(
+		"https://github.com/acme/a", "https://github.com/acme/b", "https://github.com/acme/c",
+	))
+
+	for _, result := range results {
+		require.NoError(t, result.Err)
+	}
+
+	// The bulk endpoint is tried only once.
+	assert.Equal(t, []string{
+		"/repositories/bulk", "/repositories", "/repositories", "/repositories",
+	}, paths)
+}
+
+func TestPatchRepositoriesBulk(t *testing.T) {
+	var batch []map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPatch, r.Method)
+		require.Equal(t, "/repositories/bulk", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(`[{"id":"repo-1","status":200,"repository":{"id":"repo-1"}},{"id":"gone","status":404}]`))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client(), batchSize: 2, bulk: &bulkSupport{}}
+
+	results := client.PatchRepositories([]RepositoryPatch{
+		{ID: "repo-1", Fields: map[string]json.RawMessage{"license": json.RawMessage(`"MIT"`)}},
+		{ID: "gone", Fields: map[string]json.RawMessage{"lastCrawledAt": json.RawMessage(`"2026-10-18T00:00:00Z"`)}},
+	})
+
+	assert.Equal(t, []map[string]any{
+		{"id": "repo-1", "license": "MIT"},
+		{"id": "gone", "lastCrawledAt": "2026-10-18T00:00:00Z"},
+	}, batch)
+
+	require.Len(t, results, 2)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "repo-1", results[0].Repository.ID)
+	assert.ErrorIs(t, results[1].Err, ErrRepositoryNotFound)
+}
+
+func TestPatchRepositoriesFallsBackToSinglePatches(t *testing.T) {
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		if r.URL.Path == "/repositories/bulk" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"repo"}`))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client(), batchSize: 2, bulk: &bulkSupport{}}
+	fields := map[string]json.RawMessage{"license": json.RawMessage(`"MIT"`)}
+
+	results := client.PatchRepositories([]RepositoryPatch{
+		{ID: "a", Fields: fields}, {ID: "b", Fields: fields}, {ID: "c", Fields: fields}, {ID: "d", Fields: fields},
+	})
+
+	for _, result := range results {
+		require.NoError(t, result.Err)
+	}
+
+	assert.Equal(t, []string{
+		"/repositories/bulk", "/repositories/a", "/repositories/b", "/repositories/c", "/repositories/d",
+	}, paths)
+}
+
+func TestListRepositoriesFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/repositories", r.URL.Path)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		w.Header().Set("Total-Pages", "2")
+		_, _ = w.Write([]byte(`[{"id":"repo-` + strconv.Itoa(page) + `"}]`))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client()}
+
+	repositories, err := client.ListRepositories()
+	require.NoError(t, err)
+
+	require.Len(t, repositories, 2)
+	assert.Equal(t, "repo-1", repositories[0].ID)
+	assert.Equal(t, "repo-2", repositories[1].ID)
+}
+
+func TestRateLimiterWaitsForReset(t *testing.T) {
+	var requests []time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests = append(requests, time.Now())
+
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(2-len(requests)))
+		w.Header().Set("RateLimit-Reset", "1")
+		_, _ = w.Write([]byte(`{"id":"repo"}`))
+	}))
+	defer server.Close()
+
+	client := APIClient{baseURL: server.URL, retryableClient: server.Client(), limiter: newRateLimiter()}
+
+	for range 3 {
+		_, err := client.PostRepository(RepositoryRequest{URL: "https://github.com/acme/a"})
+		require.NoError(t, err)
+	}
+
+	require.Len(t, requests, 3)
+	assert.Less(t, requests[1].Sub(requests[0]), 500*time.Millisecond)
+	assert.GreaterOrEqual(t, requests[2].Sub(requests[1]), 900*time.Millisecond)
+}
@@ -0,0 +1,57 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostAPI(t *testing.T) {
+	var received map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/apis", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"api-1","oasUrl":"https://raw.example.org/openapi.yaml"}`))
+	}))
+	defer server.Close()
+
+	client := APIClient{
+		baseURL:         server.URL,
+		retryableClient: server.Client(),
+	}
+
+	title := "Zaken API"
+	created, err := client.PostAPI(APIRequest{
+		OasURL:            "https://raw.example.org/openapi.yaml",
+		SpecificationType: "openapi",
+		Title:             &title,
+		RepositoryURL:     "https://github.com/example/zaken.git",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "api-1", created.ID)
+	assert.Equal(t, "Zaken API", received["title"])
+	assert.Equal(t, "https://github.com/example/zaken.git", received["repositoryUrl"])
+	assert.NotContains(t, received, "version")
+}
+
+func TestPostAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "invalid oasUrl", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := APIClient{
+		baseURL:         server.URL,
+		retryableClient: server.Client(),
+	}
+
+	_, err := client.PostAPI(APIRequest{OasURL: "nope"})
+	require.ErrorContains(t, err, "invalid oasUrl")
+}
@@ -5,14 +5,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestPostRepositoryIncludesForkFlag(t *testing.T) {
-	var received repositoryRequest
+	var received RepositoryRequest
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, http.MethodPost, r.Method)
@@ -32,19 +31,82 @@ func TestPostRepositoryIncludesForkFlag(t *testing.T) {
 	}
 
 	isFork := true
-	created, err := client.PostRepository(
-		"https://github.com/example/fork.git",
-		nil,
-		nil,
-		nil,
-		&isFork,
-		"https://example.org/orgs/test",
-		time.Time{},
-		time.Time{},
-		time.Time{},
-	)
+	created, err := client.PostRepository(RepositoryRequest{
+		URL:             "https://github.com/example/fork.git",
+		IsFork:          &isFork,
+		OrganisationURI: "https://example.org/orgs/test",
+	})
 	require.NoError(t, err)
 	require.NotNil(t, created)
 	assert.NotNil(t, received.IsFork)
 	assert.True(t, *received.IsFork)
 }
+
+func TestPostRepositoryIncludesPreviousURL(t *testing.T) {
+	var received map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"repo-1"}`))
+	}))
+	defer server.Close()
+
+	client := APIClient{
+		baseURL:         server.URL,
+		retryableClient: server.Client(),
+	}
+
+	previousURL := "https://github.com/old-org/repo.git"
+	_, err := client.PostRepository(RepositoryRequest{
+		URL:         "https://github.com/new-org/repo.git",
+		PreviousURL: &previousURL,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, previousURL, received["previousUrl"])
+
+	_, err = client.PostRepository(RepositoryRequest{URL: "https://github.com/new-org/repo.git"})
+	require.NoError(t, err)
+	assert.NotContains(t, received, "previousUrl")
+}
+
+func TestGetAndPatchRepository(t *testing.T) {
+	var patch map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repositories":
+			if r.URL.Query().Get("url") != "https://github.com/acme/zaken" {
+				_, _ = w.Write([]byte(`[]`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`[{"id":"repo-1","repositoryUrl":"https://github.com/acme/zaken","license":"MIT"}]`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repositories/repo-1":
+			assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			_, _ = w.Write([]byte(`{"id":"repo-1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := APIClient{
+		baseURL:         server.URL,
+		retryableClient: server.Client(),
+	}
+
+	_, err := client.GetRepository("https://github.com/acme/other")
+	require.ErrorIs(t, err, ErrRepositoryNotFound)
+
+	current, err := client.GetRepository("https://github.com/acme/zaken")
+	require.NoError(t, err)
+	assert.Equal(t, "MIT", *current.License)
+
+	_, err = client.PatchRepository(current.ID, map[string]json.RawMessage{"license": json.RawMessage(`"EUPL-1.2"`)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"license": "EUPL-1.2"}, patch)
+}
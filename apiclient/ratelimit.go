@@ -0,0 +1,106 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// rateLimitMaxWait caps how long a single request waits for the limit to
+	// reset, in case the API sends a bogus reset.
+	rateLimitMaxWait = 15 * time.Minute
+	// unixTimeThreshold tells a RateLimit-Reset in seconds from now, as in the
+	// IETF draft, from a Unix timestamp, as some servers send.
+	unixTimeThreshold = 1_000_000_000
+)
+
+// rateLimiter holds requests back when the API said the limit is used up,
+// through RateLimit-Remaining and RateLimit-Reset or a Retry-After. It's
+// shared by the copies of an APIClient. A nil rateLimiter never waits.
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{}
+}
+
+// wait blocks until the limit has reset.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	delay := time.Until(l.until)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	log.Infof("API rate limit reached, waiting %s", delay.Round(time.Second))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// observe records the limit in the headers of an API response.
+func (l *rateLimiter) observe(res *http.Response) {
+	if l == nil || res == nil {
+		return
+	}
+
+	var reset time.Time
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(res.Header.Get("Retry-After"))); err == nil {
+			reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	if remaining := res.Header.Get("RateLimit-Remaining"); strings.TrimSpace(remaining) == "0" {
+		if r, ok := parseRateLimitReset(res.Header.Get("RateLimit-Reset")); ok && r.After(reset) {
+			reset = r
+		}
+	}
+
+	if reset.IsZero() {
+		return
+	}
+
+	if maxReset := time.Now().Add(rateLimitMaxWait); reset.After(maxReset) {
+		reset = maxReset
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if reset.After(l.until) {
+		l.until = reset
+	}
+}
+
+func parseRateLimitReset(value string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+
+	if seconds >= unixTimeThreshold {
+		return time.Unix(seconds, 0), true
+	}
+
+	return time.Now().Add(time.Duration(seconds) * time.Second), true
+}
@@ -2,6 +2,10 @@ package apiclient
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,20 +14,67 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/rsajwt"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// tokenRefreshThreshold is how long before it expires a token is replaced.
+	tokenRefreshThreshold = 30 * time.Second
+	// clientAssertionExpiry is the lifetime of a private_key_jwt assertion.
+	clientAssertionExpiry = time.Minute
+	clientAssertionType   = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
 )
 
-// KeycloakTokenFetcher fetches a bearer token via client_credentials.
+// ClientAuth holds how the crawler authenticates to Keycloak: with a client
+// secret, with a JWT signed by AssertionKey (private_key_jwt) or with just a
+// client certificate (tls_client_auth). Certificate can be combined with the
+// other two, the token endpoint is then called over mutual TLS.
+type ClientAuth struct {
+	Secret string
+	// AssertionKey signs the client assertion, AssertionKeyID is its kid.
+	AssertionKey   *rsa.PrivateKey
+	AssertionKeyID string
+	Certificate    *tls.Certificate
+}
+
+func (a ClientAuth) empty() bool {
+	return a.Secret == "" && a.AssertionKey == nil && a.Certificate == nil
+}
+
+// KeycloakTokenFetcher fetches a bearer token via client_credentials and
+// caches it until shortly before it expires. It's safe for concurrent use and
+// shared by the copies of an APIClient.
 type KeycloakTokenFetcher struct {
-	httpClient   *http.Client
-	tokenURL     string
-	clientID     string
-	clientSecret string
+	httpClient *http.Client
+	tokenURL   string
+	clientID   string
+	auth       ClientAuth
+
+	mu          sync.Mutex
+	accessToken string
+	// expiresAt is zero if Keycloak didn't say, the token is then used until
+	// the API rejects it.
+	expiresAt time.Time
 }
 
 // NewKeycloakTokenFetcher creates a fetcher with explicit config.
 func NewKeycloakTokenFetcher(httpClient *http.Client, tokenURL, clientID, clientSecret string) *KeycloakTokenFetcher {
-	if tokenURL == "" || clientID == "" || clientSecret == "" {
+	return NewKeycloakTokenFetcherWithAuth(httpClient, tokenURL, clientID, ClientAuth{
+		Secret: strings.TrimSpace(clientSecret),
+	})
+}
+
+// NewKeycloakTokenFetcherWithAuth creates a fetcher that authenticates with
+// auth. If auth has a Certificate, it's added to the TLS config of a copy of
+// httpClient.
+func NewKeycloakTokenFetcherWithAuth(
+	httpClient *http.Client, tokenURL, clientID string, auth ClientAuth,
+) *KeycloakTokenFetcher {
+	if tokenURL == "" || clientID == "" || auth.empty() {
 		return nil
 	}
 
@@ -31,49 +82,114 @@ func NewKeycloakTokenFetcher(httpClient *http.Client, tokenURL, clientID, client
 		httpClient = &http.Client{Timeout: 30 * time.Second}
 	}
 
+	if auth.Certificate != nil {
+		httpClient = withClientCertificate(httpClient, *auth.Certificate)
+	}
+
 	return &KeycloakTokenFetcher{
-		httpClient:   httpClient,
-		tokenURL:     strings.TrimSpace(tokenURL),
-		clientID:     strings.TrimSpace(clientID),
-		clientSecret: strings.TrimSpace(clientSecret),
+		httpClient: httpClient,
+		tokenURL:   strings.TrimSpace(tokenURL),
+		clientID:   strings.TrimSpace(clientID),
+		auth:       auth,
 	}
 }
 
-// NewKeycloakTokenFetcherFromEnv builds a fetcher from env:
-// KEYCLOAK_BASE_URL + KEYCLOAK_REALM, and AUTH_CLIENT_ID / AUTH_CLIENT_SECRET.
-func NewKeycloakTokenFetcherFromEnv() *KeycloakTokenFetcher {
-	base := strings.TrimSpace(os.Getenv("KEYCLOAK_BASE_URL"))
-	realm := strings.TrimSpace(os.Getenv("KEYCLOAK_REALM"))
+// NewKeycloakTokenFetcherFromEnv builds a fetcher from env: KEYCLOAK_TOKEN_URL
+// or KEYCLOAK_BASE_URL + KEYCLOAK_REALM, AUTH_CLIENT_ID, and AUTH_CLIENT_SECRET,
+// AUTH_CLIENT_ASSERTION_KEY (+ AUTH_CLIENT_ASSERTION_KEY_ID) and/or
+// AUTH_CLIENT_CERT + AUTH_CLIENT_CERT_KEY. It returns nil if Keycloak isn't
+// configured, and an error if the client credentials can't be read.
+func NewKeycloakTokenFetcherFromEnv() (*KeycloakTokenFetcher, error) {
+	tokenURL := strings.TrimSpace(os.Getenv("KEYCLOAK_TOKEN_URL"))
 
-	if base == "" || realm == "" {
-		return nil
+	if tokenURL == "" {
+		base := strings.TrimSpace(os.Getenv("KEYCLOAK_BASE_URL"))
+		realm := strings.TrimSpace(os.Getenv("KEYCLOAK_REALM"))
+
+		if base == "" || realm == "" {
+			//nolint:nilnil // Keycloak isn't configured, calls are made without a token.
+			return nil, nil
+		}
+
+		b := strings.TrimSuffix(base, "/")
+		tokenURL = fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", b, url.PathEscape(realm))
+	}
+
+	auth, err := clientAuthFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("can't configure Keycloak client authentication: %w", err)
 	}
 
-	b := strings.TrimSuffix(base, "/")
-	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", b, url.PathEscape(realm))
+	return NewKeycloakTokenFetcherWithAuth(nil, tokenURL, os.Getenv("AUTH_CLIENT_ID"), auth), nil
+}
+
+// Token returns the cached access token (without "Bearer " prefix), fetching
+// a new one if there's none or it's about to expire. Concurrent callers wait
+// for a single fetch.
+func (f *KeycloakTokenFetcher) Token(ctx context.Context) (string, error) {
+	if f == nil {
+		return "", errors.New("fetcher is nil")
+	}
 
-	return NewKeycloakTokenFetcher(
-		nil,
-		tokenURL,
-		os.Getenv("AUTH_CLIENT_ID"),
-		os.Getenv("AUTH_CLIENT_SECRET"),
-	)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.accessToken != "" && (f.expiresAt.IsZero() || time.Until(f.expiresAt) > tokenRefreshThreshold) {
+		return f.accessToken, nil
+	}
+
+	return f.fetchLocked(ctx)
 }
 
-// Fetch retrieves an access token string (without "Bearer " prefix).
+// Fetch retrieves a new access token string (without "Bearer " prefix),
+// replacing the cached one.
 func (f *KeycloakTokenFetcher) Fetch(ctx context.Context) (string, error) {
 	if f == nil {
 		return "", errors.New("fetcher is nil")
 	}
 
-	if f.tokenURL == "" || f.clientID == "" || f.clientSecret == "" {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.fetchLocked(ctx)
+}
+
+// invalidate drops token from the cache after the API rejected it, unless
+// another caller replaced it already.
+func (f *KeycloakTokenFetcher) invalidate(token string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.accessToken == token {
+		f.accessToken = ""
+	}
+}
+
+func (f *KeycloakTokenFetcher) fetchLocked(ctx context.Context) (string, error) {
+	if f.tokenURL == "" || f.clientID == "" || f.auth.empty() {
 		return "", errors.New("keycloak config missing")
 	}
 
 	form := url.Values{}
 	form.Set("grant_type", "client_credentials")
 	form.Set("client_id", f.clientID)
-	form.Set("client_secret", f.clientSecret)
+
+	switch {
+	case f.auth.AssertionKey != nil:
+		assertion, err := f.clientAssertion(time.Now())
+		if err != nil {
+			return "", err
+		}
+
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	case f.auth.Secret != "":
+		form.Set("client_secret", f.auth.Secret)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
 	if err != nil {
@@ -108,5 +224,90 @@ func (f *KeycloakTokenFetcher) Fetch(ctx context.Context) (string, error) {
 		return "", errors.New("empty access_token in response")
 	}
 
-	return tok.AccessToken, nil
+	f.accessToken = tok.AccessToken
+	f.expiresAt = time.Time{}
+
+	if tok.ExpiresIn > 0 {
+		f.expiresAt = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+
+	log.Debugf("Fetched bearer token via KeycloakTokenFetcher, expires in %ds", tok.ExpiresIn)
+
+	return f.accessToken, nil
+}
+
+// clientAssertion builds the RS256 signed JWT for private_key_jwt (RFC 7523).
+func (f *KeycloakTokenFetcher) clientAssertion(now time.Time) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("can't generate client assertion id: %w", err)
+	}
+
+	claims := map[string]any{
+		"iss": f.clientID,
+		"sub": f.clientID,
+		"aud": f.tokenURL,
+		"jti": hex.EncodeToString(jti),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionExpiry).Unix(),
+	}
+
+	assertion, err := rsajwt.Sign(claims, f.auth.AssertionKeyID, f.auth.AssertionKey)
+	if err != nil {
+		return "", fmt.Errorf("can't sign client assertion: %w", err)
+	}
+
+	return assertion, nil
+}
+
+// clientAuthFromEnv reads the client credentials. PEM values may use \n for
+// newlines, like GIT_OAUTH_SECRET.
+func clientAuthFromEnv() (ClientAuth, error) {
+	auth := ClientAuth{
+		Secret:         strings.TrimSpace(os.Getenv("AUTH_CLIENT_SECRET")),
+		AssertionKeyID: strings.TrimSpace(os.Getenv("AUTH_CLIENT_ASSERTION_KEY_ID")),
+	}
+
+	if raw := os.Getenv("AUTH_CLIENT_ASSERTION_KEY"); strings.TrimSpace(raw) != "" {
+		key, err := rsajwt.ParsePrivateKey(rsajwt.PEMFromEnv(raw))
+		if err != nil {
+			return ClientAuth{}, fmt.Errorf("AUTH_CLIENT_ASSERTION_KEY: %w", err)
+		}
+
+		auth.AssertionKey = key
+	}
+
+	certRaw := os.Getenv("AUTH_CLIENT_CERT")
+	keyRaw := os.Getenv("AUTH_CLIENT_CERT_KEY")
+
+	if strings.TrimSpace(certRaw) != "" || strings.TrimSpace(keyRaw) != "" {
+		cert, err := tls.X509KeyPair(rsajwt.PEMFromEnv(certRaw), rsajwt.PEMFromEnv(keyRaw))
+		if err != nil {
+			return ClientAuth{}, fmt.Errorf("AUTH_CLIENT_CERT / AUTH_CLIENT_CERT_KEY: %w", err)
+		}
+
+		auth.Certificate = &cert
+	}
+
+	return auth, nil
+}
+
+// withClientCertificate returns a copy of httpClient that presents cert.
+func withClientCertificate(httpClient *http.Client, cert tls.Certificate) *http.Client {
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport, _ = http.DefaultTransport.(*http.Transport)
+	}
+
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	client := *httpClient
+	client.Transport = transport
+
+	return &client
 }
@@ -0,0 +1,232 @@
+package apiclient
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenServer issues token-1, token-2, ... valid for expiresIn seconds.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var fetches atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+
+		n := fetches.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &fetches
+}
+
+func TestTokenIsCachedUntilShortlyBeforeExpiry(t *testing.T) {
+	server, fetches := newTokenServer(t, 300)
+	fetcher := NewKeycloakTokenFetcher(server.Client(), server.URL, "crawler", "secret")
+
+	for range 3 {
+		token, err := fetcher.Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// A token expiring within tokenRefreshThreshold is replaced.
+	fetcher.expiresAt = time.Now().Add(tokenRefreshThreshold / 2)
+
+	token, err := fetcher.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func TestTokenFetchedOnceForConcurrentCallers(t *testing.T) {
+	server, fetches := newTokenServer(t, 300)
+	fetcher := NewKeycloakTokenFetcher(server.Client(), server.URL, "crawler", "secret")
+
+	var wg sync.WaitGroup
+
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			token, err := fetcher.Token(t.Context())
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestRefreshedTokenIsSharedByClientCopies(t *testing.T) {
+	tokenServer, fetches := newTokenServer(t, 300)
+
+	var authorizations []string
+
+	var mu sync.Mutex
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"repo-1"}`))
+	}))
+	defer api.Close()
+
+	client := APIClient{
+		baseURL:         api.URL,
+		retryableClient: api.Client(),
+		tokenFetcher:    NewKeycloakTokenFetcher(tokenServer.Client(), tokenServer.URL, "crawler", "secret"),
+	}
+	clientCopy := client
+
+	_, err := client.PostRepository(RepositoryRequest{URL: "https://github.com/example/one"})
+	require.NoError(t, err)
+
+	_, err = clientCopy.PostRepository(RepositoryRequest{URL: "https://github.com/example/two"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2", "Bearer token-2"}, authorizations)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestTokenWithPrivateKeyJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var tokenURL string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Empty(t, r.PostForm.Get("client_secret"))
+		assert.Equal(t, clientAssertionType, r.PostForm.Get("client_assertion_type"))
+
+		parts := strings.Split(r.PostForm.Get("client_assertion"), ".")
+		require.Len(t, parts, 3)
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature))
+
+		header, err := base64.RawURLEncoding.DecodeString(parts[0])
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"alg":"RS256","typ":"JWT","kid":"key-1"}`, string(header))
+
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+
+		var claims map[string]any
+		require.NoError(t, json.Unmarshal(payload, &claims))
+		assert.Equal(t, "crawler", claims["iss"])
+		assert.Equal(t, "crawler", claims["sub"])
+		assert.Equal(t, tokenURL, claims["aud"])
+		assert.NotEmpty(t, claims["jti"])
+
+		_, _ = w.Write([]byte(`{"access_token":"signed","expires_in":300}`))
+	}))
+	defer server.Close()
+
+	tokenURL = server.URL + "/token"
+	fetcher := NewKeycloakTokenFetcherWithAuth(server.Client(), tokenURL, "crawler", ClientAuth{
+		AssertionKey:   key,
+		AssertionKeyID: "key-1",
+	})
+
+	token, err := fetcher.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "signed", token)
+}
+
+func TestTokenWithClientCertificate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "crawler", r.PostForm.Get("client_id"))
+		assert.Empty(t, r.PostForm.Get("client_secret"))
+		assert.Len(t, r.TLS.PeerCertificates, 1)
+
+		_, _ = w.Write([]byte(`{"access_token":"mtls","expires_in":300}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	fetcher := NewKeycloakTokenFetcherWithAuth(server.Client(), server.URL, "crawler", ClientAuth{
+		Certificate: &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	})
+
+	token, err := fetcher.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "mtls", token)
+}
+
+func TestNewClientFailsOnInvalidClientAuth(t *testing.T) {
+	t.Setenv("KEYCLOAK_TOKEN_URL", "https://keycloak.example.org/token")
+	t.Setenv("AUTH_CLIENT_ID", "crawler")
+	t.Setenv("AUTH_CLIENT_ASSERTION_KEY", "not a key")
+
+	_, err := NewClient()
+	require.ErrorContains(t, err, "AUTH_CLIENT_ASSERTION_KEY")
+
+	t.Setenv("AUTH_CLIENT_ASSERTION_KEY", "")
+	t.Setenv("AUTH_CLIENT_CERT", "not a certificate")
+
+	_, err = NewClient()
+	require.ErrorContains(t, err, "AUTH_CLIENT_CERT")
+
+	t.Setenv("AUTH_CLIENT_CERT", "")
+	t.Setenv("AUTH_CLIENT_SECRET", "secret")
+
+	_, err = NewClient()
+	require.NoError(t, err)
+}
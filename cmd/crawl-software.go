@@ -3,7 +3,6 @@ package cmd
 import (
 	"github.com/developer-overheid-nl/don-crawler/common"
 	"github.com/developer-overheid-nl/don-crawler/crawler"
-	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -26,12 +25,11 @@ Crawl a single software given its API id and its publisher.`,
 
 	Args: cobra.ExactArgs(2),
 	Run: func(_ *cobra.Command, args []string) {
-		if !githubapp.HasEnv() {
-			log.Fatal("Please set GIT_OAUTH_CLIENTID/GIT_OAUTH_INSTALLATION_ID/GIT_OAUTH_SECRET to use the GitHub API")
+		c, err := crawler.NewCrawler(dryRun)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		c := crawler.NewCrawler(dryRun)
-
 		publisher := common.Publisher{
 			ID: args[1],
 		}
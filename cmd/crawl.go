@@ -1,16 +1,20 @@
 package cmd
 
 import (
-	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"errors"
+
 	"github.com/developer-overheid-nl/don-crawler/common"
 	"github.com/developer-overheid-nl/don-crawler/crawler"
-	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/developer-overheid-nl/don-crawler/internal/queue"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var crawlResume bool
+
 func init() {
 	crawlCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "perform a dry run with no changes made")
+	crawlCmd.Flags().BoolVar(&crawlResume, "resume", false, "continue the last crawl where it stopped")
 
 	rootCmd.AddCommand(crawlCmd)
 }
@@ -21,7 +25,11 @@ var crawlCmd = &cobra.Command{
 	Long: `Crawl publiccode.yml files in publishers' repos.
 
 When run with no arguments, the publishers are fetched from the API,
-otherwise the passed YAML files are used.`,
+otherwise the passed YAML files are used.
+
+Progress is kept in DATADIR/queue, so a crawl that was interrupted can be
+continued with --resume. Repositories that fail CRAWL_MAX_ATTEMPTS times are
+moved to the dead-letter list, see the dead-letter command.`,
 	Example: `
 # Crawl publishers fetched from the API
 crawl
@@ -30,24 +38,38 @@ crawl
 crawl publishers.yml
 
 # Crawl all YAML files in a specific directory
-crawl directory/*.yml`,
+crawl directory/*.yml
+
+# Continue an interrupted crawl
+crawl --resume`,
 
 	Args: cobra.MinimumNArgs(0),
 	Run: func(_ *cobra.Command, args []string) {
-		if !githubapp.HasEnv() {
-			log.Fatal("Please set GIT_OAUTH_CLIENTID/GIT_OAUTH_INSTALLATION_ID/GIT_OAUTH_SECRET to use the GitHub API")
+		c, err := crawler.NewCrawler(dryRun)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		c := crawler.NewCrawler(dryRun)
+		if crawlResume {
+			if len(args) > 0 || dryRun {
+				log.Fatal("--resume can't be combined with publishers files or --dry-run")
+			}
 
-		var publishers []common.Publisher
+			if err := c.Resume(); err != nil {
+				if errors.Is(err, queue.ErrNotFound) {
+					log.Fatal("There's no crawl to resume")
+				}
 
-		if len(args) == 0 {
-			var err error
+				log.Fatal(err)
+			}
 
-			apiclient := apiclient.NewClient()
+			return
+		}
 
-			publishers, err = apiclient.GetGitOrganisations()
+		var publishers []common.Publisher
+
+		if len(args) == 0 {
+			publishers, err = registerPublishers()
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/developer-overheid-nl/don-crawler/crawler"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	deadLetterCmd.AddCommand(deadLetterClearCmd)
+	rootCmd.AddCommand(deadLetterCmd)
+}
+
+var deadLetterCmd = &cobra.Command{
+	Use:   "dead-letter",
+	Short: "List repositories that keep failing.",
+	Long: `List the repositories that failed CRAWL_MAX_ATTEMPTS times in a row.
+Full and resumed crawls skip them until they're cleared.`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		letters, err := crawler.DeadLetters()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "KEY\tATTEMPTS\tSINCE\tERROR")
+
+		for _, letter := range letters {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+				letter.Key, letter.Attempts, letter.DeadAt.Format("2006-01-02 15:04"), letter.Error)
+		}
+
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var deadLetterClearCmd = &cobra.Command{
+	Use:   "clear [KEY ...]",
+	Short: "Remove repositories from the dead-letter list.",
+	Long: `Remove the given keys from the dead-letter list, or all of them when
+none are given, so the next crawl tries them again. It refuses to run while a
+crawl is running.`,
+	Example: `
+# Retry a single repository
+dead-letter clear repository:https://github.com/example/zaken
+
+# Retry everything
+dead-letter clear`,
+	Run: func(_ *cobra.Command, args []string) {
+		// A running crawl would save its own copy of the list over this one.
+		unlock, err := state.Lock()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer unlock()
+
+		removed, err := crawler.ClearDeadLetters(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Removed %d entries from the dead-letter list", removed)
+	},
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/crawler"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var flushOutboxList bool
+
+func init() {
+	flushOutboxCmd.Flags().BoolVar(&flushOutboxList, "list", false, "only list the updates in the outbox")
+
+	rootCmd.AddCommand(flushOutboxCmd)
+}
+
+var flushOutboxCmd = &cobra.Command{
+	Use:   "flush-outbox",
+	Short: "Send repository updates the register didn't accept.",
+	Long: `Send the repository updates in DATADIR/state/outbox.json to the register.
+
+Updates land in the outbox when the register keeps rejecting them during a
+crawl, or when the crawler can't look up the register entry to compare with.
+Crawls retry them too, at the start and at the end; use this command to replay
+them as soon as the register is healthy again. It exits with an error if
+updates are left, and refuses to run while a crawl is running.`,
+	Example: `
+# Show what's waiting
+flush-outbox --list
+
+# Send it
+flush-outbox`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		if flushOutboxList {
+			entries, err := crawler.Outbox()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "URL\tATTEMPTS\tFAILED AT\tERROR")
+
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+					entry.Request.URL, entry.Attempts, entry.FailedAt.Format("2006-01-02 15:04"), entry.Error)
+			}
+
+			if err := w.Flush(); err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		// A running crawl would save its own copy of the outbox over this one.
+		unlock, err := state.Lock()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer unlock()
+
+		client, err := apiclient.NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sent, left, err := crawler.FlushOutbox(context.Background(), client)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Sent %d repository updates, %d left", sent, left)
+
+		if left > 0 {
+			log.Fatal("The register didn't accept all updates, see flush-outbox --list")
+		}
+	},
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/developer-overheid-nl/don-crawler/internal/httpcache"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcMaxSize    string
+	gcMaxAgeDays int
+	gcOrphanRuns int
+)
+
+func init() {
+	gcCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only report what would be removed")
+	gcCmd.Flags().StringVar(&gcMaxSize, "max-size", "", "maximum total size of the clones (e.g. 20G), overrides CACHE_MAX_SIZE")
+	gcCmd.Flags().IntVar(&gcMaxAgeDays, "max-age", 0, "remove clones unused for this many days, overrides CACHE_MAX_AGE_DAYS")
+	gcCmd.Flags().IntVar(&gcOrphanRuns, "orphan-runs", 0,
+		"remove clones not seen in this many crawls, overrides CACHE_ORPHAN_RUNS")
+
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove stale repository clones and HTTP cache entries from DATADIR.",
+	Long: `Remove stale repository clones from DATADIR/repos.
+
+Clones not seen in the last CACHE_ORPHAN_RUNS crawls or unused for more than
+CACHE_MAX_AGE_DAYS days are removed first, then the least recently used clones
+until the total size fits CACHE_MAX_SIZE.
+
+DATADIR/http-cache is pruned the same way, with HTTP_CACHE_MAX_AGE_DAYS and
+HTTP_CACHE_MAX_SIZE. Full crawls prune it too.
+
+gc refuses to run while a crawl is running, and the other way around.`,
+	Example: `
+# Show what would be removed
+gc --dry-run
+
+# Keep at most 20 GiB of clones
+gc --max-size 20G`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		policy, err := git.GCPolicyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		httpPolicy, err := httpcache.PolicyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if cmd.Flags().Changed("max-size") {
+			if policy.MaxSize, err = git.ParseByteSize(gcMaxSize); err != nil {
+				log.Fatalf("invalid --max-size: %v", err)
+			}
+		}
+
+		if cmd.Flags().Changed("max-age") {
+			policy.MaxAge = time.Duration(gcMaxAgeDays) * 24 * time.Hour
+		}
+
+		if cmd.Flags().Changed("orphan-runs") {
+			policy.OrphanRuns = gcOrphanRuns
+		}
+
+		if !dryRun {
+			// Don't pull clones from under a running crawl.
+			unlock, err := state.Lock()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			defer unlock()
+		}
+
+		cache, err := git.OpenCloneCache()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		result, err := cache.GC(policy, dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !dryRun {
+			if err := cache.Save(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for _, removed := range result.Removed {
+			//nolint:forbidigo
+			fmt.Printf("%s\t%s\t%s\n", removed.Reason, git.FormatByteSize(removed.Size), removed.Key)
+		}
+
+		verb := "Reclaimed"
+		if dryRun {
+			verb = "Would reclaim"
+		}
+
+		//nolint:forbidigo
+		fmt.Printf("%s %s from %d clones, %s remaining\n",
+			verb, git.FormatByteSize(result.Reclaimed), len(result.Removed), git.FormatByteSize(result.Remaining))
+
+		pruned, err := httpcache.Prune(httpPolicy, dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		//nolint:forbidigo
+		fmt.Printf("%s %s from %d HTTP cache entries, %s remaining\n",
+			verb, git.FormatByteSize(pruned.Reclaimed), pruned.Removed, git.FormatByteSize(pruned.Remaining))
+	},
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/crawler"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	proposePublishers string
+	proposeMax        int
+)
+
+func init() {
+	proposeCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "list the repositories without opening anything")
+	proposeCmd.Flags().StringVar(&proposePublishers, "publishers", "",
+		"publishers.yml to find the repositories' organisations in, instead of the API")
+	proposeCmd.Flags().IntVar(&proposeMax, "max", 10, "maximum number of new pull and merge requests to open")
+
+	rootCmd.AddCommand(proposeCmd)
+}
+
+var proposeCmd = &cobra.Command{
+	Use:   "propose [REPO_URL ...]",
+	Short: "Open pull and merge requests adding publiccode.yml.",
+	Long: `Open a GitHub pull request or GitLab merge request adding a draft
+publiccode.yml to repositories that lack one.
+
+Only repositories of the publishers listed in PROPOSE_PUBLISHERS are
+considered. When run with no arguments, the repositories without publiccode.yml
+are taken from the latest crawl report.
+
+A repository gets at most one request: repositories proposed to before, even
+if the request was closed, are skipped.`,
+	Example: `
+# Propose to the repositories without publiccode.yml from the latest crawl
+propose
+
+# See which repositories would get a pull request
+propose --dry-run
+
+# Propose to a single repository
+propose https://github.com/example/zaken`,
+	Run: func(_ *cobra.Command, args []string) {
+		allowed := proposeAllowedPublishers()
+		if len(allowed) == 0 {
+			log.Fatal("PROPOSE_PUBLISHERS is empty: no publisher opted in")
+		}
+
+		var (
+			publishers []common.Publisher
+			err        error
+		)
+
+		if proposePublishers != "" {
+			publishers, err = common.LoadPublishers(proposePublishers)
+		} else {
+			publishers, err = registerPublishers()
+		}
+
+		if err != nil {
+			log.Fatalf("can't load publishers: %v", err)
+		}
+
+		repoURLs := args
+		if len(repoURLs) == 0 {
+			if repoURLs, err = repositoriesWithoutPubliccode(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		ctx := context.Background()
+		c, err := crawler.NewCrawler(dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opened := 0
+
+		for _, repoURL := range repoURLs {
+			publisher, ok := common.PublisherFor(publishers, repoURL)
+			if !ok || !slices.Contains(allowed, publisher.ID) {
+				log.Debugf("skipping %s: its publisher didn't opt in", repoURL)
+
+				continue
+			}
+
+			if dryRun {
+				fmt.Println(repoURL) //nolint:forbidigo
+
+				continue
+			}
+
+			if opened >= proposeMax {
+				log.Infof("opened %d requests, stopping", opened)
+
+				break
+			}
+
+			proposal, err := c.ProposePubliccode(ctx, repoURL, publisher)
+			if errors.Is(err, crawler.ErrHasPubliccode) {
+				log.Infof("skipping %s: it has a publiccode.yml", repoURL)
+
+				continue
+			}
+
+			if err != nil {
+				log.Errorf("can't propose publiccode.yml to %s: %v", repoURL, err)
+
+				continue
+			}
+
+			if proposal.Existing {
+				log.Infof("skipping %s: proposed before in %s", repoURL, proposal.URL)
+
+				continue
+			}
+
+			opened++
+
+			fmt.Printf("%s\t%s\n", repoURL, proposal.URL) //nolint:forbidigo
+		}
+	},
+}
+
+// proposeAllowedPublishers returns the publisher IDs in PROPOSE_PUBLISHERS, a
+// comma separated list.
+func proposeAllowedPublishers() []string {
+	var ids []string
+
+	for _, id := range strings.Split(viper.GetString("PROPOSE_PUBLISHERS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// repositoriesWithoutPubliccode returns the URLs of the repositories the
+// latest crawl found without publiccode.yml.
+func repositoriesWithoutPubliccode() ([]string, error) {
+	r, err := report.Latest()
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+
+	for _, repository := range r.Repositories {
+		if repository.Score != nil && slices.Contains(repository.Score.Missing, report.MissingPubliccode) {
+			urls = append(urls, repository.URL)
+		}
+	}
+
+	sort.Strings(urls)
+
+	return urls, nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFile string
+	reportJSON bool
+)
+
+func init() {
+	reportCmd.PersistentFlags().StringVar(&reportFile, "file", "", "report to read instead of the latest one")
+	reportOrgsCmd.Flags().BoolVar(&reportJSON, "json", false, "print JSON instead of a table")
+
+	reportCmd.AddCommand(reportOrgsCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarise crawl reports.",
+	Long: `Summarise the crawl reports in DATADIR/reports.
+
+By default the report of the most recent crawl is used.`,
+}
+
+var reportOrgsCmd = &cobra.Command{
+	Use:   "orgs",
+	Short: "Rank organisations by publiccode.yml completeness.",
+	Long: `Rank organisations by the average publiccode.yml completeness score of
+their repositories, best first. Repositories without publiccode.yml score 0.`,
+	Example: `
+# Ranked table from the latest crawl
+report orgs
+
+# Same, from an older report, as JSON
+report orgs --file data/reports/20261001T020000Z.json --json`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		r, err := loadReport()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orgs := r.Organisations()
+
+		if reportJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+
+			if err := enc.Encode(orgs); err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "RANK\tPUBLISHER\tNAME\tREPOS\tPUBLICCODE\tSCORE\tMOST MISSING")
+
+		for i, org := range orgs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%.0f\t%s\n",
+				i+1, org.Publisher, org.Name, org.Repositories, org.WithPubliccode, org.AverageScore,
+				strings.Join(org.Missing, ", "))
+		}
+
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func loadReport() (*report.Report, error) {
+	if reportFile != "" {
+		return report.Load(reportFile)
+	}
+
+	return report.Latest()
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -27,3 +29,13 @@ func Execute() {
 		log.Fatal(err)
 	}
 }
+
+// registerPublishers returns the publishers in the register.
+func registerPublishers() ([]common.Publisher, error) {
+	client, err := apiclient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetGitOrganisations()
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/crawler"
+	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/developer-overheid-nl/don-crawler/internal/schedule"
+	"github.com/developer-overheid-nl/don-crawler/internal/server"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	serveShutdownTimeout = 10 * time.Second
+	// publisherCacheTTL is how long webhooks use the publishers from the API
+	// before fetching them again.
+	publisherCacheTTL = 15 * time.Minute
+)
+
+var serveAddr string
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":1337", "address to listen on")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run crawls on a schedule and on request.",
+	Long: `Run as a daemon that crawls on the cron schedule in SERVE_SCHEDULE and
+offers an HTTP API, authenticated with SERVE_TOKEN as bearer token:
+
+  POST /runs       start a crawl of everything, {"publisher": ID} or
+                   {"repository": URL}; 409 if a crawl is running
+  GET  /runs       the running crawl and past runs
+  GET  /runs/{id}  a single run
+  GET  /healthz    liveness, without authentication
+
+Webhooks queue a crawl of the repository they're about, when it belongs to a
+known publisher:
+
+  POST /webhooks/github  GitHub App webhooks, signed with
+                         GIT_OAUTH_WEBHOOK_SECRET
+  POST /webhooks/gitlab  GitLab project and system hooks, with
+                         GITLAB_WEBHOOK_TOKEN as secret token
+
+Only one crawl runs at a time. Publishers are fetched from the API at the start
+of every crawl.`,
+	Example: `
+# Crawl every night at 02:00 and listen on :1337
+SERVE_SCHEDULE="0 2 * * *" SERVE_TOKEN=... serve
+
+# Re-crawl a single repository
+curl -X POST -H "Authorization: Bearer $SERVE_TOKEN" \
+  -d '{"repository": "https://github.com/example/zaken"}' http://localhost:1337/runs`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		token := viper.GetString("SERVE_TOKEN")
+		if token == "" {
+			log.Fatal("Please set SERVE_TOKEN to protect the API")
+		}
+
+		runner, err := server.NewRunner(crawlTarget)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		if spec := viper.GetString("SERVE_SCHEDULE"); spec != "" {
+			s, err := schedule.Parse(spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			go runner.RunSchedule(ctx, s)
+		} else {
+			log.Info("SERVE_SCHEDULE is empty, crawling on request only")
+		}
+
+		api := server.New(runner, token)
+
+		queue := server.NewQueue(runner)
+		publishers := &publisherCache{}
+		server.NewWebhooks(
+			queue, publishers.watched, githubapp.WebhookSecret(), viper.GetString("GITLAB_WEBHOOK_TOKEN"),
+		).Register(api)
+
+		go queue.Run(ctx)
+
+		srv := &http.Server{
+			Addr:              serveAddr,
+			Handler:           api,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			<-ctx.Done()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Errorf("can't shut down: %v", err)
+			}
+		}()
+
+		log.Infof("Listening on %s", serveAddr)
+
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+
+		if current, _ := runner.Status(); current != nil {
+			log.Infof("Waiting for crawl #%d to finish", current.ID)
+		}
+
+		runner.Wait()
+	},
+}
+
+// publisherCache keeps the publishers from the API around for webhooks, which
+// arrive too often to fetch them every time.
+type publisherCache struct {
+	mu         sync.Mutex
+	publishers []common.Publisher
+	fetchedAt  time.Time
+}
+
+// watched tells whether the repository at repoURL belongs to a publisher.
+func (p *publisherCache) watched(repoURL string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.fetchedAt) > publisherCacheTTL {
+		publishers, err := registerPublishers()
+		if err != nil {
+			log.Errorf("can't get publishers: %v", err)
+		} else {
+			p.publishers, p.fetchedAt = publishers, time.Now()
+		}
+	}
+
+	_, ok := common.PublisherFor(p.publishers, repoURL)
+
+	return ok
+}
+
+// crawlTarget crawls the target of a daemon run with a fresh crawler.
+func crawlTarget(_ context.Context, target server.Target) error {
+	publishers, err := registerPublishers()
+	if err != nil {
+		return fmt.Errorf("can't get publishers: %w", err)
+	}
+
+	c, err := crawler.NewCrawler(false)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case target.Repository != "":
+		publisher, ok := common.PublisherFor(publishers, target.Repository)
+		if !ok {
+			return fmt.Errorf("%s doesn't belong to a known publisher", target.Repository)
+		}
+
+		return c.CrawlRepository(target.Repository, publisher)
+	case target.Publisher != "":
+		for _, publisher := range publishers {
+			if publisher.ID == target.Publisher {
+				c.Partial = true
+
+				return c.CrawlPublishers([]common.Publisher{publisher})
+			}
+		}
+
+		return fmt.Errorf("unknown publisher %s", target.Publisher)
+	default:
+		return c.CrawlPublishers(publishers)
+	}
+}
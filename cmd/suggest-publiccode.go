@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var suggestPublishers string
+
+func init() {
+	suggestPubliccodeCmd.Flags().StringVar(&suggestPublishers, "publishers", "",
+		"publishers.yml to find the repository's organisation in, instead of the API")
+
+	rootCmd.AddCommand(suggestPubliccodeCmd)
+}
+
+var suggestPubliccodeCmd = &cobra.Command{
+	Use:   "suggest-publiccode REPO_URL",
+	Short: "Draft a publiccode.yml for a repository that lacks one.",
+	Long: `Draft a publiccode.yml for a repository that lacks one and print it.
+
+The draft is filled in from the code hosting platform, the README, the detected
+license, the latest tag and the organisation the repository belongs to. A
+comment at the top lists the keys that were guessed and need a review.`,
+	Example: `
+# Draft publiccode.yml for a repository of a publisher known to the API
+suggest-publiccode https://github.com/example/zaken > publiccode.yml
+
+# Look the organisation up in a publishers file
+suggest-publiccode --publishers publishers.yml https://gitlab.com/example/zaken`,
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		var (
+			publishers []common.Publisher
+			err        error
+		)
+
+		if suggestPublishers != "" {
+			publishers, err = common.LoadPublishers(suggestPublishers)
+		} else {
+			publishers, err = registerPublishers()
+		}
+
+		if err != nil {
+			log.Warnf("can't load publishers, the draft won't have an organisation: %v", err)
+		}
+
+		publisher, ok := common.PublisherFor(publishers, args[0])
+		if !ok {
+			log.Warnf("%s doesn't belong to a known publisher", args[0])
+		}
+
+		c, err := crawler.NewCrawler(false)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		draft, err := c.SuggestPubliccode(args[0], publisher)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := os.Stdout.Write(draft); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
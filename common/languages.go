@@ -0,0 +1,53 @@
+package common //revive:disable:var-naming
+
+import "sort"
+
+const (
+	// mainLanguageMinShare is the minimum share of the code a language needs
+	// to count as one of the main languages of a repository.
+	mainLanguageMinShare = 0.1
+	mainLanguagesMax     = 5
+)
+
+// MainLanguages returns the languages that make up a significant part of a
+// repository, ordered by share. shares can be byte counts or percentages.
+func MainLanguages(shares map[string]float64) []string {
+	var total float64
+
+	languages := make([]string, 0, len(shares))
+
+	for language, share := range shares {
+		total += share
+
+		languages = append(languages, language)
+	}
+
+	if total <= 0 {
+		return nil
+	}
+
+	sort.Slice(languages, func(i, j int) bool {
+		if shares[languages[i]] == shares[languages[j]] {
+			return languages[i] < languages[j]
+		}
+
+		return shares[languages[i]] > shares[languages[j]]
+	})
+
+	main := make([]string, 0, mainLanguagesMax)
+
+	for i, language := range languages {
+		// Always keep the largest language, even if the code is very mixed.
+		if i > 0 && shares[language]/total < mainLanguageMinShare {
+			break
+		}
+
+		main = append(main, language)
+
+		if len(main) == mainLanguagesMax {
+			break
+		}
+	}
+
+	return main
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainLanguages(t *testing.T) {
+	assert.Equal(t, []string{"Go", "TypeScript"}, MainLanguages(map[string]float64{
+		"Go":         6000,
+		"TypeScript": 3500,
+		"Shell":      400,
+		"Dockerfile": 100,
+	}))
+	assert.Equal(t, []string{"Java"}, MainLanguages(map[string]float64{"Java": 5}))
+	assert.Nil(t, MainLanguages(nil))
+}
+
+func TestNormalizeSPDXID(t *testing.T) {
+	assert.Equal(t, "EUPL-1.2", NormalizeSPDXID("eupl-1.2"))
+	assert.Equal(t, "Apache-2.0", NormalizeSPDXID(" apache-2.0 "))
+	assert.Equal(t, "WTFPL", NormalizeSPDXID("WTFPL"))
+	assert.Empty(t, NormalizeSPDXID("NOASSERTION"))
+	assert.Empty(t, NormalizeSPDXID("other"))
+}
@@ -0,0 +1,52 @@
+package common //revive:disable:var-naming
+
+import "strings"
+
+// spdxLicenseIDs are the SPDX identifiers we recognise, in their canonical spelling.
+var spdxLicenseIDs = []string{
+	"AGPL-3.0",
+	"AGPL-3.0-only",
+	"AGPL-3.0-or-later",
+	"Apache-2.0",
+	"BSD-2-Clause",
+	"BSD-3-Clause",
+	"CC0-1.0",
+	"EUPL-1.1",
+	"EUPL-1.2",
+	"GPL-2.0",
+	"GPL-2.0-only",
+	"GPL-2.0-or-later",
+	"GPL-3.0",
+	"GPL-3.0-only",
+	"GPL-3.0-or-later",
+	"ISC",
+	"LGPL-2.1",
+	"LGPL-2.1-only",
+	"LGPL-2.1-or-later",
+	"LGPL-3.0",
+	"LGPL-3.0-only",
+	"LGPL-3.0-or-later",
+	"MIT",
+	"MPL-2.0",
+	"Unlicense",
+}
+
+// NormalizeSPDXID returns the canonical spelling of a SPDX license identifier,
+// e.g. "eupl-1.2" becomes "EUPL-1.2". Placeholders like "NOASSERTION" and
+// "other" return an empty string, unknown identifiers are returned as is.
+func NormalizeSPDXID(id string) string {
+	id = strings.TrimSpace(id)
+
+	switch strings.ToLower(id) {
+	case "", "noassertion", "none", "other":
+		return ""
+	}
+
+	for _, known := range spdxLicenseIDs {
+		if strings.EqualFold(known, id) {
+			return known
+		}
+	}
+
+	return id
+}
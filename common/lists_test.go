@@ -42,3 +42,29 @@ func TestReadPublishers(t *testing.T) {
 	assert.Len(t, result, 1)
 	assert.Nil(t, err)
 }
+
+func TestPublisherFor(t *testing.T) {
+	fake := FakeReadFiler{Str: `---
+- id: a
+  org: https://github.com/gemeente-a
+- id: b
+  org: https://gitlab.com/provincie-b
+  repos:
+    - https://github.com/gemeente-a/gedeeld.git
+`}
+	fileReaderInject = fake.ReadFile
+
+	publishers, err := LoadPublishers("/dev/null")
+	assert.NoError(t, err)
+
+	publisher, ok := PublisherFor(publishers, "https://github.com/Gemeente-A/zaken")
+	assert.True(t, ok)
+	assert.Equal(t, "a", publisher.ID)
+
+	publisher, ok = PublisherFor(publishers, "https://github.com/gemeente-a/gedeeld")
+	assert.True(t, ok)
+	assert.Equal(t, "b", publisher.ID)
+
+	_, ok = PublisherFor(publishers, "https://github.com/gemeente-ab/zaken")
+	assert.False(t, ok)
+}
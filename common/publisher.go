@@ -2,7 +2,9 @@ package common //revive:disable:var-naming
 
 import (
 	"fmt"
+	neturl "net/url"
 	"os"
+	"strings"
 
 	url "github.com/developer-overheid-nl/don-crawler/internal"
 	"gopkg.in/yaml.v2"
@@ -10,12 +12,21 @@ import (
 
 var fileReaderInject = os.ReadFile
 
+// LatestReleaseRef is the Publisher.PubliccodeRef value that reads publiccode.yml
+// from the latest release tag instead of the default branch.
+const LatestReleaseRef = "latest-release"
+
+// Publisher is an organisation whose repositories get crawled.
+// PubliccodeRef optionally sets where publiccode.yml is read from: LatestReleaseRef
+// or the name of a branch. The default branch is used when it's empty or when
+// the file isn't found there.
 type Publisher struct {
 	ID              string    `yaml:"id" json:"id"`
 	Name            string    `yaml:"name" json:"name"`
 	Organization    url.URL   `yaml:"org" json:"organization"`
 	Repositories    []url.URL `yaml:"repos" json:"repositories"`
 	OrganisationURL string    `yaml:"organisationUrl,omitempty" json:"organisationUrl,omitempty"`
+	PubliccodeRef   string    `yaml:"publiccodeRef,omitempty" json:"publiccodeRef,omitempty"`
 }
 
 // LoadPublishers loads the publishers YAML file and returns a slice of Publisher.
@@ -34,3 +45,35 @@ func LoadPublishers(path string) ([]Publisher, error) {
 
 	return publishers, nil
 }
+
+// PublisherFor returns the publisher that the repository at repoURL belongs
+// to: the one listing it in Repositories or whose Organization contains it.
+func PublisherFor(publishers []Publisher, repoURL string) (Publisher, bool) {
+	u, err := neturl.Parse(repoURL)
+	if err != nil {
+		return Publisher{}, false
+	}
+
+	repo := normalizePublisherURL(url.URL(*u))
+
+	for _, publisher := range publishers {
+		for _, u := range publisher.Repositories {
+			if normalizePublisherURL(u) == repo {
+				return publisher, true
+			}
+		}
+	}
+
+	for _, publisher := range publishers {
+		org := normalizePublisherURL(publisher.Organization)
+		if publisher.Organization.Host != "" && strings.HasPrefix(repo, org+"/") {
+			return publisher, true
+		}
+	}
+
+	return Publisher{}, false
+}
+
+func normalizePublisherURL(u url.URL) string {
+	return strings.ToLower(u.Host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git"))
+}
@@ -6,17 +6,37 @@ import (
 )
 
 // Repository is a single code repository. FileRawURL contains the direct url to the raw file.
+// ProviderID is the code hosting platform's stable ID, which survives renames and transfers.
+// For forks, UpstreamURL is the canonical URL of the parent repository and DivergedFromUpstream
+// tells whether the fork has commits of its own (nil when unknown).
+// Languages are ordered by share, License is a SPDX identifier.
+// PubliccodeRef is the branch or tag FileRawURL points to; Version is the release
+// tag when publiccode.yml was read from a release.
+// LastCommitAt is the date of the last commit on GitBranch if the scanner got it
+// along with the repository, zero otherwise. Likewise, Publiccode holds the
+// contents of the file at FileRawURL, or nil if it has to be downloaded; it isn't
+// kept in the crawl queue.
 type Repository struct {
-	Name         string
-	Title        string
-	Description  string
-	URL          url.URL
-	CanonicalURL url.URL
-	IsFork       bool
-	FileRawURL   string
-	GitBranch    string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	Publisher    Publisher
-	Headers      map[string]string
+	Name                 string
+	ProviderID           string
+	Title                string
+	Description          string
+	URL                  url.URL
+	CanonicalURL         url.URL
+	IsFork               bool
+	UpstreamURL          string
+	DivergedFromUpstream *bool
+	Languages            []string
+	License              string
+	Topics               []string
+	FileRawURL           string
+	PubliccodeRef        string
+	Version              string
+	GitBranch            string
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	LastCommitAt         time.Time
+	Publisher            Publisher
+	Headers              map[string]string
+	Publiccode           []byte `json:"-"`
 }
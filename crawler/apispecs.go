@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/alranel/go-vcsurl/v2"
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+)
+
+// registerAPISpecs finds the OpenAPI and AsyncAPI specifications in the clone
+// of the repository and registers them with the API register, linked to the
+// repository.
+func (c *Crawler) registerAPISpecs(
+	repository common.Repository, publiccode *publiccodeFile, logEntries *[]string,
+) {
+	specs, err := git.FindAPISpecs(repository, publiccodeSpecPaths(publiccode))
+	if err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] can't look for API specifications: %v", repository.Name, err))
+
+		return
+	}
+
+	found := make([]report.APISpec, 0, len(specs))
+
+	for _, spec := range specs {
+		oasURL := rawFileURL(repository, spec.Path)
+
+		found = append(found, report.APISpec{
+			Path:    spec.Path,
+			URL:     oasURL,
+			Type:    spec.Type,
+			Title:   spec.Title,
+			Version: spec.Version,
+		})
+
+		if oasURL == "" {
+			*logEntries = append(
+				*logEntries,
+				fmt.Sprintf("[%s] API specification %s has no public URL, not registering it", repository.Name, spec.Path),
+			)
+
+			continue
+		}
+
+		_, err := c.apiClient.PostAPI(apiclient.APIRequest{
+			OasURL:               oasURL,
+			SpecificationType:    spec.Type,
+			SpecificationVersion: spec.SpecVersion,
+			Title:                optionalString(spec.Title),
+			Version:              optionalString(spec.Version),
+			RepositoryURL:        repository.CanonicalURL.String(),
+			OrganisationURI:      orgURI(repository.Publisher),
+		})
+		if err != nil {
+			*logEntries = append(*logEntries, fmt.Sprintf("[%s] %s: %v", repository.Name, spec.Path, err))
+
+			continue
+		}
+
+		*logEntries = append(
+			*logEntries,
+			fmt.Sprintf("[%s] registered %s API %q (%s)", repository.Name, spec.Type, spec.Title, spec.Path),
+		)
+	}
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.APISpecs = found
+	})
+}
+
+// publiccodeSpecPaths returns the apiDocumentation entries of publiccode.yml
+// that are paths inside the repository.
+func publiccodeSpecPaths(file *publiccodeFile) []string {
+	if file == nil {
+		return nil
+	}
+
+	var paths []string
+
+	for _, desc := range file.Description {
+		ref, err := url.Parse(strings.TrimSpace(desc.APIDocumentation))
+		if err != nil || ref.Scheme != "" || ref.Host != "" || ref.Path == "" {
+			continue
+		}
+
+		paths = append(paths, ref.Path)
+	}
+
+	return paths
+}
+
+// rawFileURL returns the URL of the raw contents of filePath on the default
+// branch of the repository, or "" if the platform isn't known.
+func rawFileURL(repository common.Repository, filePath string) string {
+	if repository.GitBranch == "" {
+		return ""
+	}
+
+	u := repository.CanonicalURL
+	repoPath := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+
+	raw := url.URL{Scheme: u.Scheme, Host: u.Host}
+
+	switch {
+	case vcsurl.IsGitHub(&u):
+		raw.Host = "raw.githubusercontent.com"
+		raw.Path = path.Join("/", repoPath, repository.GitBranch, filePath)
+	case vcsurl.IsBitBucket(&u), vcsurl.IsGitLab(&u):
+		raw.Path = path.Join("/", repoPath, "raw", repository.GitBranch, filePath)
+	default:
+		return ""
+	}
+
+	return raw.String()
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawFileURL(t *testing.T) {
+	tests := []struct {
+		cloneURL string
+		want     string
+	}{
+		{
+			cloneURL: "https://github.com/example/zaken.git",
+			want:     "https://raw.githubusercontent.com/example/zaken/main/api/openapi.yaml",
+		},
+		{
+			cloneURL: "https://gitlab.com/group/sub/zaken.git",
+			want:     "https://gitlab.com/group/sub/zaken/raw/main/api/openapi.yaml",
+		},
+		{
+			cloneURL: "https://bitbucket.org/example/zaken.git",
+			want:     "https://bitbucket.org/example/zaken/raw/main/api/openapi.yaml",
+		},
+		{
+			cloneURL: "https://git.example.org/example/zaken.git",
+			want:     "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.cloneURL, func(t *testing.T) {
+			u, err := url.Parse(tc.cloneURL)
+			assert.NoError(t, err)
+
+			repository := common.Repository{CanonicalURL: *u, GitBranch: "main"}
+
+			assert.Equal(t, tc.want, rawFileURL(repository, "api/openapi.yaml"))
+		})
+	}
+}
+
+func TestPubliccodeSpecPaths(t *testing.T) {
+	file := &publiccodeFile{
+		Description: map[string]publiccodeDescription{
+			"nl": {APIDocumentation: "/docs/openapi.json"},
+			"en": {APIDocumentation: "https://example.org/docs"},
+		},
+	}
+
+	assert.Equal(t, []string{"/docs/openapi.json"}, publiccodeSpecPaths(file))
+	assert.Nil(t, publiccodeSpecPaths(nil))
+}
@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingUpdate is a repository update waiting for its batch to be sent.
+type pendingUpdate struct {
+	update repositoryUpdate
+	// sent is called with the outcome once the batch was sent.
+	sent func(error)
+}
+
+// updateBatcher collects repository updates from the repository workers and
+// sends them together once a batch is full. With a batch size of 1 every
+// update is sent right away by the worker that adds it.
+type updateBatcher struct {
+	mu      sync.Mutex
+	pending []pendingUpdate
+	size    int
+	// sendAll sends a batch and returns the error of every update, see
+	// registerSync.send.
+	sendAll func([]repositoryUpdate) []error
+	// delivering tracks the sent callbacks that are still running.
+	delivering sync.WaitGroup
+}
+
+func newUpdateBatcher(size int, sendAll func([]repositoryUpdate) []error) *updateBatcher {
+	return &updateBatcher{size: size, sendAll: sendAll}
+}
+
+// add queues the update and sends the batch if it's full.
+func (b *updateBatcher) add(p pendingUpdate) {
+	var batch []pendingUpdate
+
+	b.mu.Lock()
+
+	b.pending = append(b.pending, p)
+	if len(b.pending) >= b.size {
+		batch, b.pending = b.pending, nil
+	}
+
+	b.mu.Unlock()
+
+	b.send(batch)
+}
+
+// flush sends the updates that are still waiting, and waits until the sent
+// callbacks of every batch returned.
+func (b *updateBatcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	b.send(batch)
+	b.delivering.Wait()
+}
+
+// send sends the batch and hands every result to the sent callback of its
+// update, each in a goroutine of its own: the worker that filled the batch
+// doesn't finish the other repositories, and one callback panicking doesn't
+// keep the others from being called.
+func (b *updateBatcher) send(batch []pendingUpdate) {
+	if len(batch) == 0 {
+		return
+	}
+
+	updates := make([]repositoryUpdate, len(batch))
+	for i, p := range batch {
+		updates[i] = p.update
+	}
+
+	errs := b.sendRecovering(updates)
+
+	b.delivering.Add(len(batch))
+
+	for i, p := range batch {
+		go b.deliver(p, errs[i])
+	}
+}
+
+// sendRecovering sends updates, failing all of them if sendAll panics.
+func (b *updateBatcher) sendRecovering(updates []repositoryUpdate) []error {
+	errs := make([]error, len(updates))
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("panic sending %d repository updates: %v", len(updates), r)
+
+				for i := range errs {
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+			}
+		}()
+
+		copy(errs, b.sendAll(updates))
+	}()
+
+	return errs
+}
+
+func (b *updateBatcher) deliver(p pendingUpdate, err error) {
+	defer b.delivering.Done()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("[%s] panic after sending the update: %v", p.update.request.URL, r)
+		}
+	}()
+
+	p.sent(err)
+}
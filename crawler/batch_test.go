@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostBatcherDeliversEveryResult(t *testing.T) {
+	rejected := errors.New("422 Unprocessable Entity")
+
+	b := newUpdateBatcher(2, func(updates []repositoryUpdate) []error {
+		errs := make([]error, len(updates))
+
+		for i, update := range updates {
+			if update.request.URL == "b" {
+				errs[i] = rejected
+			}
+		}
+
+		return errs
+	})
+
+	var (
+		mu  sync.Mutex
+		got = make(map[string]error)
+	)
+
+	record := func(url string) pendingUpdate {
+		return pendingUpdate{update: repositoryUpdate{request: apiclient.RepositoryRequest{URL: url}}, sent: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			got[url] = err
+		}}
+	}
+
+	// A panicking callback doesn't keep the rest of its batch from being called.
+	b.add(pendingUpdate{
+		update: repositoryUpdate{request: apiclient.RepositoryRequest{URL: "a"}},
+		sent:   func(error) { panic("boom") },
+	})
+	b.add(record("b"))
+	b.add(record("c"))
+	b.flush()
+
+	assert.Equal(t, map[string]error{"b": rejected, "c": nil}, got)
+}
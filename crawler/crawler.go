@@ -17,6 +17,12 @@ import (
 	"github.com/developer-overheid-nl/don-crawler/apiclient"
 	"github.com/developer-overheid-nl/don-crawler/common"
 	"github.com/developer-overheid-nl/don-crawler/git"
+	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/developer-overheid-nl/don-crawler/internal/httpcache"
+	"github.com/developer-overheid-nl/don-crawler/internal/queue"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/developer-overheid-nl/don-crawler/osv"
 	"github.com/developer-overheid-nl/don-crawler/scanner"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -32,15 +38,50 @@ const (
 	repositoryChannelSize           = 100
 )
 
-var publiccodeHTTPClient = &http.Client{Timeout: publiccodeRequestTimeout}
+// publiccodeHTTPClient downloads publiccode.yml files through the HTTP cache.
+// Other URLs, like the ones publiccode.yml links to, bypass the cache.
+var publiccodeHTTPClient = httpcache.NewClient(publiccodeRequestTimeout)
+
+// statusHTTPClient checks URLs without the HTTP cache.
+var statusHTTPClient = &http.Client{Timeout: publiccodeRequestTimeout}
 
 // Crawler is a helper class representing a crawler.
 type Crawler struct {
 	DryRun bool
+	// Partial marks a crawl of some publishers or repositories only. It doesn't
+	// count as a run for the clone cache and its report doesn't replace the
+	// latest one.
+	Partial bool
 
 	Index        string
 	repositories chan common.Repository
 	repoLocks    repoLockMap
+	cloneCache   *git.CloneCache
+	// repositoryIDs tracks repositories by provider ID to detect renames.
+	repositoryIDs *repositoryIDs
+	// report collects the per-repository findings of the current run.
+	report *report.Report
+	// secrets holds the leaked credentials found, see SECRET_SCAN.
+	secrets *secretStore
+	// proposals holds the publiccode.yml pull and merge requests opened.
+	proposals *proposalStore
+	// queue tracks the publishers and repositories of the crawl on disk, so an
+	// interrupted crawl can be resumed. It's nil for dry runs and partial crawls.
+	queue *queue.Queue
+	// deadLetters holds the publishers and repositories that failed
+	// CRAWL_MAX_ATTEMPTS times.
+	deadLetters *deadLetterStore
+	// outbox holds the repository updates the register didn't accept.
+	outbox *outboxStore
+	// batcher sends repository updates to the API in batches.
+	batcher *updateBatcher
+	// sentFields holds what was last sent to the register per repository.
+	sentFields *sentFieldsStore
+	// register compares repository updates with the register and sends them.
+	register *registerSync
+	// osv is loaded from OSV_DIR on first use.
+	osv     *osv.Database
+	osvOnce sync.Once
 	// Sync mutex guard.
 	publishersWg   sync.WaitGroup
 	repositoriesWg sync.WaitGroup
@@ -79,27 +120,97 @@ func (r *repoLockMap) lock(key string) func() {
 	return lock.Unlock
 }
 
-// NewCrawler initializes a new Crawler object and connects to Elasticsearch (if dryRun == false).
-func NewCrawler(dryRun bool) *Crawler {
+// NewCrawler initializes a new Crawler object, loading the state of earlier
+// crawls from DATADIR.
+func NewCrawler(dryRun bool) (*Crawler, error) {
 	var c Crawler
 
 	c.DryRun = dryRun
 
 	datadir := viper.GetString("DATADIR")
 	if err := os.MkdirAll(datadir, 0o744); err != nil {
-		log.Fatalf("can't create data directory (%s): %s", datadir, err.Error())
+		return nil, fmt.Errorf("can't create data directory (%s): %w", datadir, err)
 	}
 
 	// Initiate a channel of repositories.
 	c.repositories = make(chan common.Repository, repositoryChannelSize)
 
+	apiClient, err := apiclient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	c.apiClient = apiClient
+
+	if err := c.loadState(); err != nil {
+		return nil, err
+	}
+
+	c.report = report.New()
+
 	c.gitHubScanner = scanner.NewGitHubScanner()
 	c.gitLabScanner = scanner.NewGitLabScanner()
 	c.bitBucketScanner = scanner.NewBitBucketScanner()
 
-	c.apiClient = apiclient.NewClient()
+	return &c, nil
+}
+
+// loadState loads the state of earlier crawls from DATADIR. lockDataDir loads
+// it again once it holds the lock, so a crawl that waited for another one
+// doesn't save the state from before that crawl over its results.
+func (c *Crawler) loadState() error {
+	cloneCache, err := git.OpenCloneCache()
+	if err != nil {
+		return fmt.Errorf("can't open clone cache: %w", err)
+	}
+
+	c.cloneCache = cloneCache
+
+	repositoryIDs, err := loadRepositoryIDs()
+	if err != nil {
+		return fmt.Errorf("can't load repository IDs: %w", err)
+	}
 
-	return &c
+	c.repositoryIDs = repositoryIDs
+
+	secretStore, err := loadSecretStore()
+	if err != nil {
+		return fmt.Errorf("can't load secret findings: %w", err)
+	}
+
+	c.secrets = secretStore
+
+	proposalStore, err := loadProposalStore()
+	if err != nil {
+		return fmt.Errorf("can't load proposals: %w", err)
+	}
+
+	c.proposals = proposalStore
+
+	deadLetters, err := loadDeadLetterStore()
+	if err != nil {
+		return fmt.Errorf("can't load dead-letter list: %w", err)
+	}
+
+	c.deadLetters = deadLetters
+
+	outbox, err := loadOutboxStore()
+	if err != nil {
+		return fmt.Errorf("can't load outbox: %w", err)
+	}
+
+	c.outbox = outbox
+
+	sentFields, err := loadSentFieldsStore()
+	if err != nil {
+		return fmt.Errorf("can't load sent fields: %w", err)
+	}
+
+	c.sentFields = sentFields
+	c.register = &registerSync{client: c.apiClient, sentFields: c.sentFields}
+	c.batcher = newUpdateBatcher(c.apiClient.BatchSize(), c.register.send)
+
+	return nil
 }
 
 // CrawlSoftwareByAPIURL crawls a single software.
@@ -152,6 +263,27 @@ func (c *Crawler) CrawlSoftwareByID(_ string, _ common.Publisher) error {
 	return nil
 }
 
+// CrawlRepository crawls the single repository at repoURL of publisher.
+func (c *Crawler) CrawlRepository(repoURL string, publisher common.Publisher) error {
+	unlock, err := c.lockDataDir()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	repository, err := c.scanRepository(repoURL, publisher)
+	if err != nil {
+		return err
+	}
+
+	c.Partial = true
+	c.repositories <- repository
+	close(c.repositories)
+
+	return c.crawl()
+}
+
 // CrawlPublishers processes a list of publishers.
 func (c *Crawler) CrawlPublishers(publishers []common.Publisher) error {
 	reposNum := 0
@@ -161,6 +293,98 @@ func (c *Crawler) CrawlPublishers(publishers []common.Publisher) error {
 
 	log.Infof("Scanning %d publishers (%d repositories)", len(publishers), reposNum)
 
+	if err := checkGitHubAuth(publishers, nil); err != nil {
+		return err
+	}
+
+	unlock, err := c.lockDataDir()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if !c.DryRun && !c.Partial {
+		if err := c.startQueue(publishers); err != nil {
+			return err
+		}
+	}
+
+	return c.crawlPublishers(publishers, nil)
+}
+
+// lockDataDir takes the DATADIR lock for the crawl, see state.Lock, and
+// reloads the state under it. Dry runs leave DATADIR alone and don't take it.
+func (c *Crawler) lockDataDir() (func(), error) {
+	if c.DryRun {
+		return func() {}, nil
+	}
+
+	unlock, err := state.Lock()
+	if err != nil {
+		return nil, fmt.Errorf("can't crawl: %w", err)
+	}
+
+	if err := c.loadState(); err != nil {
+		unlock()
+
+		return nil, err
+	}
+
+	return unlock, nil
+}
+
+// checkGitHubAuth makes sure the GitHub credentials are usable if any of the
+// publishers or repositories is on GitHub. Without any, GitHub is crawled
+// anonymously.
+func checkGitHubAuth(publishers []common.Publisher, repositories []common.Repository) error {
+	onGitHub := false
+
+	for _, publisher := range publishers {
+		orgURL := (url.URL)(publisher.Organization)
+		onGitHub = onGitHub || vcsurl.IsGitHub(&orgURL)
+
+		for _, u := range publisher.Repositories {
+			repoURL := (url.URL)(u)
+			onGitHub = onGitHub || vcsurl.IsGitHub(&repoURL)
+		}
+	}
+
+	for _, repository := range repositories {
+		onGitHub = onGitHub || vcsurl.IsGitHub(&repository.CanonicalURL)
+	}
+
+	if !onGitHub {
+		return nil
+	}
+
+	auth, err := githubapp.DefaultAuth()
+	if err != nil {
+		return fmt.Errorf("can't crawl GitHub: %w", err)
+	}
+
+	if auth.Anonymous() {
+		log.Warnf("GitHub API auth: %s, set GIT_OAUTH_CLIENTID/GIT_OAUTH_SECRET or GITHUB_TOKEN for more", auth)
+	} else {
+		log.Infof("GitHub API auth: %s", auth)
+	}
+
+	return nil
+}
+
+// crawlPublishers scans publishers and processes their repositories, along
+// with repositories that were found already.
+func (c *Crawler) crawlPublishers(publishers []common.Publisher, repositories []common.Repository) error {
+	c.publishersWg.Add(1)
+
+	go func() {
+		defer c.publishersWg.Done()
+
+		for _, repository := range repositories {
+			c.repositories <- repository
+		}
+	}()
+
 	publisherJobs := make(chan common.Publisher)
 
 	for i := range publisherWorkerCount {
@@ -172,7 +396,7 @@ func (c *Crawler) CrawlPublishers(publishers []common.Publisher) error {
 			log.Debugf("Starting ScanPublisher() goroutine (#%d)", id)
 
 			for publisher := range publisherJobs {
-				c.ScanPublisher(publisher)
+				c.scanQueuedPublisher(publisher)
 			}
 		}(i)
 	}
@@ -195,21 +419,28 @@ func (c *Crawler) CrawlPublishers(publishers []common.Publisher) error {
 }
 
 // ScanPublisher scans all the publisher' repositories and sends any repository
-// with a publiccode.yml to the repositories channel.
-func (c *Crawler) ScanPublisher(publisher common.Publisher) {
+// with a publiccode.yml to the repositories channel. It returns the errors of
+// the scans that failed; a missing publiccode.yml is only logged.
+func (c *Crawler) ScanPublisher(publisher common.Publisher) error {
 	log.Infof("Processing publisher: %s", publisher.Name)
 
-	var err error
+	var (
+		err    error
+		failed []error
+	)
 
 	orgURL := (url.URL)(publisher.Organization)
 
+	repositories, flush := c.repositoryOutput()
+	defer flush()
+
 	switch {
 	case vcsurl.IsGitHub(&orgURL):
-		err = c.gitHubScanner.ScanGroupOfRepos(orgURL, publisher, c.repositories)
+		err = c.gitHubScanner.ScanGroupOfRepos(orgURL, publisher, repositories)
 	case vcsurl.IsBitBucket(&orgURL):
-		err = c.bitBucketScanner.ScanGroupOfRepos(orgURL, publisher, c.repositories)
+		err = c.bitBucketScanner.ScanGroupOfRepos(orgURL, publisher, repositories)
 	case vcsurl.IsGitLab(&orgURL):
-		err = c.gitLabScanner.ScanGroupOfRepos(orgURL, publisher, c.repositories)
+		err = c.gitLabScanner.ScanGroupOfRepos(orgURL, publisher, repositories)
 	default:
 		err = fmt.Errorf(
 			"publisher %s: unsupported code hosting platform for %s",
@@ -223,6 +454,8 @@ func (c *Crawler) ScanPublisher(publisher common.Publisher) {
 			log.Warnf("[%s] %s", orgURL.String(), err.Error())
 		} else {
 			log.Error(err)
+
+			failed = append(failed, err)
 		}
 	}
 
@@ -231,11 +464,11 @@ func (c *Crawler) ScanPublisher(publisher common.Publisher) {
 
 		switch {
 		case vcsurl.IsGitHub(&repoURL):
-			err = c.gitHubScanner.ScanRepo(repoURL, publisher, c.repositories)
+			err = c.gitHubScanner.ScanRepo(repoURL, publisher, repositories)
 		case vcsurl.IsBitBucket(&repoURL):
-			err = c.bitBucketScanner.ScanRepo(repoURL, publisher, c.repositories)
+			err = c.bitBucketScanner.ScanRepo(repoURL, publisher, repositories)
 		case vcsurl.IsGitLab(&repoURL):
-			err = c.gitLabScanner.ScanRepo(repoURL, publisher, c.repositories)
+			err = c.gitLabScanner.ScanRepo(repoURL, publisher, repositories)
 		default:
 			err = fmt.Errorf(
 				"publisher %s: unsupported code hosting platform for %s",
@@ -249,9 +482,13 @@ func (c *Crawler) ScanPublisher(publisher common.Publisher) {
 				log.Warnf("[%s] %s", repoURL.String(), err.Error())
 			} else {
 				log.Error(err)
+
+				failed = append(failed, err)
 			}
 		}
 	}
+
+	return errors.Join(failed...)
 }
 
 // ProcessRepositories process the repositories channel, check the repo's publiccode.yml
@@ -260,16 +497,15 @@ func (c *Crawler) ProcessRepositories(repos chan common.Repository) {
 	defer c.repositoriesWg.Done()
 
 	for repository := range repos {
-		c.ProcessRepo(repository)
+		c.processQueuedRepo(repository)
 	}
 }
 
 // ProcessRepo looks for a publiccode.yml file in a repository, and if found it records the link.
-func (c *Crawler) ProcessRepo(repository common.Repository) {
-	var (
-		logEntries []string
-		err        error
-	)
+// done is called once the repository was processed and its update sent to the API, with the
+// error, if any. As updates are sent in batches, that may happen after ProcessRepo returns.
+func (c *Crawler) ProcessRepo(repository common.Repository, done func(error)) {
+	var logEntries []string
 
 	defer func() {
 		for _, e := range logEntries {
@@ -277,22 +513,34 @@ func (c *Crawler) ProcessRepo(repository common.Repository) {
 		}
 	}()
 
-	c.ensurePubliccodeFile(context.Background(), &repository, &logEntries)
+	publiccode := c.ensurePubliccodeFile(context.Background(), &repository, &logEntries)
 	hasPubliccode := repository.FileRawURL != ""
 
 	if c.DryRun {
 		log.Infof("[%s]: Skipping other steps (--dry-run)", repository.Name)
+		done(nil)
 
 		return
 	}
 
+	previousURL := c.handleRename(repository, &logEntries)
+
+	score := scorePubliccode(publiccode)
+	c.report.Update(repository, func(r *report.Repository) {
+		r.Score = &score
+	})
+
+	if publiccode != nil && viper.GetBool("LINK_CHECK") {
+		c.checkLinks(context.Background(), repository, publiccode, &logEntries)
+	}
+
 	cloneURL := repository.CanonicalURL.String()
 
 	cloneErr := c.cloneAndLogActivity(repository, cloneURL, &logEntries)
 
 	if !hasPubliccode {
 		if repository.Description == "" && cloneErr == nil {
-			readmeContents, readmeErr := git.ReadReadme(repository)
+			readmeName, readmeContents, readmeErr := git.ReadReadme(repository)
 			if readmeErr != nil {
 				if !errors.Is(readmeErr, git.ErrReadmeNotFound) {
 					logEntries = append(
@@ -301,7 +549,7 @@ func (c *Crawler) ProcessRepo(repository common.Repository) {
 					)
 				}
 			} else {
-				repository.Description = descriptionFromReadme(readmeContents)
+				repository.Description = descriptionFromReadme(readmeName, readmeContents)
 			}
 		}
 
@@ -310,6 +558,22 @@ func (c *Crawler) ProcessRepo(repository common.Repository) {
 		}
 	}
 
+	if repository.License == "" && cloneErr == nil {
+		license, licenseErr := git.DetectLicense(repository)
+		if licenseErr == nil {
+			repository.License = license
+		} else if !errors.Is(licenseErr, git.ErrLicenseNotFound) {
+			logEntries = append(
+				logEntries,
+				fmt.Sprintf("[%s] failed to detect license: %v", repository.Name, licenseErr),
+			)
+		}
+	}
+
+	if !hasPubliccode && cloneErr == nil && viper.GetBool("SUGGEST_PUBLICCODE") {
+		c.writeSuggestion(repository, &logEntries)
+	}
+
 	publiccodeURL := repositoryPubliccodeURL(repository)
 
 	var repoTitle, repoDesc *string
@@ -330,26 +594,100 @@ func (c *Crawler) ProcessRepo(repository common.Repository) {
 
 	lastActivity := c.lastActivityFromGit(repository, cloneErr, &logEntries)
 
-	if _, err = c.apiClient.PostRepository(
-		repository.CanonicalURL.String(),
-		repoTitle,
-		repoDesc,
-		publiccodeURL,
-		&repository.IsFork,
-		orgURI(repository.Publisher),
-		repository.CreatedAt,
-		time.Now(),
-		lastActivity,
-	); err != nil {
-		logEntries = append(logEntries, fmt.Sprintf("[%s]: %s", repository.Name, err.Error()))
-		log.Errorf("[%s] PostRepository failed: %v", repository.Name, err)
+	request := apiclient.RepositoryRequest{
+		URL:                  repository.CanonicalURL.String(),
+		PreviousURL:          previousURL,
+		Name:                 repoTitle,
+		ShortDescription:     repoDesc,
+		PublicCodeURL:        publiccodeURL,
+		PublicCodeRef:        optionalString(repository.PubliccodeRef),
+		Version:              optionalString(repository.Version),
+		IsFork:               &repository.IsFork,
+		UpstreamURL:          optionalString(repository.UpstreamURL),
+		DivergedFromUpstream: repository.DivergedFromUpstream,
+		Languages:            repository.Languages,
+		License:              optionalString(repository.License),
+		Topics:               repository.Topics,
+		OrganisationURI:      orgURI(repository.Publisher),
+		CreatedAt:            repository.CreatedAt,
+		LastCrawledAt:        time.Now(),
+		LastActivityAt:       lastActivity,
+	}
+
+	// The repository is done once its update was sent and its clone processed.
+	finish := doneAfter(2, done)
+
+	c.sendRepository(repository.Name, request, func(update repositoryUpdate, err error) {
+		defer recoverPanic(repository.Name, finish)
+
+		finish(c.afterSend(repository, update, err))
+	})
+
+	// The update may wait for its batch; the clone is processed meanwhile.
+	c.processClone(repository, publiccode, cloneErr, &logEntries)
+	finish(nil)
+}
+
+// afterSend records the outcome of sending the repository update to the API,
+// sendErr. An update the API didn't accept goes to the outbox, which retries
+// it; afterSend only returns an error if it can't be stored there.
+func (c *Crawler) afterSend(repository common.Repository, update repositoryUpdate, sendErr error) error {
+	if sendErr != nil {
+		log.Errorf("[%s] sending the update failed, keeping it in the outbox: %v", repository.Name, sendErr)
+
+		if err := c.outbox.add(update, sendErr); err != nil {
+			return fmt.Errorf("can't send repository update (%w) nor keep it in the outbox: %w", sendErr, err)
+		}
+
+		return nil
+	}
+
+	if err := c.outbox.remove(update.request.URL); err != nil {
+		log.Error(err)
+	}
+
+	c.repositoryIDs.record(repository)
+
+	return nil
+}
+
+// processClone registers the API specifications, scans for secrets and handles
+// the dependencies of the repository, as far as enabled. It doesn't depend on
+// the repository update being sent.
+func (c *Crawler) processClone(
+	repository common.Repository, publiccode *publiccodeFile, cloneErr error, logEntries *[]string,
+) {
+	if cloneErr != nil {
+		return
+	}
+
+	if viper.GetBool("API_SPEC_DISCOVERY") {
+		c.registerAPISpecs(repository, publiccode, logEntries)
+	}
+
+	if viper.GetBool("SECRET_SCAN") {
+		c.scanSecrets(repository, logEntries)
+	}
+
+	if viper.GetBool("SBOM_GENERATION") || viper.GetString("OSV_DIR") != "" {
+		c.processDependencies(repository, logEntries)
 	}
 }
 
 func publiccodeGetStatus(ctx context.Context, resourceURL string, headers map[string]string) (int, http.Header, error) {
+	statusCode, responseHeaders, _, err := publiccodeGet(ctx, statusHTTPClient, resourceURL, headers, 0)
+
+	return statusCode, responseHeaders, err
+}
+
+// publiccodeGet GETs resourceURL with client and returns at most limit bytes
+// of the body.
+func publiccodeGet(
+	ctx context.Context, client *http.Client, resourceURL string, headers map[string]string, limit int64,
+) (int, http.Header, []byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, nil)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, nil, err
 	}
 
 	for k, v := range headers {
@@ -360,16 +698,25 @@ func publiccodeGetStatus(ctx context.Context, resourceURL string, headers map[st
 		req.Header.Set(k, v)
 	}
 
-	resp, err := publiccodeHTTPClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
 
+	var body []byte
+
+	if limit > 0 {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, limit))
+		if err != nil {
+			return resp.StatusCode, resp.Header, nil, err
+		}
+	}
+
 	// Drain body so the underlying transport can reuse the TCP connection.
 	_, _ = io.Copy(io.Discard, resp.Body)
 
-	return resp.StatusCode, resp.Header, nil
+	return resp.StatusCode, resp.Header, body, nil
 }
 
 func rateLimitWaitFromHeaders(headers http.Header) time.Duration {
@@ -412,49 +759,76 @@ func isRateLimitedStatus(statusCode int, headers http.Header) bool {
 }
 
 func publiccodeGetStatusWithRetry(ctx context.Context, resourceURL string, headers map[string]string) (int, error) {
+	statusCode, _, _, err := publiccodeGetWithRetry(ctx, statusHTTPClient, resourceURL, headers, 0)
+
+	return statusCode, err
+}
+
+// publiccodeGetWithRetry is publiccodeGet, waiting and retrying while the
+// server reports a rate limit.
+func publiccodeGetWithRetry(
+	ctx context.Context, client *http.Client, resourceURL string, headers map[string]string, limit int64,
+) (int, http.Header, []byte, error) {
 	for attempts := 0; ; attempts++ {
 		if ctx.Err() != nil {
-			return 0, ctx.Err()
+			return 0, nil, nil, ctx.Err()
 		}
 
-		statusCode, responseHeaders, err := publiccodeGetStatus(ctx, resourceURL, headers)
+		statusCode, responseHeaders, body, err := publiccodeGet(ctx, client, resourceURL, headers, limit)
 		if err != nil {
-			return 0, err
+			return 0, nil, nil, err
 		}
 
 		if !isRateLimitedStatus(statusCode, responseHeaders) {
-			return statusCode, nil
+			return statusCode, responseHeaders, body, nil
 		}
 
 		if attempts >= publiccodeRateLimitMaxRetries {
-			return statusCode, fmt.Errorf("publiccode.yml request remained rate limited after %d attempts", attempts+1)
+			return statusCode, responseHeaders, nil, fmt.Errorf(
+				"request to %s remained rate limited after %d attempts", resourceURL, attempts+1,
+			)
 		}
 
 		wait := rateLimitWaitFromHeaders(responseHeaders)
 		log.Infof(
-			"publiccode.yml request rate limited (status: %d); waiting %s before retry",
+			"request to %s rate limited (status: %d); waiting %s before retry",
+			resourceURL,
 			statusCode,
 			wait.Round(time.Second),
 		)
 
 		select {
 		case <-ctx.Done():
-			return statusCode, ctx.Err()
+			return statusCode, responseHeaders, nil, ctx.Err()
 		case <-time.After(wait):
 			// Continue to next retry.
 		}
 	}
 }
 
-func (c *Crawler) ensurePubliccodeFile(ctx context.Context, repository *common.Repository, logEntries *[]string) {
+// ensurePubliccodeFile checks that the repository's publiccode.yml can be
+// downloaded and returns it parsed. If it can't be downloaded, FileRawURL is
+// cleared; if it can't be parsed, nil is returned.
+func (c *Crawler) ensurePubliccodeFile(
+	ctx context.Context, repository *common.Repository, logEntries *[]string,
+) *publiccodeFile {
 	if repository.FileRawURL == "" {
 		*logEntries = append(*logEntries, fmt.Sprintf("[%s] publiccode.yml not found", repository.Name))
 		log.Warnf("[%s] publiccode.yml missing, will proceed without it", repository.Name)
 
-		return
+		return nil
 	}
 
-	statusCode, err := publiccodeGetStatusWithRetry(ctx, repository.FileRawURL, repository.Headers)
+	// The scanner may have got the file along with the repository.
+	statusCode, body := http.StatusOK, repository.Publiccode
+
+	var err error
+
+	if body == nil || len(body) > publiccodeMaxSize {
+		statusCode, _, body, err = publiccodeGetWithRetry(
+			ctx, publiccodeHTTPClient, repository.FileRawURL, repository.Headers, publiccodeMaxSize,
+		)
+	}
 
 	if statusCode == http.StatusOK && err == nil {
 		*logEntries = append(
@@ -466,7 +840,14 @@ func (c *Crawler) ensurePubliccodeFile(ctx context.Context, repository *common.R
 			),
 		)
 
-		return
+		file, err := parsePubliccode(body)
+		if err != nil {
+			*logEntries = append(*logEntries, fmt.Sprintf("[%s] %v", repository.Name, err))
+
+			return nil
+		}
+
+		return file
 	}
 
 	if err != nil {
@@ -479,6 +860,11 @@ func (c *Crawler) ensurePubliccodeFile(ctx context.Context, repository *common.R
 	)
 	log.Warnf("[%s] publiccode.yml not reachable (status: %d), continuing without it", repository.Name, statusCode)
 	repository.FileRawURL = ""
+	repository.PubliccodeRef = ""
+	repository.Version = ""
+	repository.Publiccode = nil
+
+	return nil
 }
 
 func titleFromRepositoryName(repository common.Repository) string {
@@ -492,6 +878,10 @@ func titleFromRepositoryName(repository common.Repository) string {
 func (c *Crawler) lastActivityFromAPI(repository common.Repository) (time.Time, bool) {
 	lastActivity := repository.UpdatedAt
 
+	if !repository.LastCommitAt.IsZero() {
+		return repository.LastCommitAt, true
+	}
+
 	var apiLastActivity time.Time
 
 	var apiErr error
@@ -523,6 +913,23 @@ func (c *Crawler) lastActivityFromAPI(repository common.Repository) (time.Time,
 	return lastActivity, false
 }
 
+// cloneRepository clones or updates the bare clone of the repository in
+// DATADIR/repos.
+func (c *Crawler) cloneRepository(repository common.Repository) error {
+	unlock := c.repoLocks.lock(repoLockKey(repository))
+	defer unlock()
+
+	if err := git.CloneRepository(
+		repository.URL.Host, repository.Name, repository.CanonicalURL.String(), c.Index,
+	); err != nil {
+		return err
+	}
+
+	c.cloneCache.Touch(repository.URL.Host, repository.Name)
+
+	return nil
+}
+
 func (c *Crawler) cloneAndLogActivity(
 	repository common.Repository,
 	cloneURL string,
@@ -535,13 +942,7 @@ func (c *Crawler) cloneAndLogActivity(
 		return errors.New("clone URL empty")
 	}
 
-	unlock := c.repoLocks.lock(repoLockKey(repository))
-
-	err := git.CloneRepository(repository.URL.Host, repository.Name, cloneURL, c.Index)
-
-	unlock()
-
-	if err != nil {
+	if err := c.cloneRepository(repository); err != nil {
 		*logEntries = append(*logEntries, fmt.Sprintf("[%s] error while cloning: %v\n", repository.Name, err))
 	}
 
@@ -618,6 +1019,12 @@ func repoPostDetails(repository common.Repository) (*string, *string) {
 }
 
 func repoLockKey(repository common.Repository) string {
+	// The provider ID survives renames, so the old and the new location of a
+	// renamed repository share the same lock.
+	if repository.ProviderID != "" {
+		return repository.URL.Host + "#" + repository.ProviderID
+	}
+
 	if repository.Name == "" {
 		return repository.URL.Host
 	}
@@ -646,6 +1053,28 @@ func (c *Crawler) crawl() error {
 
 	log.Debugf("Repository workers: %d", repositoryWorkerCount)
 
+	if !c.Partial {
+		c.cloneCache.StartRun()
+	}
+
+	c.report = report.New()
+	c.report.Partial = c.Partial
+
+	cacheRequests, cacheNotModified := httpcache.Stats()
+
+	if !c.DryRun && !c.Partial {
+		// A full crawl compares every repository with the register, so it's
+		// listed once rather than asked about each repository.
+		if err := c.register.loadSnapshot(); err != nil {
+			log.Warnf("%v, looking up repositories one by one", err)
+		}
+	}
+
+	if !c.DryRun {
+		// Send what failed in earlier runs now, not only after this crawl.
+		c.flushOutbox(1)
+	}
+
 	// Process the repositories in order to retrieve the files.
 	for i := range repositoryWorkerCount {
 		c.repositoriesWg.Add(1)
@@ -662,55 +1091,109 @@ func (c *Crawler) crawl() error {
 
 	close(reposChan)
 	c.repositoriesWg.Wait()
+	c.batcher.flush()
+	c.closeQueue()
 
-	log.Info("Crawler run completed")
+	if !c.DryRun {
+		rounds := outboxRounds
+		if c.Partial {
+			rounds = 1
+		}
 
-	return nil
-}
+		c.flushOutbox(rounds)
+		c.report.Outbox = c.outbox.reportEntries()
 
-func descriptionFromReadme(contents string) string {
-	contents = strings.ReplaceAll(contents, "\r\n", "\n")
-	lines := strings.Split(contents, "\n")
+		c.finishCloneCache()
 
-	paragraph := make([]string, len(lines))
+		if !c.Partial {
+			pruneHTTPCache()
+		}
 
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
+		if err := c.repositoryIDs.save(); err != nil {
+			log.Errorf("can't save repository IDs: %v", err)
+		}
 
-		if trimmed == "" {
-			if len(paragraph) > 0 {
-				break
-			}
+		if err := c.sentFields.save(); err != nil {
+			log.Errorf("can't save sent fields: %v", err)
+		}
 
-			continue
+		if err := c.secrets.save(); err != nil {
+			log.Errorf("can't save secret findings: %v", err)
 		}
 
-		if len(paragraph) == 0 && isReadmeSkippableLine(trimmed) {
-			continue
+		if path, err := c.report.Save(); err != nil {
+			log.Error(err)
+		} else {
+			log.Infof("Crawl report written to %s", path)
 		}
+	}
+
+	if requests, notModified := httpcache.Stats(); requests > cacheRequests {
+		log.Infof("HTTP cache: %d of %d requests not modified", notModified-cacheNotModified, requests-cacheRequests)
+	}
+
+	log.Info("Crawler run completed")
+
+	return nil
+}
 
-		paragraph[i] = trimmed
+// pruneHTTPCache keeps the HTTP cache within HTTP_CACHE_MAX_AGE_DAYS and
+// HTTP_CACHE_MAX_SIZE, see httpcache.Prune.
+func pruneHTTPCache() {
+	policy, err := httpcache.PolicyFromEnv()
+	if err != nil {
+		log.Error(err)
+
+		return
 	}
 
-	return strings.Join(paragraph, " ")
+	result, err := httpcache.Prune(policy, false)
+	if err != nil {
+		log.Errorf("HTTP cache prune failed: %v", err)
+	}
+
+	if result.Removed > 0 {
+		log.Infof("HTTP cache prune removed %d responses, reclaimed %s (%s remaining)",
+			result.Removed, git.FormatByteSize(result.Reclaimed), git.FormatByteSize(result.Remaining))
+	}
 }
 
-func isReadmeSkippableLine(line string) bool {
-	lower := strings.ToLower(line)
+// finishCloneCache persists the clone cache index and, if CACHE_GC_AFTER_CRAWL
+// is set, garbage collects clones according to the configured policy. Partial
+// crawls don't see every clone, so they never garbage collect.
+func (c *Crawler) finishCloneCache() {
+	if err := c.cloneCache.Save(); err != nil {
+		log.Errorf("can't save clone cache: %v", err)
 
-	if strings.HasPrefix(line, "#") {
-		return true
+		return
 	}
 
-	if strings.HasPrefix(lower, "<img") || strings.HasPrefix(lower, "<a") {
-		return true
+	if c.Partial || !viper.GetBool("CACHE_GC_AFTER_CRAWL") {
+		return
 	}
 
-	if strings.HasPrefix(line, "![") || strings.HasPrefix(line, "[!") {
-		return true
+	policy, err := git.GCPolicyFromEnv()
+	if err != nil {
+		log.Error(err)
+
+		return
 	}
 
-	return false
+	result, err := c.cloneCache.GC(policy, false)
+	if err != nil {
+		log.Errorf("clone cache gc failed: %v", err)
+	}
+
+	if err := c.cloneCache.Save(); err != nil {
+		log.Errorf("can't save clone cache: %v", err)
+	}
+
+	log.Infof(
+		"Clone cache gc removed %d clones, reclaimed %s (%s remaining)",
+		len(result.Removed),
+		git.FormatByteSize(result.Reclaimed),
+		git.FormatByteSize(result.Remaining),
+	)
 }
 
 func ensureDescription(repository common.Repository) string {
@@ -729,6 +1212,14 @@ func ensureDescription(repository common.Repository) string {
 	return "No description provided"
 }
 
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+
+	return &v
+}
+
 func deref(v *string) string {
 	if v == nil {
 		return ""
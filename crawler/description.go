@@ -0,0 +1,619 @@
+package crawler
+
+import (
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// defaultDescriptionMaxLength matches the maximum length of shortDescription in publiccode.yml.
+const defaultDescriptionMaxLength = 150
+
+type readmeFormat int
+
+const (
+	readmeMarkdown readmeFormat = iota
+	readmeRST
+	readmeAsciiDoc
+)
+
+// readmeBlock is a heading or a paragraph of prose in a README. Code blocks,
+// lists, tables and directives are dropped while parsing.
+type readmeBlock struct {
+	heading bool
+	level   int
+	text    string
+	// sections are the lowercased headings the block is nested in, outermost first.
+	sections []string
+}
+
+var (
+	htmlCommentRe  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlHeadingRe  = regexp.MustCompile(`(?is)<h([1-6])[^>]*>(.*?)</h[1-6]>`)
+	htmlBreakRe    = regexp.MustCompile(`(?i)<br\s*/?>|</?p[^>]*>|</?div[^>]*>`)
+	htmlImageRe    = regexp.MustCompile(`(?is)<img[^>]*>`)
+	htmlTagRe      = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9]*(\s[^>]*)?/?>`)
+	mdBadgeLinkRe  = regexp.MustCompile(`\[!\[[^\]]*\](\([^)]*\)|\[[^\]]*\])\](\([^)]*\)|\[[^\]]*\])`)
+	mdImageRe      = regexp.MustCompile(`!\[[^\]]*\](\([^)]*\)|\[[^\]]*\])`)
+	mdLinkRe       = regexp.MustCompile(`\[([^\]]+)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolinkRe   = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	mdRefDefRe     = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S+`)
+	mdListItemRe   = regexp.MustCompile(`^([-*+]|\d+[.)])\s`)
+	rstLinkRe      = regexp.MustCompile("`([^`<]+?)\\s*<[^>]+>`__?")
+	rstRefRe       = regexp.MustCompile("`([^`]+)`__?")
+	rstRoleRe      = regexp.MustCompile(":[a-zA-Z:-]+:`([^`]+)`")
+	rstLiteralRe   = regexp.MustCompile("``([^`]+)``")
+	rstSubstRe     = regexp.MustCompile(`\|[^|\s][^|]*\|_{0,2}`)
+	rstListItemRe  = regexp.MustCompile(`^([-*+•]|\d+[.)]|#\.)\s`)
+	adocImageRe    = regexp.MustCompile(`image::?\S*\[[^\]]*\]`)
+	adocLinkRe     = regexp.MustCompile(`(?:link:)?\S+\[([^\]]+)\]`)
+	adocListItemRe = regexp.MustCompile(`^(\*+|-|\.+|\d+\.)\s`)
+	emphasisRe     = regexp.MustCompile(`(^|[\s(])(\*{1,2}|_{1,2})([^\s*_][^*_]*?)(\*{1,2}|_{1,2})([\s).,;:!?]|$)`)
+	backtickRe     = regexp.MustCompile("`+([^`]+)`+")
+)
+
+// Headings of sections that describe the project, in Dutch and English.
+var descriptionHeadings = []string{
+	"beschrijving", "omschrijving", "introductie", "inleiding", "over", "over dit project", "wat is",
+	"description", "about", "introduction", "overview", "what is",
+}
+
+// Headings of sections that never contain the description.
+var skippedHeadings = []string{
+	"inhoud", "inhoudsopgave", "installatie", "gebruik", "licentie", "bijdragen", "contact",
+	"table of contents", "contents", "toc", "installation", "install", "usage", "license", "licence",
+	"contributing", "getting started", "requirements", "build", "development",
+}
+
+var languageHeadings = map[string][]string{
+	"nl": {"nederlands", "dutch", "nl"},
+	"en": {"english", "engels", "en"},
+}
+
+// descriptionFromReadme extracts a short description from a README: the first
+// paragraph of prose, preferring a description section in the configured
+// language, with badges, HTML and markup removed.
+func descriptionFromReadme(name, contents string) string {
+	return truncateDescription(pickDescription(parseReadme(name, contents), descriptionLanguage()), descriptionMaxLength())
+}
+
+// longDescriptionFromReadme joins the paragraphs of prose in a README that
+// describe the project, up to maxLength characters.
+func longDescriptionFromReadme(name, contents string, maxLength int) string {
+	var paragraphs []string
+
+	length := 0
+
+	for _, block := range descriptionCandidates(parseReadme(name, contents), descriptionLanguage()) {
+		text := normalizeText(block.text)
+
+		if len(paragraphs) == 0 {
+			text = truncateDescription(text, maxLength)
+		} else if length+2+utf8.RuneCountInString(text) > maxLength {
+			break
+		}
+
+		paragraphs = append(paragraphs, text)
+		length += 2 + utf8.RuneCountInString(text)
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func parseReadme(name, contents string) []readmeBlock {
+	contents = strings.ReplaceAll(contents, "\r\n", "\n")
+
+	switch readmeFormatFromName(name) {
+	case readmeRST:
+		return parseRSTReadme(contents)
+	case readmeAsciiDoc:
+		return parseAsciiDocReadme(contents)
+	default:
+		return parseMarkdownReadme(contents)
+	}
+}
+
+func readmeFormatFromName(name string) readmeFormat {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".rst", ".rest":
+		return readmeRST
+	case ".adoc", ".asciidoc", ".asc":
+		return readmeAsciiDoc
+	default:
+		return readmeMarkdown
+	}
+}
+
+func descriptionMaxLength() int {
+	if viper.IsSet("DESCRIPTION_MAX_LENGTH") {
+		return viper.GetInt("DESCRIPTION_MAX_LENGTH")
+	}
+
+	return defaultDescriptionMaxLength
+}
+
+func descriptionLanguage() string {
+	if lang := strings.ToLower(strings.TrimSpace(viper.GetString("DESCRIPTION_LANGUAGE"))); lang != "" {
+		return lang
+	}
+
+	return "nl"
+}
+
+// readmeParser collects blocks and keeps track of the section they're in.
+type readmeParser struct {
+	blocks    []readmeBlock
+	paragraph []string
+	headings  []readmeBlock
+	clean     func(string) string
+}
+
+func (p *readmeParser) addLine(line string) {
+	p.paragraph = append(p.paragraph, line)
+}
+
+func (p *readmeParser) flush() {
+	if len(p.paragraph) == 0 {
+		return
+	}
+
+	text := p.clean(strings.Join(p.paragraph, " "))
+	p.paragraph = nil
+
+	if text == "" {
+		return
+	}
+
+	p.blocks = append(p.blocks, readmeBlock{text: text, sections: p.sections()})
+}
+
+func (p *readmeParser) addHeading(level int, text string) {
+	p.paragraph = nil
+
+	text = p.clean(text)
+	for len(p.headings) > 0 && p.headings[len(p.headings)-1].level >= level {
+		p.headings = p.headings[:len(p.headings)-1]
+	}
+
+	heading := readmeBlock{heading: true, level: level, text: text}
+	p.headings = append(p.headings, heading)
+
+	heading.sections = p.sections()
+	p.blocks = append(p.blocks, heading)
+}
+
+func (p *readmeParser) sections() []string {
+	sections := make([]string, 0, len(p.headings))
+	for _, h := range p.headings {
+		sections = append(sections, normalizeHeading(h.text))
+	}
+
+	return sections
+}
+
+func parseMarkdownReadme(contents string) []readmeBlock {
+	contents = htmlCommentRe.ReplaceAllString(contents, "")
+	contents = htmlHeadingRe.ReplaceAllStringFunc(contents, func(match string) string {
+		m := htmlHeadingRe.FindStringSubmatch(match)
+
+		return "\n\n" + strings.Repeat("#", int(m[1][0]-'0')) + " " + strings.Join(strings.Fields(m[2]), " ") + "\n\n"
+	})
+	contents = htmlImageRe.ReplaceAllString(contents, "")
+	contents = htmlBreakRe.ReplaceAllString(contents, "\n\n")
+
+	p := &readmeParser{clean: cleanMarkdownInline}
+	lines := strings.Split(contents, "\n")
+	fence := ""
+	skipping := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case i == 0 && trimmed == "---":
+			// Skip YAML front matter.
+			i++
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "---" {
+				i++
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			p.flush()
+
+			fence = trimmed[:3]
+		case trimmed == "":
+			p.flush()
+
+			skipping = false
+		case isATXHeading(trimmed):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+
+			p.flush()
+			p.addHeading(level, strings.Trim(trimmed[level:], "# "))
+
+			skipping = false
+		case skipping:
+		case len(p.paragraph) > 0 && isSetextUnderline(trimmed):
+			level := 1
+			if trimmed[0] == '-' {
+				level = 2
+			}
+
+			p.addHeading(level, strings.Join(p.paragraph, " "))
+		case len(p.paragraph) == 0 && isMarkdownNonProse(line, trimmed):
+			skipping = true
+		default:
+			p.addLine(trimmed)
+		}
+	}
+
+	p.flush()
+
+	return p.blocks
+}
+
+func isATXHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+
+	return level > 0 && level <= 6 && (len(line) == level || line[level] == ' ')
+}
+
+func isSetextUnderline(line string) bool {
+	return len(line) >= 2 && (strings.Trim(line, "=") == "" || strings.Trim(line, "-") == "")
+}
+
+func isMarkdownNonProse(line, trimmed string) bool {
+	return strings.HasPrefix(line, "    ") ||
+		strings.HasPrefix(line, "\t") ||
+		strings.HasPrefix(trimmed, ">") ||
+		strings.HasPrefix(trimmed, "|") ||
+		strings.HasPrefix(trimmed, "<") ||
+		strings.HasPrefix(trimmed, "***") ||
+		strings.HasPrefix(trimmed, "---") ||
+		mdListItemRe.MatchString(trimmed) ||
+		mdRefDefRe.MatchString(line)
+}
+
+func cleanMarkdownInline(text string) string {
+	text = mdBadgeLinkRe.ReplaceAllString(text, "")
+	text = mdImageRe.ReplaceAllString(text, "")
+	text = mdLinkRe.ReplaceAllString(text, "$1")
+	text = mdAutolinkRe.ReplaceAllString(text, "$1")
+	text = htmlTagRe.ReplaceAllString(text, "")
+	text = backtickRe.ReplaceAllString(text, "$1")
+	text = stripEmphasis(text)
+	text = strings.NewReplacer(`\*`, "*", `\_`, "_", `\#`, "#", `\[`, "[", `\]`, "]").Replace(text)
+
+	return normalizeText(html.UnescapeString(text))
+}
+
+func parseRSTReadme(contents string) []readmeBlock {
+	p := &readmeParser{clean: cleanRSTInline}
+	lines := strings.Split(contents, "\n")
+	// Heading levels are determined by the order adornment styles first appear in.
+	styles := make(map[string]int)
+	indented := false
+	skipping := false
+
+	headingLevel := func(style string) int {
+		if _, ok := styles[style]; !ok {
+			styles[style] = len(styles) + 1
+		}
+
+		return styles[style]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if indented {
+			if trimmed == "" || line[0] == ' ' || line[0] == '\t' {
+				continue
+			}
+
+			indented = false
+		}
+
+		switch {
+		case trimmed == "":
+			p.flush()
+
+			skipping = false
+		case skipping:
+		case strings.HasPrefix(trimmed, ".. ") || trimmed == "..":
+			// Directives (images, badges, substitutions), comments and link targets.
+			p.flush()
+
+			indented = true
+		case isRSTAdornment(trimmed) && len(p.paragraph) == 0 &&
+			i+2 < len(lines) && strings.TrimSpace(lines[i+2]) == trimmed:
+			p.addHeading(headingLevel("over"+trimmed[:1]), strings.TrimSpace(lines[i+1]))
+			i += 2
+		case isRSTAdornment(trimmed) && len(p.paragraph) == 1:
+			p.addHeading(headingLevel(trimmed[:1]), p.paragraph[0])
+		case isRSTAdornment(trimmed):
+			// Transition.
+			p.flush()
+		case len(p.paragraph) == 0 && (rstListItemRe.MatchString(trimmed) ||
+			strings.HasPrefix(trimmed, ":") || line[0] == ' ' || line[0] == '\t' || trimmed[0] == '+'):
+			skipping = true
+		case strings.HasSuffix(trimmed, "::"):
+			// A literal block follows.
+			literal := strings.TrimSuffix(trimmed, ":")
+			if strings.HasSuffix(literal, " :") || literal == ":" {
+				literal = strings.TrimSuffix(literal, ":")
+			}
+
+			p.addLine(literal)
+			p.flush()
+
+			indented = true
+		default:
+			p.addLine(trimmed)
+		}
+	}
+
+	p.flush()
+
+	return p.blocks
+}
+
+func isRSTAdornment(line string) bool {
+	if len(line) < 3 || !strings.ContainsRune("=-`:'\"~^_*+#<>", rune(line[0])) {
+		return false
+	}
+
+	return strings.Trim(line, line[:1]) == ""
+}
+
+func cleanRSTInline(text string) string {
+	text = rstSubstRe.ReplaceAllString(text, "")
+	text = rstLinkRe.ReplaceAllString(text, "$1")
+	text = rstRoleRe.ReplaceAllString(text, "$1")
+	text = rstLiteralRe.ReplaceAllString(text, "$1")
+	text = rstRefRe.ReplaceAllString(text, "$1")
+	text = stripEmphasis(text)
+
+	return normalizeText(text)
+}
+
+func parseAsciiDocReadme(contents string) []readmeBlock {
+	p := &readmeParser{clean: cleanAsciiDocInline}
+	delimiter := ""
+	skipping := false
+
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case delimiter != "":
+			if trimmed == delimiter {
+				delimiter = ""
+			}
+		case isAsciiDocDelimiter(trimmed):
+			p.flush()
+
+			delimiter = trimmed
+		case trimmed == "":
+			p.flush()
+
+			skipping = false
+		case skipping:
+		case strings.HasPrefix(trimmed, "//"):
+		case strings.HasPrefix(trimmed, "="):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "="))
+			if len(trimmed) > level && trimmed[level] == ' ' {
+				p.flush()
+				p.addHeading(level, strings.TrimSpace(trimmed[level:]))
+
+				continue
+			}
+
+			p.addLine(trimmed)
+		case len(p.paragraph) == 0 && isAsciiDocNonProse(line, trimmed):
+			skipping = !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, ":")
+		default:
+			p.addLine(trimmed)
+		}
+	}
+
+	p.flush()
+
+	return p.blocks
+}
+
+func isAsciiDocDelimiter(line string) bool {
+	if line == "|===" || line == "```" {
+		return true
+	}
+
+	if len(line) < 4 || !strings.ContainsRune("-.=*_+/", rune(line[0])) {
+		return false
+	}
+
+	return strings.Trim(line, line[:1]) == ""
+}
+
+func isAsciiDocNonProse(line, trimmed string) bool {
+	return strings.HasPrefix(trimmed, ":") ||
+		strings.HasPrefix(trimmed, "[") ||
+		strings.HasPrefix(trimmed, "image::") ||
+		strings.HasPrefix(trimmed, "include::") ||
+		(len(trimmed) > 1 && trimmed[0] == '.' && unicode.IsLetter(rune(trimmed[1]))) ||
+		strings.HasPrefix(line, " ") ||
+		adocListItemRe.MatchString(trimmed)
+}
+
+func cleanAsciiDocInline(text string) string {
+	text = adocImageRe.ReplaceAllString(text, "")
+	text = adocLinkRe.ReplaceAllString(text, "$1")
+	text = backtickRe.ReplaceAllString(text, "$1")
+	text = stripEmphasis(text)
+
+	return normalizeText(text)
+}
+
+func stripEmphasis(text string) string {
+	// Nested and adjacent emphasis needs more than one pass.
+	for range 3 {
+		text = emphasisRe.ReplaceAllString(text, "$1$3$5")
+	}
+
+	return text
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func normalizeHeading(heading string) string {
+	heading = strings.ToLower(heading)
+	heading = strings.TrimFunc(heading, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	return normalizeText(heading)
+}
+
+// pickDescription returns the paragraph that best describes the project.
+func pickDescription(blocks []readmeBlock, language string) string {
+	candidates := descriptionCandidates(blocks, language)
+
+	for _, block := range candidates {
+		if inSection(block, descriptionHeadings) {
+			return block.text
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0].text
+	}
+
+	return ""
+}
+
+// descriptionCandidates returns the paragraphs of prose outside sections like
+// installation instructions, limited to the language's section in bilingual
+// READMEs.
+func descriptionCandidates(blocks []readmeBlock, language string) []readmeBlock {
+	candidates := make([]readmeBlock, 0, len(blocks))
+
+	for _, block := range blocks {
+		if !block.heading && isProse(block.text) && !inSection(block, skippedHeadings) {
+			candidates = append(candidates, block)
+		}
+	}
+
+	// Bilingual READMEs have a section per language.
+	if hasLanguageSections(blocks) {
+		var inLanguage []readmeBlock
+
+		for _, block := range candidates {
+			if inSection(block, languageHeadings[language]) {
+				inLanguage = append(inLanguage, block)
+			}
+		}
+
+		if len(inLanguage) > 0 {
+			candidates = inLanguage
+		}
+	}
+
+	return candidates
+}
+
+func hasLanguageSections(blocks []readmeBlock) bool {
+	for _, block := range blocks {
+		if !block.heading {
+			continue
+		}
+
+		for _, headings := range languageHeadings {
+			if matchesHeading(normalizeHeading(block.text), headings) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func inSection(block readmeBlock, headings []string) bool {
+	for _, section := range block.sections {
+		if matchesHeading(section, headings) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesHeading(section string, headings []string) bool {
+	for _, heading := range headings {
+		if section == heading || strings.HasPrefix(section, heading+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isProse reports whether text looks like a sentence rather than e.g. a list
+// of links or a one-word tagline.
+func isProse(text string) bool {
+	words := 0
+
+	for _, word := range strings.Fields(text) {
+		if strings.IndexFunc(word, unicode.IsLetter) >= 0 && !strings.Contains(word, "://") {
+			words++
+		}
+	}
+
+	return words >= 3
+}
+
+// truncateDescription shortens text to at most maxLength characters, at the end
+// of a sentence if possible, otherwise at a word boundary with an ellipsis.
+func truncateDescription(text string, maxLength int) string {
+	text = normalizeText(text)
+
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+
+	runes := []rune(text)
+	cut := runes[:maxLength]
+
+	sentenceEnd := -1
+
+	for i, r := range cut {
+		if (r == '.' || r == '!' || r == '?') && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+			sentenceEnd = i + 1
+		}
+	}
+
+	// Don't settle for a very short first sentence when more text fits.
+	if sentenceEnd >= maxLength/3 {
+		return string(cut[:sentenceEnd])
+	}
+
+	// Leave room for the ellipsis.
+	cut = cut[:maxLength-1]
+	if i := strings.LastIndexFunc(string(cut), unicode.IsSpace); i > 0 {
+		cut = []rune(string(cut)[:i])
+	}
+
+	return strings.TrimRightFunc(string(cut), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:-–", r)
+	}) + "…"
+}
@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescriptionFromReadmeMarkdown(t *testing.T) {
+	readme := `<!-- generated -->
+<p align="center"><img src="logo.png"></p>
+
+# Signalen
+
+[![Build](https://ci.example/badge.svg)](https://ci.example) ![Coverage](https://cov.example/badge.svg)
+
+**Signalen** is an [open source](https://opensource.org) tool for handling
+reports about _public space_ by municipalities.
+
+## Installation
+
+Run ` + "`make`" + `.
+`
+
+	assert.Equal(t,
+		"Signalen is an open source tool for handling reports about public space by municipalities.",
+		descriptionFromReadme("README.md", readme),
+	)
+}
+
+func TestDescriptionFromReadmeSkipsCodeAndLists(t *testing.T) {
+	readme := "# Tool\n\n```sh\nthis is not a description\n```\n\n- list item one two\n- list item\n\n" +
+		"    indented code block here\n\nThe actual description of the tool.\n"
+
+	assert.Equal(t, "The actual description of the tool.", descriptionFromReadme("README", readme))
+}
+
+func TestDescriptionFromReadmePrefersLanguageAndDescriptionSection(t *testing.T) {
+	readme := `# Project
+
+## English
+
+### About
+
+An application to manage permits.
+
+## Nederlands
+
+### Inhoud
+
+Zie de onderstaande secties voor meer.
+
+### Over
+
+Een applicatie voor het beheren van vergunningen.
+`
+
+	assert.Equal(t, "Een applicatie voor het beheren van vergunningen.", descriptionFromReadme("README.md", readme))
+}
+
+func TestDescriptionFromReadmeRST(t *testing.T) {
+	readme := `.. image:: https://ci.example/badge.svg
+   :target: https://ci.example
+
+=======
+Project
+=======
+
+|build| |docs|
+
+Project is a ` + "`Django <https://djangoproject.com>`_" + ` app that uses ` + "``celery``" + ` for
+background tasks.
+
+Install
+-------
+
+.. code-block:: bash
+
+   pip install project
+`
+
+	assert.Equal(t,
+		"Project is a Django app that uses celery for background tasks.",
+		descriptionFromReadme("README.rst", readme),
+	)
+}
+
+func TestDescriptionFromReadmeAsciiDoc(t *testing.T) {
+	readme := `= Project
+:toc:
+:icons: font
+
+image:https://ci.example/badge.svg[Build]
+
+[.lead]
+Project is a *library* for https://example.org[open data] portals.
+
+== Usage
+
+----
+project --help
+----
+`
+
+	assert.Equal(t, "Project is a library for open data portals.", descriptionFromReadme("README.adoc", readme))
+}
+
+func TestTruncateDescription(t *testing.T) {
+	text := "Dit is de eerste zin. Dit is de tweede, iets langere zin. En een derde zin die niet meer past."
+
+	assert.Equal(t, text, truncateDescription(text, 0))
+	assert.Equal(t, "Dit is de eerste zin. Dit is de tweede, iets langere zin.", truncateDescription(text, 70))
+	assert.Equal(t, "Dit is de…", truncateDescription(text, 12))
+	assert.Equal(t, "Eén woord per keer…", truncateDescription("Eén woord per keer zonder punt", 20))
+}
@@ -0,0 +1,379 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+const sentFieldsStateName = "sent-fields"
+
+// diffedFields are the RepositoryRequest fields compared with the register.
+// url and previousUrl identify the entry and lastCrawledAt changes every
+// crawl, so they're left out.
+var diffedFields = []string{
+	"name", "shortDescription", "publicCodeUrl", "publicCodeRef", "version", "isFork", "upstreamUrl",
+	"divergedFromUpstream", "languages", "license", "topics", "organisationUri", "createdAt", "lastActivityAt",
+}
+
+// fieldChange is a register field the crawl changes.
+type fieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// repositoryDiff is the difference between a crawled repository and its
+// register entry.
+type repositoryDiff struct {
+	// Patch holds the changed fields and lastCrawledAt, to be sent with
+	// PatchRepository.
+	Patch   map[string]json.RawMessage
+	Changes []fieldChange
+	// Kept are the fields an editor changed in the register, which the crawl
+	// leaves alone.
+	Kept []string
+}
+
+// sentFieldsStore remembers, per repository URL, the value of every field the
+// crawler last sent. A register value that differs from it was edited by hand.
+type sentFieldsStore struct {
+	mu      sync.Mutex
+	entries map[string]map[string]json.RawMessage
+}
+
+func loadSentFieldsStore() (*sentFieldsStore, error) {
+	s := &sentFieldsStore{}
+
+	if err := state.Load(sentFieldsStateName, &s.entries); err != nil {
+		return nil, err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]map[string]json.RawMessage)
+	}
+
+	return s, nil
+}
+
+// diff compares the request with the register entry. Fields the crawl has no
+// value for are never cleared, just like a POST leaves them alone.
+func (s *sentFieldsStore) diff(
+	current *apiclient.Repository, request apiclient.RepositoryRequest,
+) (repositoryDiff, error) {
+	want, err := toFields(request)
+	if err != nil {
+		return repositoryDiff{}, err
+	}
+
+	have, err := registerFields(current)
+	if err != nil {
+		return repositoryDiff{}, err
+	}
+
+	s.mu.Lock()
+	sent := s.entries[request.URL]
+	s.mu.Unlock()
+
+	d := repositoryDiff{Patch: make(map[string]json.RawMessage)}
+
+	for _, field := range diffedFields {
+		to := normalizeField(want[field])
+		if to == "" {
+			continue
+		}
+
+		from := normalizeField(have[field])
+		if from == to {
+			continue
+		}
+
+		if last, ok := sent[field]; ok && normalizeField(last) != from {
+			d.Kept = append(d.Kept, field)
+
+			continue
+		}
+
+		d.Patch[field] = want[field]
+		d.Changes = append(d.Changes, fieldChange{Field: field, From: from, To: to})
+	}
+
+	// The register shows when the repository was last crawled, changed or not.
+	d.Patch["lastCrawledAt"] = want["lastCrawledAt"]
+
+	return d, nil
+}
+
+// record stores the fields of request as sent, except the ones kept.
+func (s *sentFieldsStore) record(request apiclient.RepositoryRequest, kept []string) {
+	fields, err := toFields(request)
+	if err != nil {
+		log.Error(err)
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[request.URL]
+	if entry == nil {
+		entry = make(map[string]json.RawMessage)
+	}
+
+	for _, field := range diffedFields {
+		if value, ok := fields[field]; ok && !contains(kept, field) {
+			entry[field] = value
+		}
+	}
+
+	s.entries[request.URL] = entry
+
+	if request.PreviousURL != nil {
+		delete(s.entries, *request.PreviousURL)
+	}
+}
+
+func (s *sentFieldsStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return state.Save(sentFieldsStateName, s.entries)
+}
+
+// repositoryUpdate is a repository update ready to be sent: request is
+// POSTed, unless the register has an entry for it, registerID, whose fields
+// are updated with patch.
+type repositoryUpdate struct {
+	request    apiclient.RepositoryRequest
+	registerID string
+	patch      map[string]json.RawMessage
+	// kept are the fields left alone because they were edited in the register.
+	kept []string
+}
+
+// registerSync compares repository updates with the register and sends them.
+type registerSync struct {
+	client     apiclient.APIClient
+	sentFields *sentFieldsStore
+	// snapshot holds the register entries by lowercased URL, if the register
+	// was listed before the crawl. It's read-only while the crawl runs.
+	snapshot map[string]*apiclient.Repository
+}
+
+// loadSnapshot lists the register once, so resolve doesn't have to ask for
+// every repository.
+func (r *registerSync) loadSnapshot() error {
+	repositories, err := r.client.ListRepositories()
+	if err != nil {
+		return fmt.Errorf("can't list the register: %w", err)
+	}
+
+	r.snapshot = make(map[string]*apiclient.Repository, len(repositories))
+	for i := range repositories {
+		r.snapshot[strings.ToLower(repositories[i].RepositoryURL)] = &repositories[i]
+	}
+
+	return nil
+}
+
+// current returns the register entry for repoURL, from the snapshot if there
+// is one.
+func (r *registerSync) current(repoURL string) (*apiclient.Repository, error) {
+	if r.snapshot == nil {
+		return r.client.GetRepository(repoURL)
+	}
+
+	current, ok := r.snapshot[strings.ToLower(repoURL)]
+	if !ok {
+		return nil, apiclient.ErrRepositoryNotFound
+	}
+
+	return current, nil
+}
+
+// resolve decides how request is sent. A repository the register has is
+// compared with its entry and only the changed fields are patched, along
+// with lastCrawledAt. New and renamed repositories are POSTed. If the
+// register can't be asked, resolve returns an error and an update holding just
+// the request, for the outbox: POSTing it would undo edits made in the register.
+func (r *registerSync) resolve(name string, request apiclient.RepositoryRequest) (repositoryUpdate, error) {
+	update := repositoryUpdate{request: request}
+
+	if request.PreviousURL != nil {
+		return update, nil
+	}
+
+	current, err := r.current(request.URL)
+	if errors.Is(err, apiclient.ErrRepositoryNotFound) {
+		return update, nil
+	}
+
+	if err != nil {
+		return update, err
+	}
+
+	d, err := r.sentFields.diff(current, request)
+	if err != nil {
+		return update, err
+	}
+
+	for _, field := range d.Kept {
+		log.Infof("[%s] keeping %s, it was edited in the register", name, field)
+	}
+
+	if len(d.Changes) == 0 {
+		log.Debugf("[%s] register entry is up to date", name)
+	} else {
+		changes := make([]string, 0, len(d.Changes))
+		for _, change := range d.Changes {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", change.Field, orNone(change.From), change.To))
+		}
+
+		log.Infof("[%s] changed %s", name, strings.Join(changes, ", "))
+	}
+
+	update.registerID = current.ID
+	update.patch = d.Patch
+	update.kept = d.Kept
+
+	return update, nil
+}
+
+// send POSTs and PATCHes the updates, each kind in bulk, and returns their
+// errors in order. The fields of every update that was accepted are recorded
+// as sent.
+func (r *registerSync) send(updates []repositoryUpdate) []error {
+	var (
+		errs            = make([]error, len(updates))
+		posted, patched []int
+		requests        []apiclient.RepositoryRequest
+		patches         []apiclient.RepositoryPatch
+	)
+
+	for i, update := range updates {
+		if update.registerID == "" {
+			posted = append(posted, i)
+			requests = append(requests, update.request)
+
+			continue
+		}
+
+		patched = append(patched, i)
+		patches = append(patches, apiclient.RepositoryPatch{ID: update.registerID, Fields: update.patch})
+	}
+
+	if len(requests) > 0 {
+		for j, result := range r.client.PostRepositories(requests) {
+			errs[posted[j]] = result.Err
+		}
+	}
+
+	if len(patches) > 0 {
+		for j, result := range r.client.PatchRepositories(patches) {
+			errs[patched[j]] = result.Err
+		}
+	}
+
+	for i, update := range updates {
+		if errs[i] == nil {
+			r.sentFields.record(update.request, update.kept)
+		}
+	}
+
+	return errs
+}
+
+// sendRepository resolves the repository update, see registerSync.resolve,
+// and queues it for its batch. sent is called with the update and the result;
+// an update that couldn't be resolved fails without being sent.
+func (c *Crawler) sendRepository(
+	name string, request apiclient.RepositoryRequest, sent func(repositoryUpdate, error),
+) {
+	update, err := c.register.resolve(name, request)
+	if err != nil {
+		sent(update, fmt.Errorf("can't compare with the register: %w", err))
+
+		return
+	}
+
+	c.batcher.add(pendingUpdate{update: update, sent: func(err error) { sent(update, err) }})
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+
+	return value
+}
+
+// registerFields returns the fields of a register entry by the JSON name of the
+// matching RepositoryRequest field.
+func registerFields(current *apiclient.Repository) (map[string]json.RawMessage, error) {
+	return toFields(map[string]any{
+		"name":                 current.Name,
+		"shortDescription":     current.Description,
+		"publicCodeUrl":        current.PublicCodeURL,
+		"publicCodeRef":        current.PublicCodeRef,
+		"version":              current.Version,
+		"isFork":               current.IsFork,
+		"upstreamUrl":          current.UpstreamURL,
+		"divergedFromUpstream": current.DivergedFromUpstream,
+		"languages":            current.Languages,
+		"license":              current.License,
+		"topics":               current.Topics,
+		"organisationUri":      current.OrganisationURI,
+		"createdAt":            current.CreatedAt,
+		"lastActivityAt":       current.LastActivity,
+	})
+}
+
+// toFields returns the fields of v by JSON name.
+func toFields(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode repository fields: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("can't decode repository fields: %w", err)
+	}
+
+	return fields, nil
+}
+
+// normalizeField returns a comparable form of a JSON value, "" for no value.
+// Timestamps are compared to the second, in UTC.
+func normalizeField(value json.RawMessage) string {
+	value = bytes.TrimSpace(value)
+
+	switch string(value) {
+	case "", "null", `""`, "[]", `"0001-01-01T00:00:00Z"`:
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			if t.IsZero() {
+				return ""
+			}
+
+			return t.UTC().Truncate(time.Second).Format(time.RFC3339)
+		}
+
+		return s
+	}
+
+	return string(value)
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRepositorySendsOnlyChanges(t *testing.T) {
+	s := &sentFieldsStore{entries: make(map[string]map[string]json.RawMessage)}
+
+	name := "Zaken"
+	license := "EUPL-1.2"
+	isFork := false
+	activity := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	request := apiclient.RepositoryRequest{
+		URL:            "https://github.com/acme/zaken",
+		Name:           &name,
+		License:        &license,
+		IsFork:         &isFork,
+		Topics:         []string{"zaken"},
+		LastActivityAt: activity,
+		LastCrawledAt:  time.Now(),
+	}
+
+	registerName := "Zaken"
+	description := "Zaakafhandeling"
+	current := &apiclient.Repository{
+		ID:            "repo-1",
+		RepositoryURL: request.URL,
+		Name:          &registerName,
+		Description:   &description,
+		Topics:        []string{"zaken"},
+		LastActivity:  activity.Add(300 * time.Millisecond),
+	}
+
+	d, err := s.diff(current, request)
+	require.NoError(t, err)
+
+	// The description isn't in the request, so it's left alone.
+	assert.Equal(t, []fieldChange{{Field: "license", From: "", To: "EUPL-1.2"}}, d.Changes)
+	assert.Contains(t, d.Patch, "lastCrawledAt")
+	assert.Len(t, d.Patch, 2)
+	assert.Empty(t, d.Kept)
+
+	s.record(request, nil)
+
+	// An editor renames the entry; the crawl doesn't undo that.
+	edited := "Zaaksysteem"
+	current.Name = &edited
+	current.License = &license
+
+	d, err = s.diff(current, request)
+	require.NoError(t, err)
+	assert.Empty(t, d.Changes)
+	assert.Equal(t, []string{"name"}, d.Kept)
+
+	// lastCrawledAt is sent even if nothing else changed.
+	assert.Equal(t, []string{"lastCrawledAt"}, slices.Collect(maps.Keys(d.Patch)))
+}
+
+func TestRegisterSyncPatchesKnownRepositories(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("url") != "":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`[{"id":"repo-1","repositoryUrl":"https://github.com/Acme/zaken","license":"MIT"}]`))
+		default:
+			_, _ = w.Write([]byte(`{"id":"repo"}`))
+		}
+	}))
+	defer server.Close()
+
+	viper.Set("API_BASEURL", server.URL)
+	defer viper.Set("API_BASEURL", "")
+
+	client, err := apiclient.NewClient()
+	require.NoError(t, err)
+
+	r := &registerSync{
+		client:     client,
+		sentFields: &sentFieldsStore{entries: make(map[string]map[string]json.RawMessage)},
+	}
+
+	license := "MIT"
+	known := apiclient.RepositoryRequest{URL: "https://github.com/acme/zaken", License: &license}
+
+	// Without a snapshot the register is asked, and an error isn't taken for
+	// a repository it doesn't have.
+	_, err = r.resolve("acme/zaken", known)
+	require.Error(t, err)
+
+	require.NoError(t, r.loadSnapshot())
+
+	update, err := r.resolve("acme/zaken", known)
+	require.NoError(t, err)
+	assert.Equal(t, "repo-1", update.registerID)
+	assert.Equal(t, []string{"lastCrawledAt"}, slices.Collect(maps.Keys(update.patch)))
+
+	added, err := r.resolve("acme/new", apiclient.RepositoryRequest{URL: "https://github.com/acme/new"})
+	require.NoError(t, err)
+	assert.Empty(t, added.registerID)
+
+	for _, err := range r.send([]repositoryUpdate{update, added}) {
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		"GET /repositories", "GET /repositories", "POST /repositories", "PATCH /repositories/repo-1",
+	}, requests)
+	assert.Contains(t, r.sentFields.entries, known.URL)
+}
@@ -0,0 +1,317 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// linkSniffSize is how much of a linked resource is read to check its type.
+const linkSniffSize = 4096
+
+type linkKind int
+
+const (
+	linkPage linkKind = iota
+	linkImage
+	linkAPISpec
+)
+
+var (
+	errUnsupportedScheme = errors.New("unsupported URL scheme")
+	errNonPublicAddress  = errors.New("refusing to connect to non-public address")
+
+	// linkHTTPClient fetches the links in publiccode.yml files. Publishers
+	// choose those, so it only connects to public addresses, see
+	// publicAddressOnly, unless it goes through the proxy from the
+	// environment.
+	linkHTTPClient = newLinkHTTPClient(http.ProxyFromEnvironment)
+
+	// nonPublicPrefixes are the non-public networks netip.Addr has no method
+	// for: "this network" and the carrier-grade NAT range, which some clusters
+	// use for pods and services.
+	nonPublicPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+	}
+
+	apiSpecKeyRe = regexp.MustCompile(`(?m)(^|[{,])\s*"?(openapi|swagger|asyncapi)"?\s*:`)
+)
+
+type publiccodeLink struct {
+	field string
+	url   string
+	kind  linkKind
+}
+
+// checkLinks checks the URLs referenced from the repository's publiccode.yml
+// and records the broken ones in the report.
+func (c *Crawler) checkLinks(
+	ctx context.Context, repository common.Repository, file *publiccodeFile, logEntries *[]string,
+) {
+	broken := checkPubliccodeLinks(ctx, repository, file)
+
+	for _, link := range broken {
+		*logEntries = append(
+			*logEntries,
+			fmt.Sprintf("[%s] broken link in %s: %s (%s)", repository.Name, link.Field, link.URL, link.Reason),
+		)
+	}
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.BrokenLinks = broken
+	})
+}
+
+// checkPubliccodeLinks checks every URL referenced from file. Relative URLs are
+// resolved against the repository's raw publiccode.yml URL.
+func checkPubliccodeLinks(ctx context.Context, repository common.Repository, file *publiccodeFile) []report.BrokenLink {
+	base, err := url.Parse(repository.FileRawURL)
+	if err != nil {
+		log.Warnf("[%s] can't parse publiccode.yml URL: %v", repository.Name, err)
+
+		return nil
+	}
+
+	var broken []report.BrokenLink
+
+	checked := make(map[string]string)
+
+	for _, link := range publiccodeLinks(file) {
+		target, headers, err := resolveLink(base, link.url, repository.Headers)
+		if err != nil {
+			broken = append(broken, report.BrokenLink{Field: link.field, URL: link.url, Reason: err.Error()})
+
+			continue
+		}
+
+		key := fmt.Sprintf("%d %s", link.kind, target)
+
+		reason, ok := checked[key]
+		if !ok {
+			reason = checkLink(ctx, target, headers, link.kind)
+			checked[key] = reason
+		}
+
+		if reason != "" {
+			broken = append(broken, report.BrokenLink{Field: link.field, URL: target.String(), Reason: reason})
+		}
+	}
+
+	return broken
+}
+
+// publiccodeLinks returns the URLs referenced from file in a stable order.
+func publiccodeLinks(file *publiccodeFile) []publiccodeLink {
+	var links []publiccodeLink
+
+	add := func(field, u string, kind linkKind) {
+		if strings.TrimSpace(u) != "" {
+			links = append(links, publiccodeLink{field: field, url: u, kind: kind})
+		}
+	}
+
+	add("landingURL", file.LandingURL, linkPage)
+	add("roadmap", file.Roadmap, linkPage)
+	add("logo", file.Logo, linkImage)
+
+	languages := make([]string, 0, len(file.Description))
+	for lang := range file.Description {
+		languages = append(languages, lang)
+	}
+
+	sort.Strings(languages)
+
+	for _, lang := range languages {
+		desc := file.Description[lang]
+		prefix := "description." + lang + "."
+
+		add(prefix+"documentation", desc.Documentation, linkPage)
+		add(prefix+"apiDocumentation", desc.APIDocumentation, linkAPISpec)
+
+		for _, screenshot := range desc.Screenshots {
+			add(prefix+"screenshots", screenshot, linkImage)
+		}
+
+		for _, video := range desc.Videos {
+			add(prefix+"videos", video, linkPage)
+		}
+	}
+
+	return links
+}
+
+// resolveLink resolves raw against base. Paths are relative to the repository
+// root, even with a leading slash. The repository's headers are only passed on
+// to its own host, so credentials don't leak to third parties.
+func resolveLink(base *url.URL, raw string, headers map[string]string) (*url.URL, map[string]string, error) {
+	ref, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if ref.Scheme == "" && ref.Host == "" {
+		ref.Path = strings.TrimLeft(ref.Path, "/")
+	}
+
+	target := base.ResolveReference(ref)
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, nil, fmt.Errorf("%w %q", errUnsupportedScheme, target.Scheme)
+	}
+
+	if target.Host != base.Host {
+		headers = nil
+	}
+
+	return target, headers, nil
+}
+
+// checkLink returns why target is broken, or "" if it's fine.
+func checkLink(ctx context.Context, target *url.URL, headers map[string]string, kind linkKind) string {
+	statusCode, responseHeaders, body, err := publiccodeGetWithRetry(
+		ctx, linkHTTPClient, target.String(), headers, linkSniffSize,
+	)
+	if err != nil {
+		return fmt.Sprintf("request failed: %v", err)
+	}
+
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return fmt.Sprintf("HTTP status %d", statusCode)
+	}
+
+	switch kind {
+	case linkImage:
+		contentType := responseHeaders.Get("Content-Type")
+		if !isImage(contentType, body) {
+			return fmt.Sprintf("not an image (%s)", contentType)
+		}
+	case linkAPISpec:
+		// apiDocumentation may also point to human readable docs, only check
+		// the contents of what looks like a specification file.
+		if isSpecFileName(target.Path) && !apiSpecKeyRe.Match(body) {
+			return "not an OpenAPI or AsyncAPI specification"
+		}
+	case linkPage:
+	}
+
+	return ""
+}
+
+// newLinkHTTPClient returns the client for linkHTTPClient. Requests for which
+// proxy returns a proxy go through it, and it's up to the proxy to refuse
+// non-public addresses: the dialer would only see the proxy's address. Other
+// requests connect directly, to public addresses only.
+func newLinkHTTPClient(proxy func(*http.Request) (*url.URL, error)) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicAddressOnly,
+	}
+
+	transport, _ := http.DefaultTransport.(*http.Transport)
+
+	direct := transport.Clone()
+	direct.DialContext = dialer.DialContext
+	direct.Proxy = nil
+
+	proxied := transport.Clone()
+	proxied.Proxy = proxy
+
+	return &http.Client{
+		Timeout:   publiccodeRequestTimeout,
+		Transport: &linkTransport{proxy: proxy, direct: direct, proxied: proxied},
+	}
+}
+
+// linkTransport sends a request through proxied if proxy returns a proxy for
+// it, or else through direct. It's asked for every request, redirects included.
+type linkTransport struct {
+	proxy   func(*http.Request) (*url.URL, error)
+	direct  http.RoundTripper
+	proxied http.RoundTripper
+}
+
+func (t *linkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxyURL, err := t.proxy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL != nil {
+		return t.proxied.RoundTrip(req)
+	}
+
+	return t.direct.RoundTrip(req)
+}
+
+// publicAddressOnly is a net.Dialer Control func refusing loopback, link-local,
+// private and other non-public addresses, so links can't reach hosts inside the
+// network the crawler runs in, such as cloud metadata endpoints and cluster
+// services. It runs for every connection, redirects included, after the name
+// was resolved.
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	ip = ip.Unmap()
+
+	nonPublic := ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+
+	for _, prefix := range nonPublicPrefixes {
+		nonPublic = nonPublic || prefix.Contains(ip)
+	}
+
+	if nonPublic {
+		return fmt.Errorf("%w %s", errNonPublicAddress, ip)
+	}
+
+	return nil
+}
+
+func isImage(contentType string, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mediaType, "image/") {
+		return true
+	}
+
+	// Raw file endpoints often serve everything as text/plain or
+	// application/octet-stream, so look at the contents too.
+	if strings.HasPrefix(http.DetectContentType(body), "image/") {
+		return true
+	}
+
+	return bytes.Contains(bytes.ToLower(body), []byte("<svg"))
+}
+
+func isSpecFileName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const linkCheckPubliccode = `publiccodeYmlVersion: "0.4"
+name: Voorbeeld
+landingURL: %[1]s/landing
+logo: /img/logo.png
+description:
+  nl:
+    documentation: %[1]s/missing
+    apiDocumentation: api/openapi.yaml
+    screenshots:
+      - img/screenshot.html
+  en:
+    apiDocumentation: api/not-a-spec.json
+`
+
+func TestCheckPubliccodeLinks(t *testing.T) {
+	var gotAuth []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/repo/raw/main/publiccode.yml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(fmt.Sprintf(linkCheckPubliccode, "http://"+r.Host)))
+	})
+	mux.HandleFunc("/org/repo/raw/main/img/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	mux.HandleFunc("/org/repo/raw/main/img/screenshot.html", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/org/repo/raw/main/api/openapi.yaml", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("# API\nopenapi: 3.0.0\ninfo:\n  title: Voorbeeld\n"))
+	})
+	mux.HandleFunc("/org/repo/raw/main/api/not-a-spec.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"name": "package"}`))
+	})
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The test server is on loopback, which linkHTTPClient refuses.
+	defer func(client *http.Client) { linkHTTPClient = client }(linkHTTPClient)
+
+	linkHTTPClient = server.Client()
+
+	repository := common.Repository{
+		Name:       "org/repo",
+		FileRawURL: server.URL + "/org/repo/raw/main/publiccode.yml",
+		Headers:    map[string]string{"Authorization": "Bearer secret"},
+	}
+
+	var logEntries []string
+
+	file := (&Crawler{}).ensurePubliccodeFile(context.Background(), &repository, &logEntries)
+	require.NotNil(t, file, logEntries)
+
+	broken := checkPubliccodeLinks(context.Background(), repository, file)
+
+	assert.Equal(t, []report.BrokenLink{
+		{
+			Field:  "description.en.apiDocumentation",
+			URL:    server.URL + "/org/repo/raw/main/api/not-a-spec.json",
+			Reason: "not an OpenAPI or AsyncAPI specification",
+		},
+		{
+			Field:  "description.nl.documentation",
+			URL:    server.URL + "/missing",
+			Reason: "HTTP status 404",
+		},
+		{
+			Field:  "description.nl.screenshots",
+			URL:    server.URL + "/org/repo/raw/main/img/screenshot.html",
+			Reason: "not an image (text/html)",
+		},
+	}, broken)
+	assert.Equal(t, []string{"Bearer secret"}, gotAuth)
+}
+
+func TestResolveLinkOnlySendsHeadersToRepositoryHost(t *testing.T) {
+	base, err := url.Parse("https://raw.example.org/org/repo/main/publiccode.yml?token=abc")
+	require.NoError(t, err)
+
+	headers := map[string]string{"Authorization": "Bearer secret"}
+
+	target, got, err := resolveLink(base, "docs/logo.svg", headers)
+	require.NoError(t, err)
+	assert.Equal(t, "https://raw.example.org/org/repo/main/docs/logo.svg", target.String())
+	assert.Equal(t, headers, got)
+
+	target, got, err = resolveLink(base, "https://cdn.example.com/logo.svg", headers)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/logo.svg", target.String())
+	assert.Nil(t, got)
+
+	_, _, err = resolveLink(base, "mailto:info@example.org", headers)
+	require.ErrorIs(t, err, errUnsupportedScheme)
+}
+
+func TestCheckLinkRefusesNonPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL + "/landing")
+	require.NoError(t, err)
+
+	reason := checkLink(context.Background(), target, nil, linkPage)
+	assert.Contains(t, reason, errNonPublicAddress.Error())
+
+	for _, address := range []string{"169.254.169.254:80", "10.0.0.1:443", "[::1]:80", "100.64.1.2:80"} {
+		require.ErrorIs(t, publicAddressOnly("tcp", address, nil), errNonPublicAddress, address)
+	}
+
+	require.NoError(t, publicAddressOnly("tcp", "145.21.1.10:443", nil))
+}
+
+func TestCheckLinkThroughProxy(t *testing.T) {
+	// The proxy is on loopback, which only direct connections refuse.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "http://example.org/landing", r.RequestURI)
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	defer func(client *http.Client) { linkHTTPClient = client }(linkHTTPClient)
+
+	linkHTTPClient = newLinkHTTPClient(http.ProxyURL(proxyURL))
+
+	target, err := url.Parse("http://example.org/landing")
+	require.NoError(t, err)
+
+	assert.Empty(t, checkLink(context.Background(), target, nil, linkPage))
+
+	// Without a proxy the loopback address is refused again.
+	linkHTTPClient = newLinkHTTPClient(func(*http.Request) (*url.URL, error) { return nil, nil })
+
+	target, err = url.Parse(proxy.URL + "/landing")
+	require.NoError(t, err)
+
+	assert.Contains(t, checkLink(context.Background(), target, nil, linkPage), errNonPublicAddress.Error())
+}
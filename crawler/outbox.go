@@ -0,0 +1,306 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outboxStateName = "outbox"
+	// outboxRounds is how many times the outbox is sent at the end of a full
+	// crawl, waiting outboxBackoff, then twice as long, and so on in between.
+	outboxRounds     = 3
+	outboxBackoff    = 30 * time.Second
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// outboxSender resolves and sends repository updates, see registerSync.
+type outboxSender interface {
+	resolve(name string, request apiclient.RepositoryRequest) (repositoryUpdate, error)
+	send(updates []repositoryUpdate) []error
+}
+
+// OutboxEntry is a repository update the register didn't accept.
+type OutboxEntry struct {
+	Request apiclient.RepositoryRequest `json:"request"`
+	// RegisterID, Patch and Kept are set if the update patches the register
+	// entry RegisterID, see repositoryUpdate. Without them the update is
+	// compared with the register again before it's sent.
+	RegisterID string                     `json:"register_id,omitempty"`
+	Patch      map[string]json.RawMessage `json:"patch,omitempty"`
+	Kept       []string                   `json:"kept,omitempty"`
+	// Attempts counts the failed attempts to send the update, the crawl's own
+	// included.
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error"`
+	FailedAt      time.Time `json:"failed_at"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+}
+
+// update returns the repository update the entry holds.
+func (e *OutboxEntry) update() repositoryUpdate {
+	return repositoryUpdate{request: e.Request, registerID: e.RegisterID, patch: e.Patch, kept: e.Kept}
+}
+
+func (e *OutboxEntry) setUpdate(update repositoryUpdate) {
+	e.Request = update.request
+	e.RegisterID = update.registerID
+	e.Patch = update.patch
+	e.Kept = update.kept
+}
+
+// outboxStore keeps failed repository updates, keyed by repository URL, until
+// they're sent. Only the latest update of a repository is kept.
+type outboxStore struct {
+	mu      sync.Mutex
+	entries map[string]OutboxEntry
+}
+
+func loadOutboxStore() (*outboxStore, error) {
+	s := &outboxStore{}
+
+	if err := state.Load(outboxStateName, &s.entries); err != nil {
+		return nil, err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]OutboxEntry)
+	}
+
+	return s, nil
+}
+
+// add stores the update that failed with cause and saves the outbox right
+// away, so it survives a crash.
+func (s *outboxStore) add(update repositoryUpdate, cause error) error {
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[update.request.URL]
+	if !ok {
+		entry.FailedAt = now
+	}
+
+	entry.setUpdate(update)
+	entry.Attempts++
+	entry.Error = cause.Error()
+	entry.LastAttemptAt = now
+
+	s.entries[update.request.URL] = entry
+
+	return state.Save(outboxStateName, s.entries)
+}
+
+// remove drops the update for repoURL, which was superseded by one that was
+// sent.
+func (s *outboxStore) remove(repoURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[repoURL]; !ok {
+		return nil
+	}
+
+	delete(s.entries, repoURL)
+
+	return state.Save(outboxStateName, s.entries)
+}
+
+// list returns the entries, oldest failure first.
+func (s *outboxStore) list() []OutboxEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]OutboxEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FailedAt.Before(entries[j].FailedAt) })
+
+	return entries
+}
+
+// send sends every entry once and returns how many were accepted. Entries
+// that don't patch a register entry yet are resolved first; one that can't be
+// resolved counts as a failed attempt.
+func (s *outboxStore) send(sender outboxSender) (int, error) {
+	var (
+		updates []repositoryUpdate
+		errs    = make(map[string]error)
+	)
+
+	for _, entry := range s.list() {
+		update := entry.update()
+
+		if update.registerID == "" {
+			resolved, err := sender.resolve(entry.Request.URL, entry.Request)
+			if err != nil {
+				errs[entry.Request.URL] = err
+
+				continue
+			}
+
+			update = resolved
+		}
+
+		updates = append(updates, update)
+	}
+
+	for i, err := range sender.send(updates) {
+		errs[updates[i].request.URL] = err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := 0
+
+	for _, update := range updates {
+		current, ok := s.entries[update.request.URL]
+		if !ok {
+			continue
+		}
+
+		current.setUpdate(update)
+		s.entries[update.request.URL] = current
+	}
+
+	for url, err := range errs {
+		current, ok := s.entries[url]
+		if !ok {
+			continue
+		}
+
+		if err == nil {
+			delete(s.entries, url)
+
+			sent++
+
+			continue
+		}
+
+		// The register entry is gone, so the update is resolved again.
+		if errors.Is(err, apiclient.ErrRepositoryNotFound) {
+			current.setUpdate(repositoryUpdate{request: current.Request})
+		}
+
+		current.Attempts++
+		current.Error = err.Error()
+		current.LastAttemptAt = time.Now().UTC()
+		s.entries[url] = current
+	}
+
+	return sent, state.Save(outboxStateName, s.entries)
+}
+
+// flush sends the outbox up to rounds times, backing off in between, until
+// it's empty. It returns how many entries were sent and how many are left.
+func (s *outboxStore) flush(ctx context.Context, sender outboxSender, rounds int) (int, int, error) {
+	total := 0
+	wait := outboxBackoff
+
+	for round := 1; ; round++ {
+		sent, err := s.send(sender)
+		total += sent
+
+		if err != nil {
+			return total, len(s.list()), err
+		}
+
+		left := len(s.list())
+		if left == 0 || round >= rounds {
+			return total, left, nil
+		}
+
+		log.Infof("%d repository updates still in the outbox, retrying in %s", left, wait)
+
+		select {
+		case <-ctx.Done():
+			return total, left, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		wait = min(2*wait, outboxMaxBackoff)
+	}
+}
+
+// reportEntries returns the outbox in the form the crawl report uses.
+func (s *outboxStore) reportEntries() []report.OutboxEntry {
+	entries := s.list()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	out := make([]report.OutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, report.OutboxEntry{
+			URL:      entry.Request.URL,
+			Attempts: entry.Attempts,
+			Error:    entry.Error,
+			FailedAt: entry.FailedAt,
+		})
+	}
+
+	return out
+}
+
+// flushOutbox sends the repository updates that failed before, with rounds as
+// in outboxStore.flush.
+func (c *Crawler) flushOutbox(rounds int) {
+	if len(c.outbox.list()) == 0 {
+		return
+	}
+
+	sent, left, err := c.outbox.flush(context.Background(), c.register, rounds)
+	if err != nil {
+		log.Errorf("can't flush outbox: %v", err)
+	}
+
+	if sent > 0 || left > 0 {
+		log.Infof("Outbox: sent %d repository updates, %d left", sent, left)
+	}
+}
+
+// Outbox returns the repository updates the register didn't accept, oldest
+// first.
+func Outbox() ([]OutboxEntry, error) {
+	s, err := loadOutboxStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.list(), nil
+}
+
+// FlushOutbox sends the repository updates in the outbox once with client. It
+// returns how many were sent and how many are left.
+func FlushOutbox(ctx context.Context, client apiclient.APIClient) (int, int, error) {
+	s, err := loadOutboxStore()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sentFields, err := loadSentFieldsStore()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, left, err := s.flush(ctx, &registerSync{client: client, sentFields: sentFields}, 1)
+	if saveErr := sentFields.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	return sent, left, err
+}
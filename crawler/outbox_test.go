@@ -0,0 +1,179 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender resolves every repository to a patch of register entry "id-"
+// plus its URL, and fails the updates in failing.
+type fakeSender struct {
+	resolveErr error
+	failing    map[string]error
+	resolved   int
+	sent       []repositoryUpdate
+}
+
+func (f *fakeSender) resolve(_ string, request apiclient.RepositoryRequest) (repositoryUpdate, error) {
+	f.resolved++
+
+	if f.resolveErr != nil {
+		return repositoryUpdate{request: request}, f.resolveErr
+	}
+
+	return repositoryUpdate{request: request, registerID: "id-" + request.URL}, nil
+}
+
+func (f *fakeSender) send(updates []repositoryUpdate) []error {
+	f.sent = append(f.sent, updates...)
+
+	errs := make([]error, len(updates))
+	for i, update := range updates {
+		errs[i] = f.failing[update.request.URL]
+	}
+
+	return errs
+}
+
+func TestOutboxKeepsFailedUpdatesUntilSent(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	s, err := loadOutboxStore()
+	require.NoError(t, err)
+
+	down := errors.New("503 Service Unavailable")
+	patch := map[string]json.RawMessage{"license": json.RawMessage(`"MIT"`)}
+
+	a := apiclient.RepositoryRequest{URL: "https://github.com/acme/a"}
+	b := apiclient.RepositoryRequest{URL: "https://github.com/acme/b"}
+
+	require.NoError(t, s.add(repositoryUpdate{request: a}, down))
+	require.NoError(t, s.add(repositoryUpdate{request: b}, down))
+	b.Topics = []string{"x"}
+	patched := repositoryUpdate{request: b, registerID: "repo-b", patch: patch, kept: []string{"name"}}
+	require.NoError(t, s.add(patched, down))
+	require.NoError(t, s.remove(a.URL))
+
+	// The outbox survives a restart, with the latest update of b only.
+	s, err = loadOutboxStore()
+	require.NoError(t, err)
+
+	entries := s.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, []string{"x"}, entries[0].Request.Topics)
+	assert.Equal(t, "repo-b", entries[0].RegisterID)
+	assert.Equal(t, 2, entries[0].Attempts)
+
+	sender := &fakeSender{failing: map[string]error{b.URL: down}}
+
+	sent, left, err := s.flush(context.Background(), sender, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 1, left)
+	assert.Equal(t, 3, s.list()[0].Attempts)
+	assert.Len(t, s.reportEntries(), 1)
+
+	// A stored patch is replayed as it is, without asking the register.
+	assert.Equal(t, 0, sender.resolved)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "repo-b", sender.sent[0].registerID)
+	assert.Equal(t, patch, sender.sent[0].patch)
+	assert.Equal(t, []string{"name"}, sender.sent[0].kept)
+
+	sent, left, err = s.flush(context.Background(), &fakeSender{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 0, left)
+	assert.Nil(t, s.reportEntries())
+}
+
+func TestOutboxResolvesUpdatesWithoutRegisterEntry(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	s, err := loadOutboxStore()
+	require.NoError(t, err)
+
+	request := apiclient.RepositoryRequest{URL: "https://github.com/acme/a"}
+	require.NoError(t, s.add(repositoryUpdate{request: request}, errors.New("GET: 503 Service Unavailable")))
+
+	// The register still can't be asked: nothing is sent.
+	sender := &fakeSender{resolveErr: errors.New("GET: 503 Service Unavailable")}
+
+	sent, left, err := s.flush(context.Background(), sender, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 1, left)
+	assert.Empty(t, sender.sent)
+	assert.Equal(t, 2, s.list()[0].Attempts)
+
+	// The register entry was removed meanwhile: the patch is dropped, so the
+	// next round compares again.
+	sender = &fakeSender{failing: map[string]error{request.URL: apiclient.ErrRepositoryNotFound}}
+
+	_, left, err = s.flush(context.Background(), sender, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, left)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "id-"+request.URL, sender.sent[0].registerID)
+	assert.Empty(t, s.list()[0].RegisterID)
+
+	sender = &fakeSender{}
+
+	sent, left, err = s.flush(context.Background(), sender, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 0, left)
+	assert.Equal(t, 1, sender.resolved)
+}
+
+func TestAfterSendKeepsRejectedUpdateInOutbox(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	outbox, err := loadOutboxStore()
+	require.NoError(t, err)
+
+	c := &Crawler{outbox: outbox}
+	update := repositoryUpdate{
+		request:    apiclient.RepositoryRequest{URL: "https://github.com/acme/a"},
+		registerID: "repo-1",
+	}
+
+	// The outbox owns the retry, so the repository isn't failed in the queue.
+	err = c.afterSend(common.Repository{Name: "acme/a"}, update, errors.New("503 Service Unavailable"))
+	require.NoError(t, err)
+	require.Len(t, outbox.list(), 1)
+	assert.Equal(t, "repo-1", outbox.list()[0].RegisterID)
+}
+
+func TestLockDataDirReloadsState(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	c := &Crawler{}
+	require.NoError(t, c.loadState())
+
+	// Another run adds to the outbox before this one gets the lock.
+	other, err := loadOutboxStore()
+	require.NoError(t, err)
+
+	update := repositoryUpdate{request: apiclient.RepositoryRequest{URL: "https://github.com/acme/a"}}
+	require.NoError(t, other.add(update, errors.New("503 Service Unavailable")))
+
+	unlock, err := c.lockDataDir()
+	require.NoError(t, err)
+
+	defer unlock()
+
+	assert.Len(t, c.outbox.list(), 1)
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alranel/go-vcsurl/v2"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/developer-overheid-nl/don-crawler/proposer"
+	"github.com/spf13/viper"
+)
+
+const proposalsStateName = "proposals"
+
+// proposalStore remembers the pull and merge requests opened, keyed by
+// canonical URL, so repositories aren't proposed to again.
+type proposalStore struct {
+	mu      sync.Mutex
+	entries map[string]proposalEntry
+}
+
+type proposalEntry struct {
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	// URL is the pull or merge request.
+	URL        string    `json:"url"`
+	ProposedAt time.Time `json:"proposed_at"`
+}
+
+func loadProposalStore() (*proposalStore, error) {
+	s := &proposalStore{}
+
+	if err := state.Load(proposalsStateName, &s.entries); err != nil {
+		return nil, err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]proposalEntry)
+	}
+
+	return s, nil
+}
+
+func (s *proposalStore) get(repository common.Repository) (proposalEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[repository.CanonicalURL.String()]
+
+	return entry, ok
+}
+
+// add records the proposal and saves the store right away: a request is opened
+// on someone else's repository and must never be forgotten.
+func (s *proposalStore) add(repository common.Repository, proposal proposer.Proposal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[repository.CanonicalURL.String()] = proposalEntry{
+		Name:       repository.Name,
+		Publisher:  repository.Publisher.ID,
+		URL:        proposal.URL,
+		ProposedAt: time.Now().UTC(),
+	}
+
+	return state.Save(proposalsStateName, s.entries)
+}
+
+// ProposePubliccode opens a pull or merge request adding a draft
+// publiccode.yml to the repository at repoURL, which must not have one yet.
+// Repositories proposed to before, by this crawler or through an earlier
+// request from the same branch, get no new one: the earlier one is returned
+// with Existing set.
+func (c *Crawler) ProposePubliccode(
+	ctx context.Context, repoURL string, publisher common.Publisher,
+) (proposer.Proposal, error) {
+	repository, err := c.scanRepository(repoURL, publisher)
+	if err != nil {
+		return proposer.Proposal{}, err
+	}
+
+	if repository.FileRawURL != "" {
+		return proposer.Proposal{}, fmt.Errorf("%s: %w", repoURL, ErrHasPubliccode)
+	}
+
+	if entry, ok := c.proposals.get(repository); ok {
+		return proposer.Proposal{URL: entry.URL, Existing: true}, nil
+	}
+
+	p, err := proposerFor(ctx, repository.URL)
+	if err != nil {
+		return proposer.Proposal{}, err
+	}
+
+	draft, err := c.draftFromClone(repository)
+	if err != nil {
+		return proposer.Proposal{}, err
+	}
+
+	proposal, err := p.Propose(ctx, repository, draft)
+	if err != nil {
+		return proposer.Proposal{}, err
+	}
+
+	if err := c.proposals.add(repository, proposal); err != nil {
+		return proposal, err
+	}
+
+	return proposal, nil
+}
+
+// proposerFor returns the proposer for the code hosting platform of u.
+func proposerFor(ctx context.Context, u url.URL) (proposer.Proposer, error) {
+	switch {
+	case vcsurl.IsGitHub(&u):
+		return proposer.NewGitHubFromEnv(ctx, viper.GetString("PROPOSE_GITHUB_FORK_ORG"))
+	case vcsurl.IsGitLab(&u):
+		token := viper.GetString("GITLAB_TOKEN")
+		if token == "" {
+			return nil, errors.New("GITLAB_TOKEN is needed to open merge requests")
+		}
+
+		return proposer.NewGitLab(token, viper.GetString("PROPOSE_GITLAB_FORK_NAMESPACE")), nil
+	default:
+		return nil, fmt.Errorf("can't open pull requests on %s", u.Host)
+	}
+}
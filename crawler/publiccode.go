@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const publiccodeMaxSize = 1 << 20
+
+// publiccodeFile holds the parts of publiccode.yml the crawler looks at. It's
+// also used to write drafts, hence the omitempty options.
+//
+//nolint:tagliatelle // publiccode.yml field names.
+type publiccodeFile struct {
+	PubliccodeYmlVersion string                           `yaml:"publiccodeYmlVersion,omitempty"`
+	Name                 string                           `yaml:"name"`
+	URL                  string                           `yaml:"url"`
+	LandingURL           string                           `yaml:"landingURL,omitempty"`
+	Roadmap              string                           `yaml:"roadmap,omitempty"`
+	Logo                 string                           `yaml:"logo,omitempty"`
+	SoftwareVersion      string                           `yaml:"softwareVersion,omitempty"`
+	ReleaseDate          string                           `yaml:"releaseDate,omitempty"`
+	Platforms            []string                         `yaml:"platforms,omitempty"`
+	Categories           []string                         `yaml:"categories,omitempty"`
+	DevelopmentStatus    string                           `yaml:"developmentStatus,omitempty"`
+	SoftwareType         string                           `yaml:"softwareType,omitempty"`
+	Description          map[string]publiccodeDescription `yaml:"description,omitempty"`
+	Legal                publiccodeLegal                  `yaml:"legal"`
+	Maintenance          publiccodeMaintenance            `yaml:"maintenance"`
+	Localisation         publiccodeLocalisation           `yaml:"localisation"`
+}
+
+//nolint:tagliatelle // publiccode.yml field names.
+type publiccodeDescription struct {
+	ShortDescription string   `yaml:"shortDescription,omitempty"`
+	LongDescription  string   `yaml:"longDescription,omitempty"`
+	Documentation    string   `yaml:"documentation,omitempty"`
+	APIDocumentation string   `yaml:"apiDocumentation,omitempty"`
+	Features         []string `yaml:"features,omitempty"`
+	Screenshots      []string `yaml:"screenshots,omitempty"`
+	Videos           []string `yaml:"videos,omitempty"`
+}
+
+//nolint:tagliatelle // publiccode.yml field names.
+type publiccodeLegal struct {
+	License            string `yaml:"license,omitempty"`
+	MainCopyrightOwner string `yaml:"mainCopyrightOwner,omitempty"`
+}
+
+type publiccodeMaintenance struct {
+	Type        string              `yaml:"type,omitempty"`
+	Contractors []map[string]any    `yaml:"contractors,omitempty"`
+	Contacts    []publiccodeContact `yaml:"contacts,omitempty"`
+}
+
+type publiccodeContact struct {
+	Name        string `yaml:"name"`
+	Email       string `yaml:"email,omitempty"`
+	Phone       string `yaml:"phone,omitempty"`
+	Affiliation string `yaml:"affiliation,omitempty"`
+}
+
+//nolint:tagliatelle // publiccode.yml field names.
+type publiccodeLocalisation struct {
+	LocalisationReady  bool     `yaml:"localisationReady"`
+	AvailableLanguages []string `yaml:"availableLanguages,omitempty"`
+}
+
+// parsePubliccode parses the contents of a publiccode.yml.
+func parsePubliccode(contents []byte) (*publiccodeFile, error) {
+	var file publiccodeFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("can't parse publiccode.yml: %w", err)
+	}
+
+	return &file, nil
+}
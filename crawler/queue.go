@@ -0,0 +1,422 @@
+package crawler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/queue"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	deadLettersStateName = "dead-letter"
+	// defaultMaxAttempts is used when CRAWL_MAX_ATTEMPTS isn't set.
+	defaultMaxAttempts = 3
+
+	kindPublisher  = "publisher"
+	kindRepository = "repository"
+)
+
+// DeadLetter is a queue item that failed CRAWL_MAX_ATTEMPTS times. Full and
+// resumed crawls skip it until it's cleared.
+type DeadLetter struct {
+	Key      string    `json:"key"`
+	Kind     string    `json:"kind"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	DeadAt   time.Time `json:"dead_at"`
+}
+
+// deadLetterStore is the persistent dead-letter list, keyed by queue key.
+type deadLetterStore struct {
+	mu      sync.Mutex
+	entries map[string]DeadLetter
+}
+
+func loadDeadLetterStore() (*deadLetterStore, error) {
+	s := &deadLetterStore{}
+
+	if err := state.Load(deadLettersStateName, &s.entries); err != nil {
+		return nil, err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]DeadLetter)
+	}
+
+	return s, nil
+}
+
+func (s *deadLetterStore) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.entries[key]
+
+	return ok
+}
+
+// add records the dead item and saves the list right away, so it's skipped
+// even if the item takes the process down next time.
+func (s *deadLetterStore) add(item queue.Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[item.Key] = DeadLetter{
+		Key:      item.Key,
+		Kind:     item.Kind,
+		Attempts: item.Attempts,
+		Error:    item.Error,
+		DeadAt:   time.Now().UTC(),
+	}
+
+	return state.Save(deadLettersStateName, s.entries)
+}
+
+// DeadLetters returns the dead-letter list, oldest first.
+func DeadLetters() ([]DeadLetter, error) {
+	s, err := loadDeadLetterStore()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(s.entries))
+	for _, letter := range s.entries {
+		letters = append(letters, letter)
+	}
+
+	sort.Slice(letters, func(i, j int) bool { return letters[i].DeadAt.Before(letters[j].DeadAt) })
+
+	return letters, nil
+}
+
+// ClearDeadLetters removes keys from the dead-letter list, or everything if
+// keys is empty. It returns how many were removed.
+func ClearDeadLetters(keys []string) (int, error) {
+	s, err := loadDeadLetterStore()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for key := range s.entries {
+		if len(keys) == 0 || contains(keys, key) {
+			delete(s.entries, key)
+
+			removed++
+		}
+	}
+
+	return removed, state.Save(deadLettersStateName, s.entries)
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func crawlQueuePath() string {
+	return filepath.Join(viper.GetString("DATADIR"), "queue", "crawl.jsonl")
+}
+
+func maxAttempts() int {
+	if n := viper.GetInt("CRAWL_MAX_ATTEMPTS"); n > 0 {
+		return n
+	}
+
+	return defaultMaxAttempts
+}
+
+func publisherKey(publisher common.Publisher) string {
+	orgURL := publisher.Organization
+
+	return kindPublisher + ":" + publisher.ID + ":" + orgURL.String()
+}
+
+func repositoryKey(repository common.Repository) string {
+	return kindRepository + ":" + repository.CanonicalURL.String()
+}
+
+// startQueue starts a fresh crawl queue for publishers.
+func (c *Crawler) startQueue(publishers []common.Publisher) error {
+	q, err := queue.Create(crawlQueuePath(), maxAttempts())
+	if err != nil {
+		return err
+	}
+
+	c.queue = q
+
+	for _, publisher := range publishers {
+		if _, err := q.Add(kindPublisher, publisherKey(publisher), publisher); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resume continues the last crawl where it stopped: publishers that weren't
+// scanned completely are scanned again, and repositories found but not
+// processed are processed. Failed items are retried. The crawl is partial, see
+// Partial.
+func (c *Crawler) Resume() error {
+	unlock, err := c.lockDataDir()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	q, err := queue.Open(crawlQueuePath(), maxAttempts())
+	if err != nil {
+		return err
+	}
+
+	c.queue = q
+	c.Partial = true
+
+	var publishers []common.Publisher
+
+	for _, item := range q.Remaining(kindPublisher) {
+		var publisher common.Publisher
+		if err := item.Decode(&publisher); err != nil {
+			return err
+		}
+
+		publishers = append(publishers, publisher)
+	}
+
+	var repositories []common.Repository
+
+	for _, item := range q.Remaining(kindRepository) {
+		var repository common.Repository
+		if err := item.Decode(&repository); err != nil {
+			return err
+		}
+
+		repositories = append(repositories, repository)
+	}
+
+	for _, item := range q.Dead() {
+		if !c.deadLetters.has(item.Key) {
+			if err := c.deadLetters.add(item); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	log.Infof("Resuming crawl: %d publishers and %d repositories left", len(publishers), len(repositories))
+
+	if err := checkGitHubAuth(publishers, repositories); err != nil {
+		return err
+	}
+
+	return c.crawlPublishers(publishers, repositories)
+}
+
+// repositoryOutput returns the channel for a publisher's scanners. With a
+// queue, repositories are queued before they're passed on, and flush waits
+// until all of them are: only then the publisher is done.
+func (c *Crawler) repositoryOutput() (chan common.Repository, func()) {
+	if c.queue == nil {
+		return c.repositories, func() {}
+	}
+
+	found := make(chan common.Repository)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for repository := range found {
+			// The payload is written to disk: leave out request headers.
+			queued := repository
+			queued.Headers = nil
+
+			if _, err := c.queue.Add(kindRepository, repositoryKey(repository), queued); err != nil {
+				log.Error(err)
+			}
+
+			c.repositories <- repository
+		}
+	}()
+
+	return found, func() {
+		close(found)
+		<-done
+	}
+}
+
+// scanQueuedPublisher scans the publisher, tracking it in the queue if any. If
+// the scan fails, the publisher is retried by the next resume until it reaches
+// the maximum number of attempts and moves to the dead-letter list, like a
+// repository. Publishers on the dead-letter list are skipped.
+func (c *Crawler) scanQueuedPublisher(publisher common.Publisher) {
+	if c.queue == nil {
+		c.scanPublisherRecovering(publisher, func(error) {})
+
+		return
+	}
+
+	key := publisherKey(publisher)
+
+	if c.deadLetters.has(key) {
+		log.Warnf("[%s] skipping, it's on the dead-letter list", publisher.Name)
+
+		return
+	}
+
+	if started, err := c.queue.Start(key); err != nil {
+		log.Error(err)
+	} else if !started {
+		return
+	}
+
+	c.scanPublisherRecovering(publisher, func(err error) {
+		c.finishQueuedItem(publisher.Name, key, err)
+	})
+}
+
+// processQueuedRepo processes the repository, tracking it in the queue if any.
+// It stays running in the queue until its update was sent to the API or, if the
+// API didn't accept it, stored in the outbox, which retries it from then on. If
+// processing fails, it's retried by the next resume until it reaches the
+// maximum number of attempts and moves to the dead-letter list. Repositories on
+// the dead-letter list are skipped.
+func (c *Crawler) processQueuedRepo(repository common.Repository) {
+	if c.queue == nil {
+		c.processRepoRecovering(repository, func(error) {})
+
+		return
+	}
+
+	key := repositoryKey(repository)
+
+	if c.deadLetters.has(key) {
+		log.Warnf("[%s] skipping, it's on the dead-letter list", repository.Name)
+
+		return
+	}
+
+	if started, err := c.queue.Start(key); err != nil {
+		log.Error(err)
+	} else if !started {
+		return
+	}
+
+	c.processRepoRecovering(repository, func(err error) {
+		c.finishQueuedItem(repository.Name, key, err)
+	})
+}
+
+// finishQueuedItem marks the queue item key of the publisher or repository
+// called name done, or failed with err.
+func (c *Crawler) finishQueuedItem(name, key string, err error) {
+	if err == nil {
+		if err := c.queue.Done(key); err != nil {
+			log.Error(err)
+		}
+
+		return
+	}
+
+	item, err := c.queue.Fail(key, err)
+	if err != nil {
+		log.Error(err)
+
+		return
+	}
+
+	if item.Status == queue.StatusDead {
+		log.Errorf("[%s] failed %d times, moved to the dead-letter list", name, item.Attempts)
+
+		if err := c.deadLetters.add(item); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// processRepoRecovering runs ProcessRepo, turning a panic into an error for
+// done so one bad repository can't take the crawl down. done is called once.
+func (c *Crawler) processRepoRecovering(repository common.Repository, done func(error)) {
+	var once sync.Once
+
+	finish := func(err error) { once.Do(func() { done(err) }) }
+
+	defer recoverPanic(repository.Name, finish)
+
+	c.ProcessRepo(repository, finish)
+}
+
+// scanPublisherRecovering runs ScanPublisher like processRepoRecovering runs
+// ProcessRepo: a panic in the publisher worker becomes an error for done, which
+// is called once.
+func (c *Crawler) scanPublisherRecovering(publisher common.Publisher, done func(error)) {
+	var once sync.Once
+
+	finish := func(err error) { once.Do(func() { done(err) }) }
+
+	defer recoverPanic(publisher.Name, finish)
+
+	finish(c.ScanPublisher(publisher))
+}
+
+// recoverPanic turns a panic while scanning the publisher or processing the
+// repository called name into an error for done. It must be deferred.
+func recoverPanic(name string, done func(error)) {
+	if r := recover(); r != nil {
+		log.Errorf("[%s] panic: %v", name, r)
+
+		done(fmt.Errorf("panic: %v", r))
+	}
+}
+
+// doneAfter returns a func that calls done once it was called n times, with the
+// first error it got.
+func doneAfter(n int, done func(error)) func(error) {
+	var (
+		mu    sync.Mutex
+		first error
+	)
+
+	return func(err error) {
+		mu.Lock()
+
+		n--
+		if first == nil {
+			first = err
+		}
+
+		last := n == 0
+
+		mu.Unlock()
+
+		if last {
+			done(first)
+		}
+	}
+}
+
+// closeQueue closes the queue after a crawl. A crawl that went through
+// every item leaves nothing to resume.
+func (c *Crawler) closeQueue() {
+	if c.queue == nil {
+		return
+	}
+
+	if err := c.queue.Close(); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	internalurl "github.com/developer-overheid-nl/don-crawler/internal"
+	"github.com/developer-overheid-nl/don-crawler/internal/queue"
+	"github.com/developer-overheid-nl/don-crawler/scanner"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingScanner panics when it scans an organization.
+type panickingScanner struct {
+	scanner.Scanner
+}
+
+func (panickingScanner) ScanGroupOfRepos(url.URL, common.Publisher, chan common.Repository) error {
+	panic("boom")
+}
+
+func TestScanQueuedPublisherFailsUntilDead(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	viper.Set("CRAWL_MAX_ATTEMPTS", 2)
+
+	defer viper.Set("DATADIR", "")
+	defer viper.Set("CRAWL_MAX_ATTEMPTS", 0)
+
+	deadLetters, err := loadDeadLetterStore()
+	require.NoError(t, err)
+
+	c := &Crawler{repositories: make(chan common.Repository), deadLetters: deadLetters}
+
+	// Scanning an organization on an unsupported platform fails.
+	orgURL, err := url.Parse("https://example.org/acme")
+	require.NoError(t, err)
+
+	publisher := common.Publisher{ID: "acme", Name: "Acme", Organization: internalurl.URL(*orgURL)}
+	key := publisherKey(publisher)
+
+	require.NoError(t, c.startQueue([]common.Publisher{publisher}))
+
+	defer c.closeQueue()
+
+	c.scanQueuedPublisher(publisher)
+
+	remaining := c.queue.Remaining(kindPublisher)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, queue.StatusFailed, remaining[0].Status)
+	assert.Contains(t, remaining[0].Error, "unsupported code hosting platform")
+	assert.False(t, c.deadLetters.has(key))
+
+	c.scanQueuedPublisher(publisher)
+
+	assert.Empty(t, c.queue.Remaining(kindPublisher))
+	require.Len(t, c.queue.Dead(), 1)
+	assert.True(t, c.deadLetters.has(key))
+
+	// Once it's on the dead-letter list, it's skipped.
+	c.closeQueue()
+	require.NoError(t, c.startQueue([]common.Publisher{publisher}))
+	c.scanQueuedPublisher(publisher)
+
+	assert.Equal(t, queue.StatusPending, c.queue.Remaining(kindPublisher)[0].Status)
+}
+
+func TestScanQueuedPublisherRecoversFromPanics(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	deadLetters, err := loadDeadLetterStore()
+	require.NoError(t, err)
+
+	c := &Crawler{
+		repositories:  make(chan common.Repository),
+		deadLetters:   deadLetters,
+		gitHubScanner: panickingScanner{},
+	}
+
+	orgURL, err := url.Parse("https://github.com/acme")
+	require.NoError(t, err)
+
+	publisher := common.Publisher{ID: "acme", Name: "Acme", Organization: internalurl.URL(*orgURL)}
+
+	// Without a queue the panic is only logged.
+	assert.NotPanics(t, func() { c.scanQueuedPublisher(publisher) })
+
+	require.NoError(t, c.startQueue([]common.Publisher{publisher}))
+
+	defer c.closeQueue()
+
+	assert.NotPanics(t, func() { c.scanQueuedPublisher(publisher) })
+
+	remaining := c.queue.Remaining(kindPublisher)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, queue.StatusFailed, remaining[0].Status)
+	assert.Equal(t, "panic: boom", remaining[0].Error)
+}
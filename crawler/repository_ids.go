@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+const repositoryIDsStateName = "repository-ids"
+
+// repositoryIDs maps the code hosting platform's stable repository IDs to the
+// location a repository was last crawled at, so renames and transfers can be
+// detected.
+type repositoryIDs struct {
+	mu      sync.Mutex
+	entries map[string]repositoryIDEntry
+}
+
+type repositoryIDEntry struct {
+	// URL is the canonical URL the repository is registered with.
+	URL string `json:"url"`
+	// Host and Name locate the clone in DATADIR/repos.
+	Host string `json:"host"`
+	Name string `json:"name"`
+}
+
+func loadRepositoryIDs() (*repositoryIDs, error) {
+	ids := &repositoryIDs{}
+
+	if err := state.Load(repositoryIDsStateName, &ids.entries); err != nil {
+		return nil, err
+	}
+
+	if ids.entries == nil {
+		ids.entries = make(map[string]repositoryIDEntry)
+	}
+
+	return ids, nil
+}
+
+func repositoryIDKey(repository common.Repository) string {
+	if repository.ProviderID == "" {
+		return ""
+	}
+
+	return repository.CanonicalURL.Host + "/" + repository.ProviderID
+}
+
+// previous returns where the repository was found last time, if it has moved since.
+func (r *repositoryIDs) previous(repository common.Repository) (repositoryIDEntry, bool) {
+	key := repositoryIDKey(repository)
+	if key == "" {
+		return repositoryIDEntry{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok || entry.URL == repository.CanonicalURL.String() {
+		return repositoryIDEntry{}, false
+	}
+
+	return entry, true
+}
+
+// record stores the current location of the repository.
+func (r *repositoryIDs) record(repository common.Repository) {
+	key := repositoryIDKey(repository)
+	if key == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[key] = repositoryIDEntry{
+		URL:  repository.CanonicalURL.String(),
+		Host: repository.URL.Host,
+		Name: repository.Name,
+	}
+}
+
+func (r *repositoryIDs) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return state.Save(repositoryIDsStateName, r.entries)
+}
+
+// handleRename detects whether the repository was renamed or transferred since
+// the last crawl. If so it moves the clone to the new location and returns the
+// URL the register still knows the repository by.
+func (c *Crawler) handleRename(repository common.Repository, logEntries *[]string) *string {
+	previous, ok := c.repositoryIDs.previous(repository)
+	if !ok {
+		return nil
+	}
+
+	*logEntries = append(
+		*logEntries,
+		fmt.Sprintf("[%s] renamed or transferred from %s", repository.Name, previous.URL),
+	)
+
+	unlock := c.repoLocks.lock(repoLockKey(repository))
+	err := git.MoveClone(previous.Host, previous.Name, repository.URL.Host, repository.Name)
+
+	unlock()
+
+	if err != nil {
+		log.Warnf("[%s] can't move clone from %s: %v", repository.Name, previous.Name, err)
+	} else {
+		c.cloneCache.Forget(previous.Host, previous.Name)
+	}
+
+	return &previous.URL
+}
@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRepository(t *testing.T, name string) common.Repository {
+	t.Helper()
+
+	u, err := url.Parse("https://github.com/" + name)
+	require.NoError(t, err)
+
+	canonical, err := url.Parse("https://github.com/" + name + ".git")
+	require.NoError(t, err)
+
+	return common.Repository{
+		Name:         name,
+		ProviderID:   "42",
+		URL:          *u,
+		CanonicalURL: *canonical,
+	}
+}
+
+func TestHandleRenameMovesCloneAndReturnsPreviousURL(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	oldRepo := testRepository(t, "old-org/repo")
+	newRepo := testRepository(t, "new-org/renamed")
+
+	oldClone := git.ClonePath("github.com", oldRepo.Name)
+	require.NoError(t, os.MkdirAll(oldClone, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(oldClone, "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	ids, err := loadRepositoryIDs()
+	require.NoError(t, err)
+
+	cache, err := git.OpenCloneCache()
+	require.NoError(t, err)
+
+	c := &Crawler{repositoryIDs: ids, cloneCache: cache}
+
+	var logEntries []string
+
+	assert.Nil(t, c.handleRename(oldRepo, &logEntries))
+	ids.record(oldRepo)
+	assert.Nil(t, c.handleRename(oldRepo, &logEntries))
+
+	previousURL := c.handleRename(newRepo, &logEntries)
+	require.NotNil(t, previousURL)
+	assert.Equal(t, "https://github.com/old-org/repo.git", *previousURL)
+
+	assert.NoDirExists(t, oldClone)
+	assert.NoDirExists(t, filepath.Join(viper.GetString("DATADIR"), "repos", "github.com", "old-org"))
+	assert.FileExists(t, filepath.Join(git.ClonePath("github.com", newRepo.Name), "HEAD"))
+
+	require.NoError(t, ids.save())
+
+	reloaded, err := loadRepositoryIDs()
+	require.NoError(t, err)
+
+	previous, ok := reloaded.previous(newRepo)
+	require.True(t, ok)
+	assert.Equal(t, "old-org/repo", previous.Name)
+}
+
+func TestRepoLockKeyUsesProviderID(t *testing.T) {
+	assert.Equal(t, "github.com#42", repoLockKey(testRepository(t, "org/repo")))
+
+	repo := testRepository(t, "org/repo")
+	repo.ProviderID = ""
+	assert.Equal(t, "github.com/org/repo", repoLockKey(repo))
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/sbom"
+	"github.com/spf13/viper"
+)
+
+// processDependencies reads the dependency manifests from the clone of the
+// repository, writes its SBOM when SBOM_GENERATION is set and matches the
+// dependencies against the OSV database in OSV_DIR, if any.
+func (c *Crawler) processDependencies(repository common.Repository, logEntries *[]string) {
+	components, err := sbom.ReadRepository(repository)
+	if err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] can't read dependency manifests: %v", repository.Name, err))
+
+		return
+	}
+
+	if viper.GetBool("SBOM_GENERATION") {
+		c.writeSBOM(repository, components, logEntries)
+	}
+
+	if viper.GetString("OSV_DIR") != "" {
+		c.matchVulnerabilities(repository, components, logEntries)
+	}
+}
+
+// writeSBOM stores a CycloneDX SBOM of components under DATADIR/sbom. With
+// SBOM_POST it's also sent to the API.
+func (c *Crawler) writeSBOM(repository common.Repository, components []sbom.Component, logEntries *[]string) {
+	doc := sbom.CycloneDX(repository, components)
+
+	if err := sbom.Save(repository, doc); err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] %v", repository.Name, err))
+
+		return
+	}
+
+	*logEntries = append(
+		*logEntries,
+		fmt.Sprintf("[%s] SBOM with %d dependencies written to %s", repository.Name, len(components), sbom.Path(repository)),
+	)
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.Dependencies = len(components)
+		r.SBOM = sbom.Path(repository)
+	})
+
+	if !viper.GetBool("SBOM_POST") {
+		return
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] can't marshal SBOM: %v", repository.Name, err))
+
+		return
+	}
+
+	if err := c.apiClient.PostSBOM(apiclient.SBOMRequest{
+		RepositoryURL: repository.CanonicalURL.String(),
+		Format:        doc.BOMFormat,
+		SpecVersion:   doc.SpecVersion,
+		SBOM:          raw,
+	}); err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] %v", repository.Name, err))
+	}
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"math"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+)
+
+// scoreCheck is a recommended part of publiccode.yml. Name is the key
+// reported when it's missing.
+type scoreCheck struct {
+	name string
+	ok   func(*publiccodeFile) bool
+}
+
+// scoreChecks go beyond what validation requires: they're what makes an entry
+// in the register useful. Every check weighs the same.
+var scoreChecks = []scoreCheck{
+	{"logo", func(f *publiccodeFile) bool { return f.Logo != "" }},
+	{"landingURL", func(f *publiccodeFile) bool { return f.LandingURL != "" }},
+	{"roadmap", func(f *publiccodeFile) bool { return f.Roadmap != "" }},
+	{"releaseDate", func(f *publiccodeFile) bool { return f.ReleaseDate != "" }},
+	{"softwareVersion", func(f *publiccodeFile) bool { return f.SoftwareVersion != "" }},
+	{"platforms", func(f *publiccodeFile) bool { return len(f.Platforms) > 0 }},
+	{"categories", func(f *publiccodeFile) bool { return len(f.Categories) > 0 }},
+	{"developmentStatus", func(f *publiccodeFile) bool { return f.DevelopmentStatus != "" }},
+	{"softwareType", func(f *publiccodeFile) bool { return f.SoftwareType != "" }},
+	{"legal.license", func(f *publiccodeFile) bool { return f.Legal.License != "" }},
+	{"legal.mainCopyrightOwner", func(f *publiccodeFile) bool { return f.Legal.MainCopyrightOwner != "" }},
+	{"description.nl", func(f *publiccodeFile) bool { return hasDescription(f, "nl") }},
+	{"description.en", func(f *publiccodeFile) bool { return hasDescription(f, "en") }},
+	{"description.*.features", func(f *publiccodeFile) bool {
+		return anyDescription(f, func(d publiccodeDescription) bool { return len(d.Features) > 0 })
+	}},
+	{"description.*.documentation", func(f *publiccodeFile) bool {
+		return anyDescription(f, func(d publiccodeDescription) bool { return d.Documentation != "" })
+	}},
+	{"description.*.screenshots", func(f *publiccodeFile) bool {
+		return anyDescription(f, func(d publiccodeDescription) bool { return len(d.Screenshots) > 0 })
+	}},
+	{"localisation.availableLanguages", func(f *publiccodeFile) bool {
+		return len(f.Localisation.AvailableLanguages) > 0
+	}},
+	{"maintenance.contacts", hasMaintenanceContact},
+}
+
+// scorePubliccode rates how complete publiccode.yml is, from 0 to 100. A
+// missing file scores 0.
+func scorePubliccode(file *publiccodeFile) report.Score {
+	if file == nil {
+		return report.Score{Value: 0, Missing: []string{report.MissingPubliccode}}
+	}
+
+	var missing []string
+
+	for _, check := range scoreChecks {
+		if !check.ok(file) {
+			missing = append(missing, check.name)
+		}
+	}
+
+	passed := len(scoreChecks) - len(missing)
+
+	return report.Score{
+		Value:   int(math.Round(100 * float64(passed) / float64(len(scoreChecks)))),
+		Missing: missing,
+	}
+}
+
+// hasDescription tells whether there's a short and long description in lang,
+// also accepting regional variants like nl-NL.
+func hasDescription(file *publiccodeFile, lang string) bool {
+	for key, d := range file.Description {
+		if !strings.EqualFold(key, lang) && !strings.HasPrefix(strings.ToLower(key), lang+"-") {
+			continue
+		}
+
+		if strings.TrimSpace(d.ShortDescription) != "" && strings.TrimSpace(d.LongDescription) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func anyDescription(file *publiccodeFile, ok func(publiccodeDescription) bool) bool {
+	for _, d := range file.Description {
+		if ok(d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasMaintenanceContact tells whether someone can be reached about the
+// software: a contact for internal or community maintenance, a contractor for
+// contract maintenance.
+func hasMaintenanceContact(file *publiccodeFile) bool {
+	switch file.Maintenance.Type {
+	case "contract":
+		return len(file.Maintenance.Contractors) > 0
+	case "internal", "community":
+		for _, contact := range file.Maintenance.Contacts {
+			if contact.Email != "" || contact.Phone != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScorePubliccode(t *testing.T) {
+	assert.Equal(t, report.Score{Value: 0, Missing: []string{"publiccode.yml"}}, scorePubliccode(nil))
+
+	file, err := parsePubliccode([]byte(`
+publiccodeYmlVersion: "0.4"
+name: Zaakregistratie
+url: https://github.com/example/zaken
+landingURL: https://zaken.example.org
+logo: logo.svg
+releaseDate: "2026-01-01"
+softwareVersion: 1.2.0
+platforms: [web]
+categories: [case-management]
+developmentStatus: stable
+softwareType: standalone/web
+description:
+  nl-NL:
+    shortDescription: Zaken registreren
+    longDescription: Een lange beschrijving.
+    features: [Zaken]
+    documentation: https://docs.example.org
+legal:
+  license: EUPL-1.2
+maintenance:
+  type: internal
+  contacts:
+    - name: Team Zaken
+localisation:
+  availableLanguages: [nl]
+`))
+	require.NoError(t, err)
+
+	score := scorePubliccode(file)
+	assert.Equal(t, []string{
+		"roadmap",
+		"legal.mainCopyrightOwner",
+		"description.en",
+		"description.*.screenshots",
+		"maintenance.contacts",
+	}, score.Missing)
+	assert.Equal(t, 72, score.Value)
+
+	file.Maintenance.Contacts[0].Email = "zaken@example.org"
+	assert.NotContains(t, scorePubliccode(file).Missing, "maintenance.contacts")
+}
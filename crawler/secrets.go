@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/developer-overheid-nl/don-crawler/secrets"
+	"github.com/spf13/viper"
+)
+
+const secretsStateName = "secrets"
+
+// secretStore keeps the secrets found per repository, keyed by canonical URL,
+// together with who to contact about them. It's private to the crawler's state
+// directory and never sent to the register.
+type secretStore struct {
+	mu      sync.Mutex
+	entries map[string]secretEntry
+}
+
+type secretEntry struct {
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	// OrganisationURL is the contact of the organisation owning the repository.
+	OrganisationURL string            `json:"organisation_url,omitempty"`
+	FirstSeen       time.Time         `json:"first_seen"`
+	LastScanned     time.Time         `json:"last_scanned"`
+	Findings        []secrets.Finding `json:"findings"`
+}
+
+func loadSecretStore() (*secretStore, error) {
+	s := &secretStore{}
+
+	if err := state.Load(secretsStateName, &s.entries); err != nil {
+		return nil, err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]secretEntry)
+	}
+
+	return s, nil
+}
+
+// set replaces the findings for the repository. Repositories without findings
+// are dropped, so resolved leaks disappear from the store.
+func (s *secretStore) set(repository common.Repository, findings []secrets.Finding) {
+	key := repository.CanonicalURL.String()
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(findings) == 0 {
+		delete(s.entries, key)
+
+		return
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry.FirstSeen = now
+	}
+
+	entry.Name = repository.Name
+	entry.Publisher = repository.Publisher.ID
+	entry.OrganisationURL = repository.Publisher.OrganisationURL
+	entry.LastScanned = now
+	entry.Findings = findings
+
+	s.entries[key] = entry
+}
+
+func (s *secretStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return state.Save(secretsStateName, s.entries)
+}
+
+// scanSecrets looks for leaked credentials in the clone of the repository,
+// including the last SECRET_SCAN_HISTORY_DAYS days of history. Findings go to
+// the secret store and the crawl report only; the log just gets a count so the
+// secrets don't end up in CI output.
+func (c *Crawler) scanSecrets(repository common.Repository, logEntries *[]string) {
+	history := time.Duration(viper.GetInt("SECRET_SCAN_HISTORY_DAYS")) * 24 * time.Hour
+
+	findings, err := secrets.Scan(repository, history)
+	if err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] can't scan for secrets: %v", repository.Name, err))
+
+		// The findings in HEAD still replace the earlier ones.
+		if !errors.Is(err, secrets.ErrHistory) {
+			return
+		}
+	}
+
+	c.secrets.set(repository, findings)
+
+	if len(findings) == 0 {
+		return
+	}
+
+	*logEntries = append(*logEntries, fmt.Sprintf(
+		"[%s] %d possible secrets found, see %s", repository.Name, len(findings), state.Path(secretsStateName),
+	))
+
+	found := make([]report.Secret, 0, len(findings))
+	for _, f := range findings {
+		found = append(found, report.Secret{
+			Rule:        f.Rule,
+			Path:        f.Path,
+			Line:        f.Line,
+			Commit:      f.Commit,
+			Redacted:    f.Redacted,
+			Fingerprint: f.Fingerprint,
+		})
+	}
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.OrganisationURL = repository.Publisher.OrganisationURL
+		r.Secrets = found
+	})
+}
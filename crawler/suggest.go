@@ -0,0 +1,308 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alranel/go-vcsurl/v2"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/developer-overheid-nl/don-crawler/scanner"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	draftPubliccodeYmlVersion = "0.4"
+	// Limits from the publiccode.yml standard.
+	longDescriptionMinLength = 150
+	longDescriptionMaxLength = 10000
+)
+
+// ErrHasPubliccode is returned by SuggestPubliccode for repositories that
+// already have a publiccode.yml.
+var ErrHasPubliccode = errors.New("repository already has a publiccode.yml")
+
+// publiccodeCategories are the categories defined by the publiccode.yml
+// standard. Repository topics matching one are used as categories.
+var publiccodeCategories = []string{
+	"accounting", "agile-project-management", "applicant-tracking", "application-development",
+	"appointment-scheduling", "backup", "billing-and-invoicing", "blog", "budgeting", "business-intelligence",
+	"business-process-management", "cad", "call-center-management", "cloud-management", "collaboration",
+	"communications", "compliance-management", "contact-management", "content-management", "crm",
+	"customer-service-and-support", "data-analytics", "data-collection", "data-visualization",
+	"digital-asset-management", "digital-citizenship", "document-management", "donor-management",
+	"e-commerce", "e-signature", "email-management", "email-marketing", "employee-management",
+	"enterprise-project-management", "enterprise-social-networking", "erp", "event-management",
+	"facility-management", "feedback-and-reviews-management", "financial-reporting", "fleet-management",
+	"fundraising", "gamification", "geographic-information-systems", "grant-management", "graphic-design",
+	"help-desk", "hr", "ide", "identity-management", "instant-messaging", "inventory-management",
+	"it-asset-management", "it-development", "it-management", "it-security", "it-service-management",
+	"knowledge-management", "learning-management-system", "marketing", "mind-mapping", "mobile-marketing",
+	"mobile-payment", "network-management", "office", "online-booking", "online-community",
+	"payment-gateway", "payroll", "predictive-analysis", "procurement", "productivity-suite",
+	"project-collaboration", "project-management", "property-management", "real-estate-management",
+	"remote-support", "resource-management", "sales-management", "seo", "service-desk",
+	"social-media-management", "survey", "talent-management", "task-management", "taxes-management",
+	"test-management", "time-management", "time-tracking", "translation", "video-conferencing",
+	"video-editing", "visitor-management", "voip", "warehouse-management", "web-collaboration",
+	"web-conferencing", "website-builder", "whistleblowing", "workflow-management",
+}
+
+// SuggestPubliccode drafts a publiccode.yml for the repository at repoURL,
+// which must not have one yet. The repository is cloned into DATADIR/repos.
+func (c *Crawler) SuggestPubliccode(repoURL string, publisher common.Publisher) ([]byte, error) {
+	repository, err := c.scanRepository(repoURL, publisher)
+	if err != nil {
+		return nil, err
+	}
+
+	if repository.FileRawURL != "" {
+		return nil, fmt.Errorf("%s: %w", repoURL, ErrHasPubliccode)
+	}
+
+	return c.draftFromClone(repository)
+}
+
+// draftFromClone clones the repository and drafts its publiccode.yml.
+func (c *Crawler) draftFromClone(repository common.Repository) ([]byte, error) {
+	if err := c.cloneRepository(repository); err != nil {
+		return nil, err
+	}
+
+	if repository.License == "" {
+		if license, err := git.DetectLicense(repository); err == nil {
+			repository.License = license
+		}
+	}
+
+	return draftPubliccodeYAML(repository)
+}
+
+// scanRepository fetches what the code hosting platform knows about the
+// repository at repoURL.
+func (c *Crawler) scanRepository(repoURL string, publisher common.Publisher) (common.Repository, error) {
+	u, err := url.Parse(strings.TrimSuffix(repoURL, ".git"))
+	if err != nil {
+		return common.Repository{}, fmt.Errorf("invalid repository URL %s: %w", repoURL, err)
+	}
+
+	var sc scanner.Scanner
+
+	switch {
+	case vcsurl.IsGitHub(u):
+		sc = c.gitHubScanner
+	case vcsurl.IsBitBucket(u):
+		sc = c.bitBucketScanner
+	case vcsurl.IsGitLab(u):
+		sc = c.gitLabScanner
+	default:
+		return common.Repository{}, fmt.Errorf("unsupported code hosting platform for %s", repoURL)
+	}
+
+	repositories := make(chan common.Repository, 1)
+
+	if err := sc.ScanRepo(*u, publisher, repositories); err != nil {
+		return common.Repository{}, err
+	}
+
+	select {
+	case repository := <-repositories:
+		return repository, nil
+	default:
+		return common.Repository{}, fmt.Errorf("repository %s was skipped by the scanner", repoURL)
+	}
+}
+
+// writeSuggestion stores a draft publiccode.yml for a repository without one
+// under DATADIR/suggestions and links it from the crawl report.
+func (c *Crawler) writeSuggestion(repository common.Repository, logEntries *[]string) {
+	draft, err := draftPubliccodeYAML(repository)
+	if err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] can't draft publiccode.yml: %v", repository.Name, err))
+
+		return
+	}
+
+	path := suggestionPath(repository)
+
+	if err := state.WriteFile(path, draft); err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] %v", repository.Name, err))
+
+		return
+	}
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.Suggestion = path
+	})
+}
+
+// suggestionPath returns where the draft publiccode.yml of the repository is
+// stored: DATADIR/suggestions/<host>/<vendor>/<repo>/publiccode.yml.
+func suggestionPath(repository common.Repository) string {
+	return filepath.Join(
+		viper.GetString("DATADIR"), "suggestions", repository.URL.Host, filepath.FromSlash(repository.Name),
+		"publiccode.yml",
+	)
+}
+
+// draftPubliccodeYAML drafts publiccode.yml from what the crawler knows about
+// the repository and its clone, with a header listing what to review.
+func draftPubliccodeYAML(repository common.Repository) ([]byte, error) {
+	var readmeName, readme string
+
+	if name, contents, err := git.ReadReadme(repository); err == nil {
+		readmeName, readme = name, contents
+	} else if !errors.Is(err, git.ErrReadmeNotFound) {
+		return nil, err
+	}
+
+	var (
+		tag         string
+		releaseDate time.Time
+	)
+
+	if name, date, err := git.LatestTag(repository); err == nil {
+		tag, releaseDate = name, date
+	} else if !errors.Is(err, git.ErrNoTags) {
+		return nil, err
+	}
+
+	file, review := draftPubliccode(repository, readmeName, readme, tag, releaseDate)
+
+	var out bytes.Buffer
+
+	out.WriteString("# Concept voor publiccode.yml, ingevuld op basis van de repository.\n")
+	out.WriteString("# Zie https://yml.publiccode.tools voor de betekenis van alle velden.\n")
+
+	if len(review) > 0 {
+		out.WriteString("# Controleer of vul aan: " + strings.Join(review, ", ") + ".\n")
+	}
+
+	if repository.Publisher.OrganisationURL != "" {
+		out.WriteString("# Organisatie: " + repository.Publisher.OrganisationURL + "\n")
+	}
+
+	out.WriteString("\n")
+
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(file); err != nil {
+		return nil, fmt.Errorf("can't marshal publiccode.yml: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("can't marshal publiccode.yml: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// draftPubliccode fills in publiccode.yml. Required keys the crawler can't
+// know get a plausible value; they're returned as keys to review.
+func draftPubliccode(
+	repository common.Repository, readmeName, readme, tag string, releaseDate time.Time,
+) (*publiccodeFile, []string) {
+	lang := descriptionLanguage()
+	review := []string{"platforms", "softwareType"}
+
+	name := repository.Title
+	if name == "" {
+		name = titleFromRepositoryName(repository)
+	}
+
+	file := &publiccodeFile{
+		PubliccodeYmlVersion: draftPubliccodeYmlVersion,
+		Name:                 name,
+		URL:                  repository.CanonicalURL.String(),
+		Platforms:            []string{"web"},
+		SoftwareType:         "standalone/other",
+		DevelopmentStatus:    "development",
+		Legal:                publiccodeLegal{License: repository.License},
+		Localisation: publiccodeLocalisation{
+			AvailableLanguages: []string{lang},
+		},
+	}
+
+	if tag != "" {
+		file.SoftwareVersion = strings.TrimPrefix(tag, "v")
+		file.ReleaseDate = releaseDate.Format(time.DateOnly)
+		file.DevelopmentStatus = "stable"
+	}
+
+	review = append(review, "developmentStatus")
+
+	for _, topic := range repository.Topics {
+		if slices.Contains(publiccodeCategories, topic) && !slices.Contains(file.Categories, topic) {
+			file.Categories = append(file.Categories, topic)
+		}
+	}
+
+	if len(file.Categories) == 0 {
+		file.Categories = []string{"it-development"}
+
+		review = append(review, "categories")
+	}
+
+	if file.Legal.License == "" {
+		review = append(review, "legal.license")
+	}
+
+	description := publiccodeDescription{ShortDescription: repository.Description}
+	if description.ShortDescription == "" && readme != "" {
+		description.ShortDescription = descriptionFromReadme(readmeName, readme)
+	}
+
+	if description.ShortDescription == "" {
+		description.ShortDescription = name
+
+		review = append(review, "description."+lang+".shortDescription")
+	}
+
+	if readme != "" {
+		description.LongDescription = longDescriptionFromReadme(readmeName, readme, longDescriptionMaxLength)
+	}
+
+	if utf8.RuneCountInString(description.LongDescription) < longDescriptionMinLength {
+		if description.LongDescription == "" {
+			description.LongDescription = description.ShortDescription
+		}
+
+		review = append(review, "description."+lang+".longDescription")
+	}
+
+	description.Features = []string{description.ShortDescription}
+	review = append(review, "description."+lang+".features")
+
+	file.Description = map[string]publiccodeDescription{lang: description}
+
+	file.Maintenance = publiccodeMaintenance{Type: "internal"}
+
+	if publisher := repository.Publisher.Name; publisher != "" {
+		file.Legal.MainCopyrightOwner = publisher
+		file.Maintenance.Contacts = []publiccodeContact{{Name: publisher, Affiliation: publisher}}
+	} else {
+		file.Maintenance.Contacts = []publiccodeContact{{Name: repositoryOwner(repository.Name)}}
+	}
+
+	review = append(review, "maintenance.contacts")
+
+	return file, review
+}
+
+// repositoryOwner returns the owner of a repository named owner/repo.
+func repositoryOwner(name string) string {
+	owner, _ := common.SplitFullName(name)
+
+	return owner
+}
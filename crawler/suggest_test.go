@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDraftPubliccode(t *testing.T) {
+	u, err := url.Parse("https://github.com/gemeente-a/zaken")
+	require.NoError(t, err)
+
+	readme := "# Zaken\n\n" +
+		"Zaken is een applicatie waarmee gemeenten zaken registreren en afhandelen.\n\n" +
+		"Het ondersteunt de landelijke standaarden voor zaakgericht werken, " +
+		"zodat gegevens eenvoudig met andere systemen kunnen worden gedeeld.\n\n" +
+		"## Installatie\n\nDraai `make install` om te beginnen met de installatie.\n"
+
+	file, review := draftPubliccode(common.Repository{
+		Name:         "gemeente-a/zaken",
+		Title:        "zaken",
+		CanonicalURL: *u,
+		License:      "EUPL-1.2",
+		Topics:       []string{"case-management", "document-management", "golang"},
+		Publisher:    common.Publisher{ID: "a", Name: "Gemeente A"},
+	}, "README.md", readme, "v1.4.0", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, "0.4", file.PubliccodeYmlVersion)
+	assert.Equal(t, "zaken", file.Name)
+	assert.Equal(t, "https://github.com/gemeente-a/zaken", file.URL)
+	assert.Equal(t, "1.4.0", file.SoftwareVersion)
+	assert.Equal(t, "2026-03-01", file.ReleaseDate)
+	assert.Equal(t, "stable", file.DevelopmentStatus)
+	assert.Equal(t, []string{"document-management"}, file.Categories)
+	assert.Equal(t, "EUPL-1.2", file.Legal.License)
+	assert.Equal(t, "Gemeente A", file.Legal.MainCopyrightOwner)
+	assert.Equal(t, "Gemeente A", file.Maintenance.Contacts[0].Name)
+	assert.Equal(t, []string{"nl"}, file.Localisation.AvailableLanguages)
+
+	description := file.Description["nl"]
+	assert.Equal(t, "Zaken is een applicatie waarmee gemeenten zaken registreren en afhandelen.", description.ShortDescription)
+	assert.True(t, strings.HasPrefix(description.LongDescription, description.ShortDescription+"\n\nHet ondersteunt"))
+	assert.NotContains(t, description.LongDescription, "make install")
+
+	assert.NotContains(t, review, "categories")
+	assert.NotContains(t, review, "legal.license")
+	assert.NotContains(t, review, "description.nl.longDescription")
+	assert.Contains(t, review, "maintenance.contacts")
+
+	out, err := yaml.Marshal(file)
+	require.NoError(t, err)
+
+	var parsed map[string]any
+	require.NoError(t, yaml.Unmarshal(out, &parsed))
+	assert.NotContains(t, parsed, "landingURL")
+	assert.Equal(t, false, parsed["localisation"].(map[string]any)["localisationReady"])
+}
+
+func TestDraftPubliccodeWithoutReadme(t *testing.T) {
+	file, review := draftPubliccode(common.Repository{Name: "gemeente-a/tool"}, "", "", "", time.Time{})
+
+	assert.Equal(t, "tool", file.Name)
+	assert.Equal(t, "development", file.DevelopmentStatus)
+	assert.Empty(t, file.ReleaseDate)
+	assert.Equal(t, []string{"it-development"}, file.Categories)
+	assert.Equal(t, "gemeente-a", file.Maintenance.Contacts[0].Name)
+	assert.Subset(t, review, []string{"categories", "legal.license", "description.nl.shortDescription"})
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/apiclient"
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/report"
+	"github.com/developer-overheid-nl/don-crawler/osv"
+	"github.com/developer-overheid-nl/don-crawler/sbom"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// osvDatabase returns the OSV database in OSV_DIR, loading it on first use. It
+// returns nil if it can't be loaded.
+func (c *Crawler) osvDatabase() *osv.Database {
+	c.osvOnce.Do(func() {
+		db, err := osv.Load(viper.GetString("OSV_DIR"))
+		if err != nil {
+			log.Errorf("vulnerability matching disabled: %v", err)
+
+			return
+		}
+
+		c.osv = db
+	})
+
+	return c.osv
+}
+
+// matchVulnerabilities looks up components in the offline OSV database and
+// records the vulnerabilities found in the report and the API.
+func (c *Crawler) matchVulnerabilities(
+	repository common.Repository, components []sbom.Component, logEntries *[]string,
+) {
+	db := c.osvDatabase()
+	if db == nil {
+		return
+	}
+
+	findings := db.Match(components)
+
+	found := make([]report.Vulnerability, 0, len(findings))
+	vulnerabilities := make([]apiclient.Vulnerability, 0, len(findings))
+
+	for _, f := range findings {
+		id := f.ID
+		if len(f.Aliases) > 0 {
+			id += " (" + strings.Join(f.Aliases, ", ") + ")"
+		}
+
+		*logEntries = append(*logEntries, fmt.Sprintf(
+			"[%s] %s %s %s in %s is affected by %s", repository.Name, f.Ecosystem, f.Package, f.Version, f.Source, id,
+		))
+
+		found = append(found, report.Vulnerability{
+			ID:            f.ID,
+			Aliases:       f.Aliases,
+			Summary:       f.Summary,
+			Ecosystem:     f.Ecosystem,
+			Package:       f.Package,
+			Version:       f.Version,
+			FixedVersions: f.FixedVersions,
+			Source:        f.Source,
+		})
+		vulnerabilities = append(vulnerabilities, apiclient.Vulnerability{
+			ID:            f.ID,
+			Aliases:       f.Aliases,
+			Summary:       f.Summary,
+			Ecosystem:     f.Ecosystem,
+			Package:       f.Package,
+			Version:       f.Version,
+			FixedVersions: f.FixedVersions,
+		})
+	}
+
+	c.report.Update(repository, func(r *report.Repository) {
+		r.Vulnerabilities = found
+	})
+
+	if err := c.apiClient.PostVulnerabilities(apiclient.VulnerabilitiesRequest{
+		RepositoryURL:   repository.CanonicalURL.String(),
+		Vulnerabilities: vulnerabilities,
+	}); err != nil {
+		*logEntries = append(*logEntries, fmt.Sprintf("[%s] %v", repository.Name, err))
+	}
+}
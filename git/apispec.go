@@ -0,0 +1,153 @@
+package git
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// maxAPISpecs caps the number of specifications read from a single repository.
+const maxAPISpecs = 25
+
+// API specification types.
+const (
+	APISpecOpenAPI  = "openapi"
+	APISpecAsyncAPI = "asyncapi"
+)
+
+// APISpec is an OpenAPI or AsyncAPI specification found in a repository.
+type APISpec struct {
+	// Path is relative to the repository root.
+	Path string
+	// Type is APISpecOpenAPI or APISpecAsyncAPI; Swagger 2.0 counts as OpenAPI.
+	Type string
+	// SpecVersion is the version of the specification format, e.g. 3.0.3.
+	SpecVersion string
+	Title       string
+	Version     string
+}
+
+type apiSpecDocument struct {
+	OpenAPI  string `yaml:"openapi"`
+	Swagger  string `yaml:"swagger"`
+	AsyncAPI string `yaml:"asyncapi"`
+	Info     struct {
+		Title   string `yaml:"title"`
+		Version string `yaml:"version"`
+	} `yaml:"info"`
+}
+
+// FindAPISpecs returns the API specifications in the HEAD tree of the bare
+// clone: files named like openapi.yaml, swagger.json or asyncapi.yml anywhere
+// in the tree, plus extraPaths (e.g. referenced from publiccode.yml). Files that
+// aren't a specification are skipped.
+func FindAPISpecs(repository common.Repository, extraPaths []string) ([]APISpec, error) {
+	clonePath, names, err := headTreeFileNames(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	inTree := make(map[string]bool, len(names))
+	for _, name := range names {
+		inTree[name] = true
+	}
+
+	candidates := make(map[string]bool)
+
+	for _, name := range names {
+		if isAPISpecName(name) {
+			candidates[name] = true
+		}
+	}
+
+	for _, extra := range extraPaths {
+		if p := path.Clean(strings.TrimLeft(extra, "/")); inTree[p] {
+			candidates[p] = true
+		}
+	}
+
+	paths := make([]string, 0, len(candidates))
+	for p := range candidates {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	var specs []APISpec
+
+	for _, p := range paths {
+		if len(specs) >= maxAPISpecs {
+			log.Debugf("[%s] more than %d API specifications, ignoring the rest", repository.Name, maxAPISpecs)
+
+			break
+		}
+
+		contents, err := readHeadFile(clonePath, p)
+		if err != nil {
+			return specs, err
+		}
+
+		if spec, ok := parseAPISpec(p, contents); ok {
+			specs = append(specs, spec)
+		}
+	}
+
+	return specs, nil
+}
+
+func isAPISpecName(name string) bool {
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		if dir == "node_modules" || dir == "vendor" {
+			return false
+		}
+	}
+
+	base := strings.ToLower(path.Base(name))
+	ext := path.Ext(base)
+
+	switch ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return false
+	}
+
+	stem := strings.TrimSuffix(base, ext)
+
+	switch stem {
+	case "openapi", "swagger", "asyncapi":
+		return true
+	}
+
+	return strings.HasSuffix(stem, ".openapi") || strings.HasSuffix(stem, ".asyncapi")
+}
+
+// parseAPISpec parses contents as an OpenAPI, Swagger or AsyncAPI document.
+func parseAPISpec(name, contents string) (APISpec, bool) {
+	var doc apiSpecDocument
+	if err := yaml.Unmarshal([]byte(contents), &doc); err != nil {
+		return APISpec{}, false
+	}
+
+	spec := APISpec{
+		Path:    name,
+		Title:   strings.TrimSpace(doc.Info.Title),
+		Version: strings.TrimSpace(doc.Info.Version),
+	}
+
+	switch {
+	case doc.OpenAPI != "":
+		spec.Type, spec.SpecVersion = APISpecOpenAPI, doc.OpenAPI
+	case doc.Swagger != "":
+		spec.Type, spec.SpecVersion = APISpecOpenAPI, doc.Swagger
+	case doc.AsyncAPI != "":
+		spec.Type, spec.SpecVersion = APISpecAsyncAPI, doc.AsyncAPI
+	default:
+		return APISpec{}, false
+	}
+
+	return spec, true
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAPISpecName(t *testing.T) {
+	assert.True(t, isAPISpecName("openapi.yaml"))
+	assert.True(t, isAPISpecName("api/v1/Swagger.json"))
+	assert.True(t, isAPISpecName("docs/asyncapi.yml"))
+	assert.True(t, isAPISpecName("specs/zaken.openapi.yaml"))
+	assert.False(t, isAPISpecName("openapi.md"))
+	assert.False(t, isAPISpecName("package.json"))
+	assert.False(t, isAPISpecName("node_modules/foo/openapi.json"))
+	assert.False(t, isAPISpecName("vendor/github.com/foo/swagger.yaml"))
+}
+
+func TestParseAPISpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     APISpec
+		ok       bool
+	}{
+		{
+			name:     "openapi yaml",
+			contents: "openapi: 3.0.3\ninfo:\n  title: Zaken API\n  version: 1.5.0\n",
+			want:     APISpec{Path: "f", Type: APISpecOpenAPI, SpecVersion: "3.0.3", Title: "Zaken API", Version: "1.5.0"},
+			ok:       true,
+		},
+		{
+			name:     "swagger json",
+			contents: `{"swagger": "2.0", "info": {"title": "Oud", "version": "1"}}`,
+			want:     APISpec{Path: "f", Type: APISpecOpenAPI, SpecVersion: "2.0", Title: "Oud", Version: "1"},
+			ok:       true,
+		},
+		{
+			name:     "unquoted swagger version",
+			contents: "swagger: 2.0\ninfo:\n  title: Oud\n  version: 1.0\n",
+			want:     APISpec{Path: "f", Type: APISpecOpenAPI, SpecVersion: "2.0", Title: "Oud", Version: "1.0"},
+			ok:       true,
+		},
+		{
+			name:     "asyncapi",
+			contents: "asyncapi: 2.6.0\ninfo:\n  title: Events\n  version: 0.1.0\n",
+			want:     APISpec{Path: "f", Type: APISpecAsyncAPI, SpecVersion: "2.6.0", Title: "Events", Version: "0.1.0"},
+			ok:       true,
+		},
+		{
+			name:     "not a spec",
+			contents: `{"name": "package", "version": "1.0.0"}`,
+		},
+		{
+			name:     "invalid",
+			contents: "{",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseAPISpec("f", tc.contents)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
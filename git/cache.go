@@ -0,0 +1,390 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const cloneCacheStateName = "clone-cache"
+
+// Reasons a clone gets removed by CloneCache.GC.
+const (
+	EvictOrphaned = "orphaned"
+	EvictExpired  = "expired"
+	EvictSize     = "size"
+)
+
+// CloneCache keeps track of when the clones under DATADIR/repos were last used,
+// so clones of repositories that left the publisher list or were renamed can be
+// garbage collected.
+type CloneCache struct {
+	mu    sync.Mutex
+	index cloneCacheIndex
+}
+
+type cloneCacheIndex struct {
+	// Run is the number of crawl runs recorded so far.
+	Run    int                        `json:"run"`
+	Clones map[string]cloneCacheEntry `json:"clones"`
+}
+
+type cloneCacheEntry struct {
+	LastUsed time.Time `json:"last_used"`
+	LastRun  int       `json:"last_run"`
+}
+
+// GCPolicy describes which clones CloneCache.GC removes. Zero values disable
+// the corresponding rule.
+type GCPolicy struct {
+	// MaxSize is the maximum total size in bytes of all clones. The least
+	// recently used clones are removed until the total fits.
+	MaxSize int64
+	// MaxAge removes clones that haven't been used for longer than this.
+	MaxAge time.Duration
+	// OrphanRuns removes clones that weren't seen in the last OrphanRuns crawls.
+	OrphanRuns int
+}
+
+// GCRemoval is a single clone removed (or, in dry-run mode, that would be removed).
+type GCRemoval struct {
+	Key    string
+	Reason string
+	Size   int64
+}
+
+// GCResult summarizes a CloneCache.GC run.
+type GCResult struct {
+	Removed   []GCRemoval
+	Reclaimed int64
+	Remaining int64
+}
+
+type cachedClone struct {
+	key      string
+	size     int64
+	lastUsed time.Time
+	lastRun  int
+}
+
+// OpenCloneCache loads the clone cache index from the state directory.
+func OpenCloneCache() (*CloneCache, error) {
+	c := &CloneCache{}
+
+	if err := state.Load(cloneCacheStateName, &c.index); err != nil {
+		return nil, err
+	}
+
+	if c.index.Clones == nil {
+		c.index.Clones = make(map[string]cloneCacheEntry)
+	}
+
+	return c, nil
+}
+
+// GCPolicyFromEnv builds a GCPolicy from CACHE_MAX_SIZE, CACHE_MAX_AGE_DAYS and
+// CACHE_ORPHAN_RUNS.
+func GCPolicyFromEnv() (GCPolicy, error) {
+	maxSize, err := ParseByteSize(viper.GetString("CACHE_MAX_SIZE"))
+	if err != nil {
+		return GCPolicy{}, fmt.Errorf("invalid CACHE_MAX_SIZE: %w", err)
+	}
+
+	return GCPolicy{
+		MaxSize:    maxSize,
+		MaxAge:     time.Duration(viper.GetInt("CACHE_MAX_AGE_DAYS")) * 24 * time.Hour,
+		OrphanRuns: viper.GetInt("CACHE_ORPHAN_RUNS"),
+	}, nil
+}
+
+// StartRun records the start of a new crawl run.
+func (c *CloneCache) StartRun() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index.Run++
+}
+
+// Touch marks the clone of the repository as used in the current run.
+func (c *CloneCache) Touch(hostname, name string) {
+	key, err := cloneCacheKey(ClonePath(hostname, name))
+	if err != nil {
+		log.Debugf("can't track clone %s/%s: %v", hostname, name, err)
+
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index.Clones[key] = cloneCacheEntry{
+		LastUsed: time.Now(),
+		LastRun:  c.index.Run,
+	}
+}
+
+// Forget drops the clone of the repository from the index, e.g. after it was moved.
+func (c *CloneCache) Forget(hostname, name string) {
+	key, err := cloneCacheKey(ClonePath(hostname, name))
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.index.Clones, key)
+}
+
+// Save writes the clone cache index to the state directory.
+func (c *CloneCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return state.Save(cloneCacheStateName, c.index)
+}
+
+// GC removes clones according to policy: first orphaned clones, then expired
+// ones and finally the least recently used until the total size fits MaxSize.
+// With dryRun it only reports what would be removed.
+func (c *CloneCache) GC(policy GCPolicy, dryRun bool) (GCResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result GCResult
+
+	clones, err := c.scan()
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	kept := make([]cachedClone, 0, len(clones))
+
+	for _, clone := range clones {
+		reason := ""
+
+		switch {
+		case policy.OrphanRuns > 0 && c.index.Run-clone.lastRun >= policy.OrphanRuns:
+			reason = EvictOrphaned
+		case policy.MaxAge > 0 && now.Sub(clone.lastUsed) > policy.MaxAge:
+			reason = EvictExpired
+		}
+
+		if reason == "" {
+			kept = append(kept, clone)
+			result.Remaining += clone.size
+
+			continue
+		}
+
+		if err := c.evict(clone, reason, dryRun, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if policy.MaxSize > 0 && result.Remaining > policy.MaxSize {
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].lastUsed.Before(kept[j].lastUsed)
+		})
+
+		for _, clone := range kept {
+			if result.Remaining <= policy.MaxSize {
+				break
+			}
+
+			if err := c.evict(clone, EvictSize, dryRun, &result); err != nil {
+				return result, err
+			}
+
+			result.Remaining -= clone.size
+		}
+	}
+
+	return result, nil
+}
+
+func (c *CloneCache) evict(clone cachedClone, reason string, dryRun bool, result *GCResult) error {
+	if !dryRun {
+		root := reposRoot()
+		dir := filepath.Join(root, clone.key)
+
+		// Only remove gitClone itself: with nested GitLab namespaces the
+		// parent directory can also hold clones of other repositories.
+		if err := os.RemoveAll(filepath.Join(dir, "gitClone")); err != nil {
+			return fmt.Errorf("can't remove clone %s: %w", clone.key, err)
+		}
+
+		removeEmptyParents(dir, root)
+		delete(c.index.Clones, clone.key)
+	}
+
+	result.Removed = append(result.Removed, GCRemoval{Key: clone.key, Reason: reason, Size: clone.size})
+	result.Reclaimed += clone.size
+
+	return nil
+}
+
+// scan walks DATADIR/repos and returns every clone found on disk. Clones that
+// aren't in the index are treated as never seen, using their mtime as last use.
+func (c *CloneCache) scan() ([]cachedClone, error) {
+	root := reposRoot()
+
+	var clones []cachedClone
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return filepath.SkipAll
+			}
+
+			return err
+		}
+
+		if !d.IsDir() || d.Name() != "gitClone" {
+			return nil
+		}
+
+		key, err := cloneCacheKey(path)
+		if err != nil {
+			return err
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		clone := cachedClone{key: key, size: size}
+
+		if entry, ok := c.index.Clones[key]; ok {
+			clone.lastUsed = entry.LastUsed
+			clone.lastRun = entry.LastRun
+		} else if info, err := d.Info(); err == nil {
+			clone.lastUsed = info.ModTime()
+		}
+
+		clones = append(clones, clone)
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't scan %s: %w", root, err)
+	}
+
+	return clones, nil
+}
+
+func reposRoot() string {
+	return filepath.Join(viper.GetString("DATADIR"), "repos")
+}
+
+// cloneCacheKey returns <hostname>/<vendor>/<repo> for a gitClone path.
+func cloneCacheKey(clonePath string) (string, error) {
+	rel, err := filepath.Rel(reposRoot(), filepath.Dir(clonePath))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+func removeEmptyParents(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ParseByteSize parses sizes like "500M", "20GB" or "1073741824". Units are
+// powers of 1024. An empty string means 0.
+func ParseByteSize(raw string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	if value == "" {
+		return 0, nil
+	}
+
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+
+		if multiplier > 1 {
+			value = value[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("can't parse size %q", raw)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatByteSize formats a size in bytes using the largest fitting 1024-based unit.
+func FormatByteSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
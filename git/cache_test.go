@@ -0,0 +1,103 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFakeClone(t *testing.T, hostname, name string, size int) {
+	t.Helper()
+
+	path := ClonePath(hostname, name)
+	require.NoError(t, os.MkdirAll(path, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "pack"), make([]byte, size), 0o644))
+}
+
+func TestCloneCacheGCRemovesOrphansAndLeastRecentlyUsed(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	writeFakeClone(t, "github.com", "org/old", 100)
+	writeFakeClone(t, "github.com", "org/stale", 100)
+	writeFakeClone(t, "gitlab.com", "group/sub/fresh", 100)
+
+	cache, err := OpenCloneCache()
+	require.NoError(t, err)
+
+	cache.StartRun()
+	cache.Touch("github.com", "org/old")
+	cache.Touch("github.com", "org/stale")
+
+	for range 3 {
+		cache.StartRun()
+		cache.Touch("github.com", "org/stale")
+		cache.Touch("gitlab.com", "group/sub/fresh")
+	}
+
+	require.NoError(t, cache.Save())
+
+	cache, err = OpenCloneCache()
+	require.NoError(t, err)
+
+	// Make "org/stale" less recently used than "group/sub/fresh".
+	cache.index.Clones["github.com/org/stale"] = cloneCacheEntry{
+		LastUsed: time.Now().Add(-time.Hour),
+		LastRun:  cache.index.Run,
+	}
+
+	result, err := cache.GC(GCPolicy{MaxSize: 150, OrphanRuns: 3}, false)
+	require.NoError(t, err)
+
+	require.Len(t, result.Removed, 2)
+	assert.Equal(t, GCRemoval{Key: "github.com/org/old", Reason: EvictOrphaned, Size: 100}, result.Removed[0])
+	assert.Equal(t, GCRemoval{Key: "github.com/org/stale", Reason: EvictSize, Size: 100}, result.Removed[1])
+	assert.Equal(t, int64(200), result.Reclaimed)
+	assert.Equal(t, int64(100), result.Remaining)
+
+	assert.NoDirExists(t, filepath.Join(viper.GetString("DATADIR"), "repos", "github.com"))
+	assert.DirExists(t, ClonePath("gitlab.com", "group/sub/fresh"))
+}
+
+func TestCloneCacheGCDryRunKeepsClones(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	writeFakeClone(t, "github.com", "org/repo", 10)
+
+	cache, err := OpenCloneCache()
+	require.NoError(t, err)
+
+	result, err := cache.GC(GCPolicy{MaxAge: time.Nanosecond}, true)
+	require.NoError(t, err)
+
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, EvictExpired, result.Removed[0].Reason)
+	assert.DirExists(t, ClonePath("github.com", "org/repo"))
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"":      0,
+		"1024":  1024,
+		"1K":    1 << 10,
+		"500MB": 500 << 20,
+		"20G":   20 << 30,
+		"2GiB":  2 << 30,
+		"1.5t":  3 << 39,
+	}
+
+	for raw, want := range tests {
+		got, err := ParseByteSize(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, got, raw)
+	}
+
+	_, err := ParseByteSize("lots")
+	assert.Error(t, err)
+}
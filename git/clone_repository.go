@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
 	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
@@ -26,8 +28,7 @@ func CloneRepository(hostname, name, gitURL, _ string) error {
 		return errors.New("cannot clone a repository without git URL")
 	}
 
-	vendor, repo := common.SplitFullName(name)
-	path := filepath.Join(viper.GetString("DATADIR"), "repos", hostname, vendor, repo, "gitClone")
+	path := ClonePath(hostname, name)
 
 	auth, err := withAuthToken(hostname, gitURL)
 	if err != nil {
@@ -70,27 +71,74 @@ func CloneRepository(hostname, name, gitURL, _ string) error {
 	return err
 }
 
-func withAuthToken(hostname, _ string) (transport.AuthMethod, error) {
+// ClonePath returns DATADIR/repos/<hostname>/<vendor>/<repo>/gitClone for the repository.
+func ClonePath(hostname, name string) string {
+	vendor, repo := common.SplitFullName(name)
+
+	return filepath.Join(viper.GetString("DATADIR"), "repos", hostname, vendor, repo, "gitClone")
+}
+
+// MoveClone moves the clone of a renamed or transferred repository to the path
+// matching its new name. It's a no-op if there's no clone at the old path. If a
+// clone already exists at the new path, the old one is removed instead.
+func MoveClone(oldHostname, oldName, newHostname, newName string) error {
+	oldPath := ClonePath(oldHostname, oldName)
+	newPath := ClonePath(newHostname, newName)
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		if err := os.RemoveAll(oldPath); err != nil {
+			return fmt.Errorf("cannot remove old clone: %w", err)
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(newPath), 0o744); err != nil {
+			return fmt.Errorf("cannot create clone directory: %w", err)
+		}
+
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return fmt.Errorf("cannot move clone: %w", err)
+		}
+	}
+
+	removeEmptyParents(filepath.Dir(oldPath), reposRoot())
+
+	return nil
+}
+
+func withAuthToken(hostname, gitURL string) (transport.AuthMethod, error) {
 	switch hostname {
 	case "github.com":
-		provider, err := githubapp.DefaultProvider()
+		auth, err := githubapp.DefaultAuth()
 		if err != nil {
-			return nil, fmt.Errorf("github app auth unavailable: %w", err)
+			return nil, fmt.Errorf("github auth unavailable: %w", err)
+		}
+
+		owner := ""
+		if u, err := url.Parse(gitURL); err == nil {
+			owner, _, _ = strings.Cut(strings.Trim(u.Path, "/"), "/")
 		}
 
-		if provider != nil {
-			token, _, err := provider.Token(context.Background())
-			if err != nil {
-				return nil, fmt.Errorf("github app token fetch failed: %w", err)
-			}
+		token, err := auth.Token(context.Background(), owner)
+		if err != nil {
+			return nil, fmt.Errorf("github token fetch failed: %w", err)
+		}
 
-			return &githttp.BasicAuth{
-				Username: "x-access-token",
-				Password: token,
-			}, nil
+		if token == "" {
+			//nolint
+			return nil, nil
 		}
 
-		return nil, errors.New("github app auth not configured for github.com")
+		return &githttp.BasicAuth{
+			Username: "x-access-token",
+			Password: token,
+		}, nil
 	case "gitlab.com":
 		//nolint
 		return nil, nil
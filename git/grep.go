@@ -0,0 +1,225 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+)
+
+// maxLineLength is the longest line AddedLines reads; longer lines, typically
+// minified or generated files, are skipped.
+const maxLineLength = 1 << 20
+
+// Line is a line of a file in the clone of a repository.
+type Line struct {
+	// Commit is the commit that added the line, empty for lines in HEAD.
+	Commit string
+	Path   string
+	Number int
+	Text   string
+}
+
+// GrepHead returns the lines in the HEAD tree of the bare clone matching any
+// of the POSIX extended regular expressions in patterns. Binary files are
+// skipped.
+func GrepHead(repository common.Repository, patterns []string) ([]Line, error) {
+	path, err := clonePath(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-C", path, "grep", "-I", "-n", "-z", "-E", "--no-color"}
+	for _, pattern := range patterns {
+		args = append(args, "-e", pattern)
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("git", append(args, "HEAD", "--")...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// git grep exits with 1 when nothing matches.
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cannot grep repository: %s: %w", stderr.String(), err)
+	}
+
+	var lines []Line
+
+	for _, record := range strings.Split(string(out), "\n") {
+		// With -z the output is HEAD:<path>\0<line number>\0<text>.
+		fields := strings.SplitN(record, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		number, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+
+		lines = append(lines, Line{
+			Path:   strings.TrimPrefix(fields[0], "HEAD:"),
+			Number: number,
+			Text:   fields[2],
+		})
+	}
+
+	return lines, nil
+}
+
+// AddedLines returns the lines added by the commits reachable from HEAD since
+// the given time for which match returns true.
+func AddedLines(repository common.Repository, since time.Time, match func(string) bool) ([]Line, error) {
+	path, err := clonePath(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(
+		"git", "-C", path, "log", "-p", "-U0", "--no-color", "--no-renames", "--no-ext-diff",
+		"--format=commit %H", "--since="+since.Format(time.RFC3339), "HEAD",
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot read history: %w", err)
+	}
+
+	lines, scanErr := scanAddedLines(stdout, match)
+	if scanErr != nil {
+		// Stop git, it would otherwise block writing the rest of the log.
+		_ = cmd.Process.Kill()
+	}
+
+	if err := cmd.Wait(); err != nil && scanErr == nil {
+		return lines, fmt.Errorf("cannot read history: %w", err)
+	}
+
+	return lines, scanErr
+}
+
+// scanAddedLines parses the output of git log -p -U0.
+func scanAddedLines(r io.Reader, match func(string) bool) ([]Line, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+
+	var (
+		lines  []Line
+		commit string
+		file   string
+		number int
+		// header is true between a diff line and the first hunk of a file.
+		header bool
+	)
+
+	for {
+		text, truncated, err := readLine(reader)
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+
+		if err != nil {
+			return lines, fmt.Errorf("cannot read history: %w", err)
+		}
+
+		switch {
+		case strings.HasPrefix(text, "commit "):
+			commit = strings.TrimPrefix(text, "commit ")
+			file = ""
+		case strings.HasPrefix(text, "diff --git "):
+			file = ""
+			header = true
+		case header && strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(text, "@@ "):
+			number = hunkStart(text)
+			header = false
+		case !header && strings.HasPrefix(text, "+") && file != "":
+			if added := text[1:]; !truncated && match(added) {
+				lines = append(lines, Line{Commit: commit, Path: file, Number: number, Text: added})
+			}
+
+			number++
+		}
+	}
+}
+
+// readLine returns the next line of r without its line ending. Of a line
+// longer than maxLineLength only the start is returned, with truncated set.
+func readLine(r *bufio.Reader) (string, bool, error) {
+	var (
+		line      []byte
+		truncated bool
+	)
+
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", false, err
+		}
+
+		if room := maxLineLength - len(line); len(chunk) > room {
+			chunk = chunk[:room]
+			truncated = true
+		}
+
+		line = append(line, chunk...)
+
+		if !isPrefix {
+			return string(line), truncated, nil
+		}
+	}
+}
+
+// hunkStart returns the first line number in the new file of a hunk header
+// like "@@ -1,2 +3,4 @@".
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0
+	}
+
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+func clonePath(repository common.Repository) (string, error) {
+	if repository.Name == "" {
+		return "", errors.New("cannot read files without repository name")
+	}
+
+	path := ClonePath(repository.URL.Host, repository.Name)
+
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
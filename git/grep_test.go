@@ -0,0 +1,36 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanAddedLinesSkipsOverlongLines(t *testing.T) {
+	log := "commit abc\n" +
+		"diff --git a/app.min.js b/app.min.js\n" +
+		"--- /dev/null\n" +
+		"+++ b/app.min.js\n" +
+		"@@ -0,0 +1,2 @@\n" +
+		"+" + strings.Repeat("x", maxLineLength+10) + "\n" +
+		"+token=secret\n" +
+		"commit def\n" +
+		"diff --git a/.env b/.env\n" +
+		"--- a/.env\n" +
+		"+++ b/.env\n" +
+		"@@ -3 +3 @@\n" +
+		"-token=old\n" +
+		"+token=new\n"
+
+	lines, err := scanAddedLines(strings.NewReader(log), func(text string) bool {
+		return strings.Contains(text, "token=")
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Line{
+		{Commit: "abc", Path: "app.min.js", Number: 2, Text: "token=secret"},
+		{Commit: "def", Path: ".env", Number: 3, Text: "token=new"},
+	}, lines)
+}
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// headFileNames returns the path of the bare clone of the repository and the
+// names of the files in the root of its HEAD tree.
+func headFileNames(repository common.Repository) (string, []string, error) {
+	return listHead(repository, false)
+}
+
+// headTreeFileNames is like headFileNames but lists the whole HEAD tree, with
+// paths relative to the repository root.
+func headTreeFileNames(repository common.Repository) (string, []string, error) {
+	return listHead(repository, true)
+}
+
+func listHead(repository common.Repository, recursive bool) (string, []string, error) {
+	path, err := clonePath(repository)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// -z lists names as they are, not quoted or escaped, separated by NUL.
+	args := []string{"-C", path, "ls-tree", "--name-only", "-z"}
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	out, err := exec.Command("git", append(args, "HEAD")...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", nil, fmt.Errorf("cannot list repository files: %s: %w", exitErr.Stderr, err)
+		}
+
+		return "", nil, fmt.Errorf("cannot list repository files: %w", err)
+	}
+
+	var names []string
+
+	for name := range strings.SplitSeq(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return path, names, nil
+}
+
+// readHeadFile returns the contents of name in the HEAD tree of the clone at path.
+func readHeadFile(path, name string) (string, error) {
+	out, err := exec.Command("git", "-C", path, "show", "HEAD:"+name).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %s: %w", name, out, err)
+	}
+
+	return string(out), nil
+}
+
+// File is a file read from the HEAD tree of a clone.
+type File struct {
+	// Path is relative to the repository root.
+	Path     string
+	Contents string
+}
+
+// ReadHeadFiles returns the files in the HEAD tree of the bare clone for which
+// match returns true, at most limit of them.
+func ReadHeadFiles(repository common.Repository, match func(path string) bool, limit int) ([]File, error) {
+	clonePath, names, err := headTreeFileNames(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+
+	for _, name := range names {
+		if !match(name) {
+			continue
+		}
+
+		if len(files) >= limit {
+			log.Debugf("[%s] more than %d matching files, ignoring the rest", repository.Name, limit)
+
+			break
+		}
+
+		contents, err := readHeadFile(clonePath, name)
+		if err != nil {
+			return files, err
+		}
+
+		files = append(files, File{Path: name, Contents: contents})
+	}
+
+	return files, nil
+}
+
+// ErrNoTags is returned by LatestTag for clones without tags.
+var ErrNoTags = errors.New("no tags")
+
+// LatestTag returns the most recently created tag in the bare clone and the
+// date it points to, which is taken as the latest release.
+func LatestTag(repository common.Repository) (string, time.Time, error) {
+	path, err := clonePath(repository)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	out, err := exec.Command(
+		"git", "-C", path, "for-each-ref", "--sort=-creatordate", "--count=1",
+		"--format=%(refname:short) %(creatordate:iso-strict)", "refs/tags",
+	).CombinedOutput()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot list tags: %s: %w", out, err)
+	}
+
+	name, date, ok := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if !ok {
+		return "", time.Time{}, ErrNoTags
+	}
+
+	created, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot parse date of tag %s: %w", name, err)
+	}
+
+	return name, created, nil
+}
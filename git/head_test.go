@@ -0,0 +1,54 @@
+package git
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadTreeFileNamesKeepsNamesAsIs(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	repoURL, err := url.Parse("https://github.com/acme/zaken")
+	require.NoError(t, err)
+
+	repository := common.Repository{Name: "acme/zaken", URL: *repoURL}
+	path := ClonePath(repoURL.Host, repository.Name)
+
+	names := []string{"api spec.yaml", "docs/openapi ë.yaml", "line\nbreak.yaml", " padded.yaml"}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "docs"), 0o755))
+
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(path, name), []byte("openapi: 3.0.0\n"), 0o600))
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.org", "commit", "-q", "-m", "Add specs"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", path}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	_, listed, err := headTreeFileNames(repository)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, names, listed)
+
+	_, listed, err = headFileNames(repository)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"api spec.yaml", "docs", "line\nbreak.yaml", " padded.yaml"}, listed)
+
+	files, err := ReadHeadFiles(repository, func(string) bool { return true }, len(names))
+	require.NoError(t, err)
+	require.Len(t, files, len(names))
+}
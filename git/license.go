@@ -0,0 +1,161 @@
+package git
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+)
+
+// ErrLicenseNotFound is returned when the repository has no recognisable license file at the root.
+var ErrLicenseNotFound = errors.New("license not found")
+
+var spdxIdentifierRe = regexp.MustCompile(`(?i)SPDX-License-Identifier:\s*([A-Za-z0-9.+-]+)`)
+
+// licenseHeadLines is how many non-empty lines at the top of a license file
+// are searched for its title.
+const licenseHeadLines = 5
+
+// licenseFingerprint matches the text of a license. All phrases must appear in
+// the lowercased, whitespace-normalised license text.
+type licenseFingerprint struct {
+	spdxID string
+	// title is set if the phrases are the title of the license, which is then
+	// looked for at the top of the file first. Full license texts mention
+	// other licenses: the GPL-3.0 for one names the AGPL-3.0.
+	title   bool
+	phrases []string
+}
+
+// licenseFingerprints is ordered from most to least specific, so that e.g. the
+// LGPL is tried before the GPL whose text it references.
+var licenseFingerprints = []licenseFingerprint{
+	{"EUPL-1.2", true, []string{"european union public licence", "v. 1.2"}},
+	{"EUPL-1.2", true, []string{"european union public licence", "v.1.2"}},
+	{"EUPL-1.1", true, []string{"european union public licence", "v.1.1"}},
+	{"EUPL-1.1", true, []string{"european union public licence", "v. 1.1"}},
+	{"AGPL-3.0", true, []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", true, []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", true, []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", true, []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", true, []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", true, []string{"mozilla public license", "version 2.0"}},
+	{"Apache-2.0", true, []string{"apache license", "version 2.0"}},
+	{"BSD-3-Clause", false, []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", false, []string{"redistribution and use in source and binary forms"}},
+	{"MIT", false, []string{"permission is hereby granted, free of charge"}},
+	{"ISC", false, []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"Unlicense", false, []string{"this is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", false, []string{"cc0 1.0 universal"}},
+}
+
+// DetectLicense returns the SPDX identifier of the license file in the root of
+// the repository's bare clone.
+func DetectLicense(repository common.Repository) (string, error) {
+	path, names, err := headFileNames(repository)
+	if err != nil {
+		return "", err
+	}
+
+	name := pickLicenseName(names)
+	if name == "" {
+		return "", ErrLicenseNotFound
+	}
+
+	contents, err := readHeadFile(path, name)
+	if err != nil {
+		return "", err
+	}
+
+	if id := licenseFromText(contents); id != "" {
+		return id, nil
+	}
+
+	return "", ErrLicenseNotFound
+}
+
+func pickLicenseName(names []string) string {
+	for _, prefix := range []string{"license", "licence", "copying"} {
+		for _, name := range names {
+			lower := strings.ToLower(name)
+			if lower == prefix || strings.HasPrefix(lower, prefix+".") {
+				return name
+			}
+		}
+	}
+
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "license") || strings.HasPrefix(lower, "licence") {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// licenseFromText returns the SPDX identifier for a license text, or an empty
+// string. A license title at the top of the text wins over phrases further
+// down, so that license notices, which name the license anywhere, are
+// recognised too.
+func licenseFromText(text string) string {
+	if m := spdxIdentifierRe.FindStringSubmatch(text); m != nil {
+		return common.NormalizeSPDXID(m[1])
+	}
+
+	if id := matchFingerprints(licenseHead(text), true); id != "" {
+		return id
+	}
+
+	return matchFingerprints(normalizeLicenseText(text), false)
+}
+
+// licenseHead returns the first licenseHeadLines non-empty lines of text,
+// normalised like normalizeLicenseText.
+func licenseHead(text string) string {
+	var head []string
+
+	for line := range strings.Lines(text) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		head = append(head, line)
+		if len(head) == licenseHeadLines {
+			break
+		}
+	}
+
+	return normalizeLicenseText(strings.Join(head, " "))
+}
+
+func normalizeLicenseText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// matchFingerprints returns the SPDX identifier of the first fingerprint
+// found in the normalised text, only trying titles if titlesOnly is set.
+func matchFingerprints(normalized string, titlesOnly bool) string {
+	for _, fingerprint := range licenseFingerprints {
+		if titlesOnly && !fingerprint.title {
+			continue
+		}
+
+		matches := true
+
+		for _, phrase := range fingerprint.phrases {
+			if !strings.Contains(normalized, phrase) {
+				matches = false
+
+				break
+			}
+		}
+
+		if matches {
+			return fingerprint.spdxID
+		}
+	}
+
+	return ""
+}
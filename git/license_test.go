@@ -0,0 +1,86 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLicenseFromText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "spdx identifier",
+			text: "// SPDX-License-Identifier: eupl-1.2\n",
+			want: "EUPL-1.2",
+		},
+		{
+			name: "eupl",
+			text: "EUROPEAN UNION PUBLIC LICENCE v. 1.2\nEUPL © the European Union 2007, 2016",
+			want: "EUPL-1.2",
+		},
+		{
+			name: "lgpl before gpl",
+			text: "GNU LESSER GENERAL PUBLIC LICENSE\n   Version 3, 29 June 2007\n\n" +
+				"This version of the GNU Lesser General Public License incorporates\n" +
+				"the terms and conditions of version 3 of the GNU General Public License",
+			want: "LGPL-3.0",
+		},
+		{
+			name: "apache",
+			text: "                                 Apache License\n                           Version 2.0, January 2004",
+			want: "Apache-2.0",
+		},
+		{
+			name: "mit",
+			text: "MIT License\n\nPermission is hereby granted, free of charge, to any person obtaining a copy",
+			want: "MIT",
+		},
+		{
+			name: "unknown",
+			text: "All rights reserved.",
+			want: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, licenseFromText(tc.text))
+		})
+	}
+}
+
+func TestLicenseFromFullTexts(t *testing.T) {
+	// Each full text names other licenses of the family further down.
+	for _, id := range []string{"GPL-3.0", "AGPL-3.0", "LGPL-3.0", "GPL-2.0", "LGPL-2.1"} {
+		t.Run(id, func(t *testing.T) {
+			text, err := os.ReadFile(filepath.Join("testdata", "licenses", id+".txt"))
+			require.NoError(t, err)
+
+			assert.Equal(t, id, licenseFromText(string(text)))
+		})
+	}
+}
+
+func TestLicenseFromNotice(t *testing.T) {
+	notice := "Copyright (C) 2026 Gemeente Voorbeeld\n\n" +
+		"This program is free software: you can redistribute it and/or modify\n" +
+		"it under the terms of the GNU Affero General Public License as published\n" +
+		"by the Free Software Foundation, either version 3 of the License, or\n" +
+		"(at your option) any later version.\n"
+
+	assert.Equal(t, "AGPL-3.0", licenseFromText(notice))
+}
+
+func TestPickLicenseName(t *testing.T) {
+	assert.Equal(t, "LICENSE.md", pickLicenseName([]string{"README.md", "LICENSE.md", "LICENSES"}))
+	assert.Equal(t, "COPYING", pickLicenseName([]string{"COPYING", "main.go"}))
+	assert.Equal(t, "LICENSE-EUPL", pickLicenseName([]string{"LICENSE-EUPL"}))
+	assert.Empty(t, pickLicenseName([]string{"README.md"}))
+}
@@ -2,52 +2,33 @@ package git
 
 import (
 	"errors"
-	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
-	"github.com/spf13/viper"
 )
 
 // ErrReadmeNotFound is returned when the repository has no README at the root.
 var ErrReadmeNotFound = errors.New("readme not found")
 
-// ReadReadme returns the contents of a repository README from the bare clone.
-func ReadReadme(repository common.Repository) (string, error) {
-	if repository.Name == "" {
-		return "", errors.New("cannot read readme without repository name")
-	}
-
-	vendor, repo := common.SplitFullName(repository.Name)
-	path := filepath.Join(viper.GetString("DATADIR"), "repos", repository.URL.Host, vendor, repo, "gitClone")
-
-	if _, err := os.Stat(path); err != nil {
-		return "", err
-	}
-
-	out, err := exec.Command("git", "-C", path, "ls-tree", "--name-only", "HEAD").CombinedOutput()
+// ReadReadme returns the file name and contents of a repository README from the bare clone.
+func ReadReadme(repository common.Repository) (string, string, error) {
+	path, names, err := headFileNames(repository)
 	if err != nil {
-		return "", fmt.Errorf("cannot list repository files: %s: %w", out, err)
+		return "", "", err
 	}
 
-	readmePath := pickReadmeName(strings.Split(string(out), "\n"))
+	readmePath := pickReadmeName(names)
 	if readmePath == "" {
-		return "", ErrReadmeNotFound
+		return "", "", ErrReadmeNotFound
 	}
 
-	out, err = exec.Command("git", "-C", path, "show", "HEAD:"+readmePath).CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("cannot read %s: %s: %w", readmePath, out, err)
-	}
+	contents, err := readHeadFile(path, readmePath)
 
-	return string(out), nil
+	return readmePath, contents, err
 }
 
 func pickReadmeName(names []string) string {
-	preferred := []string{"README.md", "README.rst", "README.txt", "README"}
+	preferred := []string{"README.md", "README.rst", "README.adoc", "README.txt", "README"}
 	byLower := make(map[string]string, len(names))
 
 	for _, name := range names {
@@ -3,7 +3,6 @@ package git
 import (
 	"errors"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
@@ -12,7 +11,6 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -44,8 +42,7 @@ func CalculateRepoActivity(repository common.Repository, days int) (float64, map
 		return 0, nil, errors.New("activity days must be at least 1")
 	}
 
-	vendor, repo := common.SplitFullName(repository.Name)
-	path := filepath.Join(viper.GetString("DATADIR"), "repos", repository.URL.Host, vendor, repo, "gitClone")
+	path := ClonePath(repository.URL.Host, repository.Name)
 
 	if _, err := os.Stat(path); err != nil {
 		return 0, nil, err
@@ -279,8 +276,7 @@ func LastCommitTime(repository common.Repository) (time.Time, error) {
 		return time.Time{}, errors.New("cannot determine last activity without repository name")
 	}
 
-	vendor, repo := common.SplitFullName(repository.Name)
-	path := filepath.Join(viper.GetString("DATADIR"), "repos", repository.URL.Host, vendor, repo, "gitClone")
+	path := ClonePath(repository.URL.Host, repository.Name)
 
 	if _, err := os.Stat(path); err != nil {
 		return time.Time{}, err
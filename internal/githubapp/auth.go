@@ -0,0 +1,318 @@
+package githubapp
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/rsajwt"
+	log "github.com/sirupsen/logrus"
+)
+
+// Auth picks the credentials for a GitHub request: the installation of the
+// GitHub App on the account the request is about, the App installation in
+// GIT_OAUTH_INSTALLATION_ID, a personal access token (GITHUB_TOKEN), or none,
+// in that order. Anonymous requests are limited to 60 an hour.
+type Auth struct {
+	baseURL string
+	client  *http.Client
+
+	// appID and privateKey are set if a GitHub App is configured.
+	appID               int64
+	privateKey          *rsa.PrivateKey
+	defaultInstallation int64
+	pat                 string
+
+	mu sync.Mutex
+	// installations maps lowercase account names to their installation ID, 0
+	// if the App isn't installed there.
+	installations map[string]int64
+
+	providersMu sync.Mutex
+	providers   map[int64]*TokenProvider
+}
+
+var (
+	defaultAuthOnce sync.Once
+	defaultAuth     *Auth
+	errDefaultAuth  error
+)
+
+// DefaultAuth returns a cached Auth built from env.
+func DefaultAuth() (*Auth, error) {
+	defaultAuthOnce.Do(func() {
+		defaultAuth, errDefaultAuth = NewAuthFromEnv()
+	})
+
+	return defaultAuth, errDefaultAuth
+}
+
+// NewAuthFromEnv builds an Auth from GIT_OAUTH_CLIENTID and GIT_OAUTH_SECRET,
+// optionally GIT_OAUTH_INSTALLATION_ID, and GITHUB_TOKEN. None of them is
+// required.
+func NewAuthFromEnv() (*Auth, error) {
+	appIDRaw := strings.TrimSpace(os.Getenv("GIT_OAUTH_CLIENTID"))
+	installIDRaw := strings.TrimSpace(os.Getenv("GIT_OAUTH_INSTALLATION_ID"))
+	secretRaw := strings.TrimSpace(os.Getenv("GIT_OAUTH_SECRET"))
+
+	a := newAuth(githubAPIBaseURL)
+	a.pat = strings.TrimSpace(os.Getenv("GITHUB_TOKEN"))
+
+	if appIDRaw == "" && installIDRaw == "" && secretRaw == "" {
+		return a, nil
+	}
+
+	if appIDRaw == "" || secretRaw == "" {
+		return nil, errors.New("GIT_OAUTH_CLIENTID and GIT_OAUTH_SECRET must both be set to use a GitHub App")
+	}
+
+	appID, err := strconv.ParseInt(appIDRaw, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GIT_OAUTH_CLIENTID: %w", err)
+	}
+
+	if installIDRaw != "" {
+		a.defaultInstallation, err = strconv.ParseInt(installIDRaw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GIT_OAUTH_INSTALLATION_ID: %w", err)
+		}
+	}
+
+	privateKey, err := rsajwt.ParsePrivateKey(rsajwt.PEMFromEnv(secretRaw))
+	if err != nil {
+		return nil, fmt.Errorf("GIT_OAUTH_SECRET: %w", err)
+	}
+
+	a.appID = appID
+	a.privateKey = privateKey
+
+	return a, nil
+}
+
+func newAuth(baseURL string) *Auth {
+	return &Auth{
+		baseURL:       baseURL,
+		client:        &http.Client{Timeout: 15 * time.Second},
+		installations: make(map[string]int64),
+		providers:     make(map[int64]*TokenProvider),
+	}
+}
+
+// Anonymous reports whether no credentials are configured.
+func (a *Auth) Anonymous() bool {
+	return a.privateKey == nil && a.pat == ""
+}
+
+// String describes the configured credentials, for logging.
+func (a *Auth) String() string {
+	var parts []string
+
+	if a.privateKey != nil {
+		if a.defaultInstallation != 0 {
+			parts = append(parts, fmt.Sprintf("GitHub App %d (default installation %d)", a.appID, a.defaultInstallation))
+		} else {
+			parts = append(parts, fmt.Sprintf("GitHub App %d", a.appID))
+		}
+	}
+
+	if a.pat != "" {
+		parts = append(parts, "personal access token")
+	}
+
+	if len(parts) == 0 {
+		return "anonymous (60 requests an hour)"
+	}
+
+	return strings.Join(parts, ", then ")
+}
+
+// Token returns the token for requests about owner, a GitHub organization or
+// user, or "" to make them anonymously. owner may be empty.
+func (a *Auth) Token(ctx context.Context, owner string) (string, error) {
+	if a.privateKey != nil {
+		installationID := a.defaultInstallation
+
+		if owner != "" {
+			id, err := a.installation(ctx, owner)
+			if err != nil {
+				log.Warnf("GitHub API auth: %v, using the default credentials", err)
+			}
+
+			if id != 0 {
+				installationID = id
+			}
+		}
+
+		if installationID != 0 {
+			token, _, err := a.provider(installationID).Token(ctx)
+
+			return token, err
+		}
+	}
+
+	return a.pat, nil
+}
+
+// installation returns the ID of the App's installation on owner, or 0.
+func (a *Auth) installation(ctx context.Context, owner string) (int64, error) {
+	key := strings.ToLower(owner)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if id, ok := a.installations[key]; ok {
+		return id, nil
+	}
+
+	id, err := a.lookupInstallation(ctx, "orgs", owner)
+	if err == nil && id == 0 {
+		id, err = a.lookupInstallation(ctx, "users", owner)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	a.installations[key] = id
+
+	return id, nil
+}
+
+// lookupInstallation asks GitHub for the installation on /{kind}/{owner}.
+func (a *Auth) lookupInstallation(ctx context.Context, kind, owner string) (int64, error) {
+	jwt, err := a.provider(0).buildJWT(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/%s/%s/installation", a.baseURL, kind, url.PathEscape(owner)),
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", githubAPIVersion())
+	req.Header.Set("User-Agent", "publiccode-crawler")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("github app installation lookup for %s failed: %w", owner, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		return 0, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("github app installation lookup for %s failed: %s", owner, resp.Status)
+	}
+
+	var body struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("github app installation response decode failed: %w", err)
+	}
+
+	return body.ID, nil
+}
+
+// provider returns the TokenProvider of installationID, 0 for one that only
+// signs App JWTs.
+func (a *Auth) provider(installationID int64) *TokenProvider {
+	a.providersMu.Lock()
+	defer a.providersMu.Unlock()
+
+	p, ok := a.providers[installationID]
+	if !ok {
+		p = newTokenProvider(a.baseURL, a.appID, installationID, a.privateKey)
+		a.providers[installationID] = p
+	}
+
+	return p
+}
+
+// Transport authenticates GitHub API requests with the token Auth picks for
+// the account in the request path.
+type Transport struct {
+	// Auth is DefaultAuth if nil. It's read on the first request, so a
+	// Transport can be created without any GitHub config.
+	Auth *Auth
+	// Base is http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+type ownerKey struct{}
+
+// WithOwner makes Transport authenticate the requests made with ctx for owner,
+// for requests whose path doesn't tell, like GraphQL queries.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth := t.Auth
+	if auth == nil {
+		var err error
+
+		auth, err = DefaultAuth()
+		if err != nil {
+			return nil, fmt.Errorf("GitHub API auth: %w", err)
+		}
+	}
+
+	owner, ok := req.Context().Value(ownerKey{}).(string)
+	if !ok {
+		owner = OwnerFromPath(req.URL.Path)
+	}
+
+	token, err := auth.Token(req.Context(), owner)
+	if err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if token == "" {
+		return base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return base.RoundTrip(req)
+}
+
+// OwnerFromPath returns the organization or user a GitHub API path, such as
+// /orgs/{org}/repos or /repos/{owner}/{repo}, is about, or "" for other paths.
+func OwnerFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(parts) >= 2 && (parts[0] == "orgs" || parts[0] == "users" || parts[0] == "repos") {
+		return parts[1]
+	}
+
+	return ""
+}
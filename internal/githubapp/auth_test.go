@@ -0,0 +1,133 @@
+package githubapp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGitHubServer fakes GitHub with the App installed on acme as installation
+// 7. Requests to /repos/ echo their Authorization header.
+func newGitHubServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var lookups atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs/{org}/installation", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+
+		if !strings.EqualFold(r.PathValue("org"), "acme") {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	mux.HandleFunc("GET /users/{user}/installation", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		_, _ = fmt.Fprintf(w, `{"token":"installation-%s","expires_at":%q}`, r.PathValue("id"), expiresAt)
+	})
+	mux.HandleFunc("GET /repos/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, &lookups
+}
+
+func newTestApp(t *testing.T, baseURL string) *Auth {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	a := newAuth(baseURL)
+	a.appID = 1
+	a.privateKey = key
+
+	return a
+}
+
+func TestAuthPicksInstallationPerOwner(t *testing.T) {
+	server, lookups := newGitHubServer(t)
+
+	a := newTestApp(t, server.URL)
+	a.defaultInstallation = 3
+
+	for range 2 {
+		token, err := a.Token(t.Context(), "Acme")
+		require.NoError(t, err)
+		assert.Equal(t, "installation-7", token)
+	}
+
+	assert.Equal(t, int32(1), lookups.Load())
+
+	token, err := a.Token(t.Context(), "other")
+	require.NoError(t, err)
+	assert.Equal(t, "installation-3", token)
+
+	token, err = a.Token(t.Context(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "installation-3", token)
+}
+
+func TestAuthFallsBackToTokenAndAnonymous(t *testing.T) {
+	server, _ := newGitHubServer(t)
+
+	a := newTestApp(t, server.URL)
+	a.pat = "personal"
+
+	token, err := a.Token(t.Context(), "other")
+	require.NoError(t, err)
+	assert.Equal(t, "personal", token)
+
+	anonymous := newAuth(server.URL)
+	assert.True(t, anonymous.Anonymous())
+
+	token, err = anonymous.Token(t.Context(), "acme")
+	require.NoError(t, err)
+	assert.Empty(t, token)
+}
+
+func TestTransportAuthenticatesByRequestPath(t *testing.T) {
+	server, _ := newGitHubServer(t)
+
+	client := &http.Client{Transport: &Transport{Auth: newTestApp(t, server.URL)}}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/repos/acme/zaken", nil)
+	require.NoError(t, err)
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	body := make([]byte, 64)
+	n, _ := res.Body.Read(body)
+	assert.Equal(t, "Bearer installation-7", string(body[:n]))
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestOwnerFromPath(t *testing.T) {
+	assert.Equal(t, "acme", OwnerFromPath("/orgs/acme/repos"))
+	assert.Equal(t, "acme", OwnerFromPath("/repos/acme/zaken/commits"))
+	assert.Equal(t, "someone", OwnerFromPath("/users/someone/repos"))
+	assert.Empty(t, OwnerFromPath("/rate_limit"))
+	assert.Empty(t, OwnerFromPath("/search/repositories"))
+}
@@ -0,0 +1,13 @@
+package githubapp
+
+import (
+	"os"
+	"strings"
+)
+
+// WebhookSecret returns the secret GitHub signs the App's webhook deliveries
+// with (GIT_OAUTH_WEBHOOK_SECRET). It's configured in the same App settings as
+// the private key, but is a separate value.
+func WebhookSecret() string {
+	return strings.TrimSpace(os.Getenv("GIT_OAUTH_WEBHOOK_SECRET"))
+}
@@ -0,0 +1,368 @@
+// Package httpcache revalidates GET responses of the code hosting APIs with
+// If-None-Match and If-Modified-Since, keeping them under DATADIR/http-cache.
+// A 304 is answered from disk; GitHub doesn't count those against the rate
+// limit.
+//
+// The cache is private to the crawler, so responses aren't keyed by the
+// Authorization header: tokens rotate, the data they read doesn't. It's meant
+// for the provider APIs and publiccode.yml only, not for arbitrary URLs; Prune
+// keeps it within HTTP_CACHE_MAX_AGE_DAYS and HTTP_CACHE_MAX_SIZE.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// maxBodySize is the largest response body that's cached.
+const maxBodySize = 8 << 20
+
+var (
+	requests    atomic.Int64
+	notModified atomic.Int64
+)
+
+// entry is a cached response.
+type entry struct {
+	URL          string      `json:"url"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	StoredAt     time.Time   `json:"stored_at"`
+}
+
+// Transport is an http.RoundTripper that caches GET responses with an ETag or
+// Last-Modified and revalidates them. It does nothing unless HTTP_CACHE is on
+// and DATADIR is set, both read on every request.
+type Transport struct {
+	// Base is http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+// New returns a Transport around base.
+func New(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// NewClient returns a client with a Transport around http.DefaultTransport
+// and timeout.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: New(nil)}
+}
+
+// Stats returns how many GET requests went through a Transport since the
+// start, and how many of those were answered with 304 Not Modified.
+func Stats() (int64, int64) {
+	return requests.Load(), notModified.Load()
+}
+
+// Policy limits the cache. A zero limit is no limit.
+type Policy struct {
+	// MaxAge removes responses that weren't used for longer.
+	MaxAge time.Duration
+	// MaxSize removes the least recently used responses until the cache fits.
+	MaxSize int64
+}
+
+// PruneResult is what Prune removed, and the size of the cache left.
+type PruneResult struct {
+	Removed   int
+	Reclaimed int64
+	Remaining int64
+}
+
+// PolicyFromEnv builds a Policy from HTTP_CACHE_MAX_AGE_DAYS and
+// HTTP_CACHE_MAX_SIZE.
+func PolicyFromEnv() (Policy, error) {
+	maxSize, err := git.ParseByteSize(viper.GetString("HTTP_CACHE_MAX_SIZE"))
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid HTTP_CACHE_MAX_SIZE: %w", err)
+	}
+
+	return Policy{
+		MaxAge:  time.Duration(viper.GetInt("HTTP_CACHE_MAX_AGE_DAYS")) * 24 * time.Hour,
+		MaxSize: maxSize,
+	}, nil
+}
+
+// Prune removes the responses policy doesn't allow from DATADIR/http-cache,
+// those unused for longer than MaxAge first, then the least recently used ones
+// until the cache fits MaxSize. With dryRun, it only reports what it would
+// remove.
+func Prune(policy Policy, dryRun bool) (PruneResult, error) {
+	dir := dataDir()
+	if dir == "" {
+		return PruneResult{}, nil
+	}
+
+	type file struct {
+		path   string
+		size   int64
+		usedAt time.Time
+	}
+
+	var files []file
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return filepath.SkipAll
+			}
+
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, file{path: path, size: info.Size(), usedAt: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("can't scan %s: %w", dir, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].usedAt.Before(files[j].usedAt) })
+
+	var result PruneResult
+	for _, f := range files {
+		result.Remaining += f.size
+	}
+
+	cutoff := time.Now().Add(-policy.MaxAge)
+
+	for _, f := range files {
+		expired := policy.MaxAge > 0 && f.usedAt.Before(cutoff)
+		tooLarge := policy.MaxSize > 0 && result.Remaining > policy.MaxSize
+
+		if !expired && !tooLarge {
+			break
+		}
+
+		if !dryRun {
+			if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return result, fmt.Errorf("can't prune HTTP cache: %w", err)
+			}
+		}
+
+		result.Removed++
+		result.Reclaimed += f.size
+		result.Remaining -= f.size
+	}
+
+	return result, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	dir := cacheDir()
+	if dir == "" || req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return base.RoundTrip(req)
+	}
+
+	requests.Add(1)
+
+	path := entryPath(dir, req)
+	cached := load(path)
+
+	if cached != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		req = req.Clone(req.Context())
+
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && cached != nil:
+		notModified.Add(1)
+
+		// The modification time tells Prune when the entry was last used.
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+
+		return cached.response(req, res), nil
+	case res.StatusCode == http.StatusOK:
+		return store(path, req, res)
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		if cached != nil {
+			_ = os.Remove(path)
+		}
+	}
+
+	return res, nil
+}
+
+func cacheDir() string {
+	if !viper.GetBool("HTTP_CACHE") {
+		return ""
+	}
+
+	return dataDir()
+}
+
+// dataDir returns the cache directory, "" without DATADIR.
+func dataDir() string {
+	if viper.GetString("DATADIR") == "" {
+		return ""
+	}
+
+	return filepath.Join(viper.GetString("DATADIR"), "http-cache")
+}
+
+// entryPath returns the file for the response to req. Responses vary by the
+// Accept header, GitHub for one returns different media types.
+func entryPath(dir string, req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	key := hex.EncodeToString(sum[:])
+
+	return filepath.Join(dir, key[:2], key+".json")
+}
+
+func load(path string) *entry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Debugf("ignoring unreadable HTTP cache entry %s: %v", path, err)
+
+		return nil
+	}
+
+	return &e
+}
+
+// store caches res if it has a validator and isn't too large, and returns a
+// response to use in its place.
+func store(path string, req *http.Request, res *http.Response) (*http.Response, error) {
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+
+	if (etag == "" && lastModified == "") || strings.Contains(res.Header.Get("Cache-Control"), "no-store") {
+		return res, nil
+	}
+
+	if res.ContentLength > maxBodySize {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize+1))
+	if err != nil {
+		res.Body.Close()
+
+		return nil, err
+	}
+
+	if len(body) > maxBodySize {
+		res.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), res.Body), Closer: res.Body}
+
+		return res, nil
+	}
+
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := entry{
+		URL:          req.URL.String(),
+		Status:       res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		ETag:         etag,
+		LastModified: lastModified,
+		StoredAt:     time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = state.WriteFile(path, data)
+	}
+
+	if err != nil {
+		log.Warnf("can't cache %s: %v", req.URL.Redacted(), err)
+	}
+
+	return res, nil
+}
+
+// response rebuilds the cached response for req. The headers of the 304, such
+// as the rate limit ones, take precedence over the cached ones.
+func (e *entry) response(req *http.Request, notModified *http.Response) *http.Response {
+	_, _ = io.Copy(io.Discard, notModified.Body)
+	notModified.Body.Close()
+
+	header := e.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	for key, values := range notModified.Header {
+		if key != "Content-Length" {
+			header[key] = values
+		}
+	}
+
+	header.Set("X-From-Cache", "1")
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.Status) + " " + http.StatusText(e.Status),
+		StatusCode:    e.Status,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+		TLS:           notModified.TLS,
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,177 @@
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCache(t *testing.T) {
+	t.Helper()
+
+	viper.Set("DATADIR", t.TempDir())
+	viper.Set("HTTP_CACHE", true)
+
+	t.Cleanup(func() {
+		viper.Set("DATADIR", "")
+		viper.Set("HTTP_CACHE", false)
+	})
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res, string(body)
+}
+
+func TestTransportRevalidatesWithETag(t *testing.T) {
+	setupCache(t)
+
+	var conditional []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"zaken"}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(nil)}
+	requestsBefore, notModifiedBefore := Stats()
+
+	res, body := get(t, client, server.URL+"/repos/acme/zaken")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"name":"zaken"}`, body)
+
+	res, body = get(t, client, server.URL+"/repos/acme/zaken")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"name":"zaken"}`, body)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "4999", res.Header.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", res.Header.Get("X-From-Cache"))
+
+	assert.Equal(t, []string{"", `"v1"`}, conditional)
+
+	requests, notModified := Stats()
+	assert.Equal(t, int64(2), requests-requestsBefore)
+	assert.Equal(t, int64(1), notModified-notModifiedBefore)
+}
+
+func TestTransportDropsEntryOnNotFound(t *testing.T) {
+	setupCache(t)
+
+	gone := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone {
+			assert.NotEmpty(t, r.Header.Get("If-Modified-Since"))
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte("name: zaken\n"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(nil)}
+	url := server.URL + "/publiccode.yml"
+
+	get(t, client, url)
+
+	gone = true
+
+	res, _ := get(t, client, url)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	assert.Nil(t, load(entryPath(cacheDir(), req)))
+}
+
+func TestTransportDisabled(t *testing.T) {
+	viper.Set("HTTP_CACHE", false)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(nil)}
+
+	for range 2 {
+		res, body := get(t, client, server.URL)
+		assert.Equal(t, "ok", body)
+		assert.Empty(t, res.Header.Get("X-From-Cache"))
+	}
+}
+
+func TestPruneRemovesExpiredThenLeastRecentlyUsed(t *testing.T) {
+	setupCache(t)
+
+	dir := dataDir()
+	now := time.Now()
+
+	for i, age := range []time.Duration{60 * 24 * time.Hour, 3 * time.Hour, 2 * time.Hour, time.Hour} {
+		path := filepath.Join(dir, "ab", fmt.Sprintf("entry-%d.json", i))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, make([]byte, 100), 0o600))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	policy := Policy{MaxAge: 30 * 24 * time.Hour, MaxSize: 250}
+
+	result, err := Prune(policy, true)
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{Removed: 2, Reclaimed: 200, Remaining: 200}, result)
+	assert.FileExists(t, filepath.Join(dir, "ab", "entry-0.json"))
+
+	result, err = Prune(policy, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Removed)
+	assert.NoFileExists(t, filepath.Join(dir, "ab", "entry-0.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "ab", "entry-1.json"))
+	assert.FileExists(t, filepath.Join(dir, "ab", "entry-2.json"))
+	assert.FileExists(t, filepath.Join(dir, "ab", "entry-3.json"))
+}
+
+func TestPruneWithoutCache(t *testing.T) {
+	setupCache(t)
+
+	result, err := Prune(Policy{MaxAge: time.Hour}, false)
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{}, result)
+}
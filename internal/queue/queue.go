@@ -0,0 +1,308 @@
+// Package queue is a durable work queue for crawls. Every change to an item is
+// appended to a journal file, so after the process dies the queue can be
+// reopened with each item's last status and attempt count.
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	// StatusFailed items are retried until they reach the queue's maximum
+	// number of attempts, then they're dead.
+	StatusFailed = "failed"
+	StatusDead   = "dead"
+)
+
+// errInterrupted is recorded for items that were running when the process
+// stopped.
+const errInterrupted = "interrupted"
+
+// maxLineSize bounds a journal line, i.e. an item with its payload.
+const maxLineSize = 16 << 20
+
+// ErrNotFound is returned by Open when there's no queue to reopen.
+var ErrNotFound = errors.New("no queue to resume")
+
+// Item is a unit of work.
+type Item struct {
+	Key      string          `json:"key"`
+	Kind     string          `json:"kind"`
+	Status   string          `json:"status"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	// UpdatedAt is when the item last changed status.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Decode unmarshals the payload of the item into v.
+func (i Item) Decode(v any) error {
+	if err := json.Unmarshal(i.Payload, v); err != nil {
+		return fmt.Errorf("can't decode queue item %s: %w", i.Key, err)
+	}
+
+	return nil
+}
+
+// Queue is a journal-backed set of items in insertion order. It's safe for
+// concurrent use.
+type Queue struct {
+	mu          sync.Mutex
+	file        *os.File
+	items       map[string]*Item
+	order       []string
+	maxAttempts int
+}
+
+// Create starts an empty queue at path, replacing any existing one.
+func Create(path string, maxAttempts int) (*Queue, error) {
+	if err := state.WriteFile(path, nil); err != nil {
+		return nil, err
+	}
+
+	return open(path, maxAttempts, nil, nil)
+}
+
+// Open reopens the queue at path. Items that were running when the process
+// stopped count as a failed attempt.
+func Open(path string, maxAttempts int) (*Queue, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't read queue: %w", err)
+	}
+
+	items := make(map[string]*Item)
+
+	var order []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		var item Item
+
+		// A line cut short by the process dying mid-write is skipped.
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+
+		previous, ok := items[item.Key]
+		if !ok {
+			order = append(order, item.Key)
+		} else if item.Payload == nil {
+			// Only the first line of an item carries the payload.
+			item.Payload = previous.Payload
+		}
+
+		items[item.Key] = &item
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read queue: %w", err)
+	}
+
+	for _, item := range items {
+		if item.Status == StatusRunning {
+			item.Status = StatusFailed
+			item.Error = errInterrupted
+
+			if item.Attempts >= maxAttempts {
+				item.Status = StatusDead
+			}
+		}
+	}
+
+	// Compact the journal to the current state of every item.
+	var compacted bytes.Buffer
+
+	for _, key := range order {
+		line, err := json.Marshal(items[key])
+		if err != nil {
+			return nil, fmt.Errorf("can't compact queue: %w", err)
+		}
+
+		compacted.Write(line)
+		compacted.WriteByte('\n')
+	}
+
+	if err := state.WriteFile(path, compacted.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return open(path, maxAttempts, items, order)
+}
+
+func open(path string, maxAttempts int, items map[string]*Item, order []string) (*Queue, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open queue: %w", err)
+	}
+
+	if items == nil {
+		items = make(map[string]*Item)
+	}
+
+	return &Queue{file: file, items: items, order: order, maxAttempts: maxAttempts}, nil
+}
+
+// Add queues a pending item with payload, unless an item with key is queued
+// already. It returns whether the item was added.
+func (q *Queue) Add(kind, key string, payload any) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("can't encode queue item %s: %w", key, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.items[key]; ok {
+		return false, nil
+	}
+
+	item := &Item{Key: key, Kind: kind, Status: StatusPending, Payload: data}
+	q.items[key] = item
+	q.order = append(q.order, key)
+
+	return true, q.write(item, true)
+}
+
+// Start marks a pending or failed item as running, counting an attempt. It
+// returns false for items that are running, done or dead.
+func (q *Queue) Start(key string) (bool, error) {
+	started := false
+
+	err := q.update(key, func(item *Item) {
+		if item.Status != StatusPending && item.Status != StatusFailed {
+			return
+		}
+
+		item.Status = StatusRunning
+		item.Attempts++
+		started = true
+	})
+
+	return started, err
+}
+
+// Done marks the item as done.
+func (q *Queue) Done(key string) error {
+	return q.update(key, func(item *Item) {
+		item.Status = StatusDone
+		item.Error = ""
+	})
+}
+
+// Fail marks the item as failed with cause, or as dead once it reached the
+// maximum number of attempts. It returns the item as it is now.
+func (q *Queue) Fail(key string, cause error) (Item, error) {
+	var failed Item
+
+	err := q.update(key, func(item *Item) {
+		item.Status = StatusFailed
+		item.Error = cause.Error()
+
+		if item.Attempts >= q.maxAttempts {
+			item.Status = StatusDead
+		}
+
+		failed = *item
+	})
+
+	return failed, err
+}
+
+// Remaining returns the items of kind that are pending or failed, in the
+// order they were added.
+func (q *Queue) Remaining(kind string) []Item {
+	return q.filter(func(item *Item) bool {
+		return item.Kind == kind && (item.Status == StatusPending || item.Status == StatusFailed)
+	})
+}
+
+// Dead returns the dead items.
+func (q *Queue) Dead() []Item {
+	return q.filter(func(item *Item) bool { return item.Status == StatusDead })
+}
+
+// Close closes the journal.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.file.Close()
+}
+
+func (q *Queue) filter(keep func(*Item) bool) []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []Item
+
+	for _, key := range q.order {
+		if item := q.items[key]; keep(item) {
+			items = append(items, *item)
+		}
+	}
+
+	return items
+}
+
+func (q *Queue) update(key string, fn func(*Item)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[key]
+	if !ok {
+		return fmt.Errorf("no queue item %s", key)
+	}
+
+	before := *item
+
+	fn(item)
+
+	if item.Status == before.Status && item.Attempts == before.Attempts && item.Error == before.Error {
+		return nil
+	}
+
+	return q.write(item, false)
+}
+
+// write appends the item to the journal, with its payload only if
+// withPayload. Callers must hold q.mu.
+func (q *Queue) write(item *Item, withPayload bool) error {
+	item.UpdatedAt = time.Now().UTC()
+
+	record := *item
+	if !withPayload {
+		record.Payload = nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("can't encode queue item %s: %w", item.Key, err)
+	}
+
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("can't write queue: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "crawl.jsonl")
+
+	q, err := Create(path, 2)
+	require.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		added, err := q.Add("repository", key, map[string]string{"name": key})
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+
+	added, err := q.Add("repository", "a", nil)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	started, err := q.Start("a")
+	require.NoError(t, err)
+	assert.True(t, started)
+	require.NoError(t, q.Done("a"))
+
+	started, err = q.Start("a")
+	require.NoError(t, err)
+	assert.False(t, started)
+
+	_, err = q.Start("b")
+	require.NoError(t, err)
+
+	item, err := q.Fail("b", errors.New("boom"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, item.Status)
+
+	// c is running when the process dies, halfway through writing d's next line.
+	_, err = q.Start("c")
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"key":"d","sta`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open(path, 2)
+	require.NoError(t, err)
+
+	remaining := q.Remaining("repository")
+	require.Len(t, remaining, 3)
+	assert.Equal(t, "b", remaining[0].Key)
+	assert.Equal(t, "boom", remaining[0].Error)
+	assert.Equal(t, "c", remaining[1].Key)
+	assert.Equal(t, StatusFailed, remaining[1].Status)
+	assert.Equal(t, "interrupted", remaining[1].Error)
+	assert.Equal(t, StatusPending, remaining[2].Status)
+
+	var payload map[string]string
+	require.NoError(t, remaining[1].Decode(&payload))
+	assert.Equal(t, "c", payload["name"])
+
+	// A second failure makes b dead.
+	_, err = q.Start("b")
+	require.NoError(t, err)
+
+	item, err = q.Fail("b", errors.New("boom again"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusDead, item.Status)
+	assert.Len(t, q.Dead(), 1)
+	require.NoError(t, q.Close())
+}
+
+func TestOpenMissing(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "crawl.jsonl"), 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"sort"
+)
+
+// MissingPubliccode is listed in Score.Missing for repositories without a
+// usable publiccode.yml.
+const MissingPubliccode = "publiccode.yml"
+
+// topMissing is the number of most commonly missing keys listed per organisation.
+const topMissing = 3
+
+// Organisation aggregates the publiccode.yml scores of a publisher's repositories.
+type Organisation struct {
+	Publisher string `json:"publisher"`
+	Name      string `json:"name"`
+	// Repositories is the number of repositories, Scored those with a score.
+	Repositories int `json:"repositories"`
+	Scored       int `json:"scored"`
+	// WithPubliccode is the number of repositories with a usable publiccode.yml.
+	WithPubliccode int     `json:"with_publiccode"`
+	AverageScore   float64 `json:"average_score"`
+	// Missing lists the keys missing in most repositories, most common first.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Organisations aggregates the scores per publisher, ranked by average score
+// from best to worst.
+func (r *Report) Organisations() []Organisation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byPublisher := make(map[string]*Organisation)
+	missing := make(map[string]map[string]int)
+	totals := make(map[string]int)
+
+	for _, repository := range r.Repositories {
+		org, ok := byPublisher[repository.Publisher]
+		if !ok {
+			org = &Organisation{Publisher: repository.Publisher, Name: repository.PublisherName}
+			byPublisher[repository.Publisher] = org
+			missing[repository.Publisher] = make(map[string]int)
+		}
+
+		org.Repositories++
+
+		if repository.Score == nil {
+			continue
+		}
+
+		org.Scored++
+		totals[repository.Publisher] += repository.Score.Value
+
+		fileMissing := false
+
+		for _, key := range repository.Score.Missing {
+			missing[repository.Publisher][key]++
+
+			if key == MissingPubliccode {
+				fileMissing = true
+			}
+		}
+
+		if !fileMissing {
+			org.WithPubliccode++
+		}
+	}
+
+	orgs := make([]Organisation, 0, len(byPublisher))
+
+	for id, org := range byPublisher {
+		if org.Scored > 0 {
+			org.AverageScore = float64(totals[id]) / float64(org.Scored)
+		}
+
+		org.Missing = mostCommon(missing[id], topMissing)
+		orgs = append(orgs, *org)
+	}
+
+	sort.Slice(orgs, func(i, j int) bool {
+		if orgs[i].AverageScore != orgs[j].AverageScore {
+			return orgs[i].AverageScore > orgs[j].AverageScore
+		}
+
+		return orgs[i].Publisher < orgs[j].Publisher
+	})
+
+	return orgs
+}
+
+func mostCommon(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+
+	return keys
+}
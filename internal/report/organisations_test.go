@@ -0,0 +1,37 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganisations(t *testing.T) {
+	r := New()
+	r.Repositories = map[string]*Repository{
+		"https://github.com/a/one": {
+			Publisher: "a", PublisherName: "Gemeente A",
+			Score: &Score{Value: 80, Missing: []string{"logo", "roadmap"}},
+		},
+		"https://github.com/a/two": {
+			Publisher: "a", PublisherName: "Gemeente A",
+			Score: &Score{Value: 0, Missing: []string{MissingPubliccode}},
+		},
+		"https://github.com/b/one": {
+			Publisher: "b", PublisherName: "Provincie B",
+			Score: &Score{Value: 90, Missing: []string{"roadmap"}},
+		},
+		"https://github.com/b/two": {Publisher: "b", PublisherName: "Provincie B"},
+	}
+
+	assert.Equal(t, []Organisation{
+		{
+			Publisher: "b", Name: "Provincie B", Repositories: 2, Scored: 1, WithPubliccode: 1,
+			AverageScore: 90, Missing: []string{"roadmap"},
+		},
+		{
+			Publisher: "a", Name: "Gemeente A", Repositories: 2, Scored: 2, WithPubliccode: 1,
+			AverageScore: 40, Missing: []string{"logo", "publiccode.yml", "roadmap"},
+		},
+	}, r.Organisations())
+}
@@ -0,0 +1,291 @@
+// Package report collects what the crawler found per repository during a run
+// and writes it to DATADIR/reports. Reports stay on disk and are never sent to
+// the register.
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/spf13/viper"
+)
+
+const latestName = "latest.json"
+
+// Report is the result of a single crawl run, keyed by canonical repository URL.
+type Report struct {
+	mu sync.Mutex
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Partial is set for crawls of some publishers or repositories only.
+	Partial      bool                   `json:"partial,omitempty"`
+	Repositories map[string]*Repository `json:"repositories"`
+	// Outbox lists the repository updates the register hasn't accepted yet.
+	Outbox []OutboxEntry `json:"outbox,omitempty"`
+}
+
+// Repository holds the findings for a single repository.
+type Repository struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Publisher string `json:"publisher"`
+	// PublisherName is the human readable name of Publisher.
+	PublisherName string       `json:"publisher_name,omitempty"`
+	Score         *Score       `json:"score,omitempty"`
+	BrokenLinks   []BrokenLink `json:"broken_links,omitempty"`
+	APISpecs      []APISpec    `json:"api_specs,omitempty"`
+	// Dependencies is the number of dependencies in the SBOM at path SBOM.
+	Dependencies int    `json:"dependencies,omitempty"`
+	SBOM         string `json:"sbom,omitempty"`
+	// Vulnerabilities are the OSV entries affecting the dependencies.
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty"`
+	// Secrets are possibly leaked credentials. OrganisationURL is who to tell.
+	Secrets []Secret `json:"secrets,omitempty"`
+	// Suggestion is the path of a draft publiccode.yml for repositories without one.
+	Suggestion      string `json:"suggestion,omitempty"`
+	OrganisationURL string `json:"organisation_url,omitempty"`
+}
+
+// OutboxEntry is a repository update that's waiting to be sent again.
+type OutboxEntry struct {
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// BrokenLink is a URL referenced from publiccode.yml that didn't pass the link check.
+type BrokenLink struct {
+	// Field is the publiccode.yml key the URL was found in, e.g. description.nl.screenshots.
+	Field  string `json:"field"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// APISpec is an API specification found in the repository.
+type APISpec struct {
+	Path    string `json:"path"`
+	URL     string `json:"url"`
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Vulnerability is an OSV entry affecting a dependency.
+type Vulnerability struct {
+	ID            string   `json:"id"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Ecosystem     string   `json:"ecosystem"`
+	Package       string   `json:"package"`
+	Version       string   `json:"version"`
+	FixedVersions []string `json:"fixed_versions,omitempty"`
+	// Source is the manifest the dependency was found in.
+	Source string `json:"source"`
+}
+
+// Score rates how complete publiccode.yml is, from 0 to 100. Missing lists
+// the recommended keys that weren't found.
+type Score struct {
+	Value   int      `json:"value"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Secret is a possibly leaked credential. Only a redacted form is kept.
+type Secret struct {
+	Rule string `json:"rule"`
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	// Commit is the commit that added the secret, empty if it's in HEAD.
+	Commit      string `json:"commit,omitempty"`
+	Redacted    string `json:"redacted"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// New returns an empty report for a run starting now.
+func New() *Report {
+	return &Report{
+		StartedAt:    time.Now().UTC(),
+		Repositories: make(map[string]*Repository),
+	}
+}
+
+// Dir returns the directory reports are written to.
+func Dir() string {
+	return filepath.Join(viper.GetString("DATADIR"), "reports")
+}
+
+// Update calls fn with the entry for repository, creating it if needed. It's
+// safe to call from multiple goroutines; fn may be nil to just register the
+// repository.
+func (r *Report) Update(repository common.Repository, fn func(*Repository)) {
+	key := repository.CanonicalURL.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.Repositories[key]
+	if !ok {
+		entry = &Repository{
+			Name:          repository.Name,
+			URL:           key,
+			Publisher:     repository.Publisher.ID,
+			PublisherName: repository.Publisher.Name,
+		}
+		r.Repositories[key] = entry
+	}
+
+	if fn != nil {
+		fn(entry)
+	}
+}
+
+// Save writes the report to DATADIR/reports/<start time>.json and, unless it's
+// partial, updates latest.json. If another report started in the same second,
+// a -2, -3, ... suffix keeps the name unique. Then only the REPORT_KEEP most
+// recent timestamped reports are kept. It returns the path of the timestamped
+// report.
+func (r *Report) Save() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now().UTC()
+
+	path, err := reservePath(r.StartedAt)
+	if err != nil {
+		return "", fmt.Errorf("can't save report: %w", err)
+	}
+
+	if err := state.WriteJSON(path, r); err != nil {
+		return "", fmt.Errorf("can't save report: %w", err)
+	}
+
+	if !r.Partial {
+		if err := state.WriteJSON(filepath.Join(Dir(), latestName), r); err != nil {
+			return "", fmt.Errorf("can't save report: %w", err)
+		}
+	}
+
+	if err := prune(viper.GetInt("REPORT_KEEP")); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// reservePath creates an empty file for a report started at startedAt, with a
+// name no other report has, and returns its path.
+func reservePath(startedAt time.Time) (string, error) {
+	if err := os.MkdirAll(Dir(), 0o744); err != nil {
+		return "", err
+	}
+
+	base := startedAt.Format("20060102T150405Z")
+
+	for n := 1; ; n++ {
+		name := base + ".json"
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d.json", base, n)
+		}
+
+		path := filepath.Join(Dir(), name)
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return path, f.Close()
+	}
+}
+
+// prune removes all but the keep most recent timestamped reports. latest.json
+// is always kept; keep 0 keeps everything.
+func prune(keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(Dir())
+	if err != nil {
+		return fmt.Errorf("can't list reports: %w", err)
+	}
+
+	type saved struct {
+		name    string
+		modTime time.Time
+	}
+
+	var reports []saved
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == latestName || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("can't list reports: %w", err)
+		}
+
+		reports = append(reports, saved{name: entry.Name(), modTime: info.ModTime()})
+	}
+
+	if len(reports) <= keep {
+		return nil
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].modTime.Equal(reports[j].modTime) {
+			return reports[i].modTime.After(reports[j].modTime)
+		}
+
+		return reports[i].name > reports[j].name
+	})
+
+	for _, report := range reports[keep:] {
+		if err := os.Remove(filepath.Join(Dir(), report.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("can't remove old report: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Load reads the report at path.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read report: %w", err)
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("can't parse report %s: %w", path, err)
+	}
+
+	if r.Repositories == nil {
+		r.Repositories = make(map[string]*Repository)
+	}
+
+	return &r, nil
+}
+
+// Latest reads the report of the most recent crawl.
+func Latest() (*Report, error) {
+	return Load(filepath.Join(Dir(), latestName))
+}
@@ -0,0 +1,64 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveKeepsNamesUniqueAndPrunes(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	viper.Set("REPORT_KEEP", 3)
+
+	defer viper.Set("DATADIR", "")
+	defer viper.Set("REPORT_KEEP", 0)
+
+	startedAt := time.Date(2026, 10, 1, 2, 0, 0, 0, time.UTC)
+
+	var paths []string
+
+	// Crawls started in the same second don't overwrite each other's report.
+	for i := range 3 {
+		r := New()
+		r.StartedAt = startedAt
+		r.Partial = i > 0
+
+		path, err := r.Save()
+		require.NoError(t, err)
+
+		paths = append(paths, filepath.Base(path))
+
+		// Make the order of the reports on disk unambiguous.
+		modTime := startedAt.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	assert.Equal(t, []string{"20261001T020000Z.json", "20261001T020000Z-2.json", "20261001T020000Z-3.json"}, paths)
+
+	r := New()
+	r.StartedAt = startedAt.Add(time.Hour)
+
+	_, err := r.Save()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(Dir())
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	assert.ElementsMatch(t, []string{
+		"20261001T020000Z-2.json", "20261001T020000Z-3.json", "20261001T030000Z.json", latestName,
+	}, names)
+
+	latest, err := Latest()
+	require.NoError(t, err)
+	assert.Equal(t, r.StartedAt, latest.StartedAt)
+}
@@ -0,0 +1,93 @@
+// Package rsajwt signs JWTs with RS256 and parses the RSA keys they're signed
+// with, for the GitHub App and the Keycloak client assertion.
+package rsajwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sign returns claims as a JWT signed with key. keyID is set as the kid header
+// unless it's empty.
+func Sign(claims any, keyID string, key *rsa.PrivateKey) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	encodedHeader, err := encodePart(header)
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := encodePart(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodedHeader + "." + encodedClaims
+	hash := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("can't sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func encodePart(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// PEMFromEnv returns the PEM data in an environment variable, which may use \n
+// for newlines.
+func PEMFromEnv(raw string) []byte {
+	return []byte(strings.ReplaceAll(strings.TrimSpace(raw), "\\n", "\n"))
+}
+
+// ParsePrivateKey parses RSA PEM in PKCS1/PKCS8 form.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not valid PEM data")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+
+		return key, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS8 private key: %w", err)
+		}
+
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an RSA private key")
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+	}
+}
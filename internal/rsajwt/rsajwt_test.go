@@ -0,0 +1,74 @@
+package rsajwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	token, err := Sign(map[string]any{"iss": "crawler"}, "key-1", key)
+	require.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"alg":"RS256","typ":"JWT","kid":"key-1"}`, string(header))
+
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"iss":"crawler"}`, string(claims))
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature))
+
+	token, err = Sign(map[string]any{}, "", key)
+	require.NoError(t, err)
+
+	header, err = base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"alg":"RS256","typ":"JWT"}`, string(header))
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		// Environment variables may hold the key on one line.
+		raw := strings.ReplaceAll(string(pem.EncodeToMemory(block)), "\n", `\n`)
+
+		parsed, err := ParsePrivateKey(PEMFromEnv(raw))
+		require.NoError(t, err, block.Type)
+		assert.True(t, key.Equal(parsed), block.Type)
+	}
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	require.ErrorContains(t, err, "not valid PEM data")
+
+	_, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{1}}))
+	require.ErrorContains(t, err, "unsupported private key type")
+}
@@ -0,0 +1,185 @@
+// Package schedule parses cron expressions: five fields (minute, hour, day of
+// month, month, day of week) supporting *, lists, ranges and steps, or one of
+// @hourly, @daily, @weekly and @monthly.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears bounds the search for the next activation, for expressions like
+// "0 0 30 2 *" that never fire.
+const maxYears = 5
+
+// ErrNever is returned by Next for schedules that never fire.
+var ErrNever = errors.New("schedule never fires")
+
+var aliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record unrestricted day fields: if both day fields
+	// are restricted, a day matching either one fires, like in cron.
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a cron expression.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if alias, ok := aliases[spec]; ok {
+		spec = alias
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q: want %d fields, got %d", spec, len(fields), len(parts))
+	}
+
+	bits := make([]uint64, len(fields))
+
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+
+		bits[i] = b
+	}
+
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+// parseField returns the values in part as a bit set.
+func parseField(part string, f field) (uint64, error) {
+	var bits uint64
+
+	for item := range strings.SplitSeq(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepPart)
+			}
+		}
+
+		lo, hi := f.min, f.max
+
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if lo, err = parseValue(from, f); err != nil {
+				return 0, err
+			}
+
+			hi = lo
+
+			switch {
+			case isRange:
+				if hi, err = parseValue(to, f); err != nil {
+					return 0, err
+				}
+			case hasStep:
+				// "5/15" means from 5 to the maximum, every 15.
+				hi = f.max
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, rangePart)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", f.name, s)
+	}
+
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// Next returns the first activation after t, in t's location.
+func (s *Schedule) Next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, nil
+		}
+	}
+
+	return time.Time{}, ErrNever
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
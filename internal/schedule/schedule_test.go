@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// A Sunday.
+	from := time.Date(2026, 10, 18, 20, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 18, 20, 31, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 18, 20, 45, 0, 0, time.UTC)},
+		{"5/20 8-18 * * *", time.Date(2026, 10, 19, 8, 5, 0, 0, time.UTC)},
+		{"0 3 * * 1-5", time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2026, 10, 25, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 1,7 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one fires.
+		{"0 0 1 * 3", time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		require.NoError(t, err, tt.spec)
+
+		got, err := s.Next(from)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, got, tt.spec)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+
+	_, err = s.Next(time.Now())
+	assert.ErrorIs(t, err, ErrNever)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
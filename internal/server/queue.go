@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// queueRetryInterval is how often a queued repository is retried while
+// another crawl is running.
+var queueRetryInterval = 10 * time.Second
+
+// Queue holds repositories to crawl one by one, as soon as no other crawl is
+// running. A repository is queued at most once at a time.
+type Queue struct {
+	runner *Runner
+
+	mu      sync.Mutex
+	pending []string
+	wake    chan struct{}
+}
+
+// NewQueue returns a queue starting its crawls with runner.
+func NewQueue(runner *Runner) *Queue {
+	return &Queue{runner: runner, wake: make(chan struct{}, 1)}
+}
+
+// Add queues the repository at repoURL. It returns false if it's queued
+// already.
+func (q *Queue) Add(repoURL string) bool {
+	repoURL = strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, pending := range q.pending {
+		if strings.EqualFold(pending, repoURL) {
+			return false
+		}
+	}
+
+	q.pending = append(q.pending, repoURL)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Pending returns the queued repositories, in order.
+func (q *Queue) Pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]string(nil), q.pending...)
+}
+
+// Run crawls the queued repositories until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		pending := q.Pending()
+
+		var wait <-chan time.Time
+
+		if len(pending) > 0 {
+			run, err := q.runner.Start(TriggerWebhook, Target{Repository: pending[0]})
+			if err == nil {
+				log.Infof("Crawl #%d started for queued %s", run.ID, pending[0])
+				q.remove(pending[0])
+
+				continue
+			}
+
+			// Busy: try again later.
+			wait = time.After(queueRetryInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-wait:
+		}
+	}
+}
+
+func (q *Queue) remove(repoURL string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, pending := range q.pending {
+		if pending == repoURL {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+
+			return
+		}
+	}
+}
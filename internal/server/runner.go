@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/internal/schedule"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	runsStateName = "runs"
+	// historySize is how many runs are kept.
+	historySize = 50
+
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerWebhook  = "webhook"
+)
+
+// ErrBusy is returned when a run is started while another one is running.
+var ErrBusy = errors.New("a crawl is already running")
+
+// Target is what to crawl: one repository, one publisher or, when empty,
+// every publisher.
+type Target struct {
+	Publisher  string `json:"publisher,omitempty"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// CrawlFunc crawls target.
+type CrawlFunc func(ctx context.Context, target Target) error
+
+// Run is a crawl started by the schedule or through the API.
+type Run struct {
+	ID         int        `json:"id"`
+	Trigger    string     `json:"trigger"`
+	Target     Target     `json:"target"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Runner runs one crawl at a time and keeps the history of past runs in
+// DATADIR/state/runs.json.
+type Runner struct {
+	crawl CrawlFunc
+
+	mu      sync.Mutex
+	current *Run
+	history []Run
+	lastID  int
+	wg      sync.WaitGroup
+}
+
+// NewRunner returns a runner using crawl, with the history of earlier runs.
+func NewRunner(crawl CrawlFunc) (*Runner, error) {
+	r := &Runner{crawl: crawl}
+
+	if err := state.Load(runsStateName, &r.history); err != nil {
+		return nil, err
+	}
+
+	for i, run := range r.history {
+		r.lastID = max(r.lastID, run.ID)
+
+		// The process stopped while this one was running.
+		if run.Status == StatusRunning {
+			r.history[i].Status = StatusFailed
+			r.history[i].Error = "interrupted"
+		}
+	}
+
+	return r, nil
+}
+
+// Start starts crawling target in the background, unless a crawl is running.
+func (r *Runner) Start(trigger string, target Target) (Run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		return *r.current, ErrBusy
+	}
+
+	r.lastID++
+
+	run := &Run{
+		ID:        r.lastID,
+		Trigger:   trigger,
+		Target:    target,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	r.current = run
+	r.record(*run)
+
+	r.wg.Add(1)
+
+	go r.run(run)
+
+	return *run, nil
+}
+
+func (r *Runner) run(run *Run) {
+	defer r.wg.Done()
+
+	log.Infof("Starting crawl #%d (%s)", run.ID, run.Trigger)
+
+	var err error
+
+	// A panicking crawl fails its run, not the daemon.
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Errorf("Crawl #%d panicked: %v\n%s", run.ID, p, debug.Stack())
+
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+
+		// Crawls aren't cancelled on shutdown: Wait lets them finish.
+		err = r.crawl(context.Background(), run.Target)
+	}()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	run.Status = StatusSucceeded
+
+	if err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+
+		log.Errorf("Crawl #%d failed: %v", run.ID, err)
+	} else {
+		log.Infof("Crawl #%d completed", run.ID)
+	}
+
+	r.current = nil
+	r.record(*run)
+}
+
+// record adds run to the history, or updates it, and saves the history. The
+// running crawl is saved too, so one interrupted by a restart shows up as
+// failed. Callers must hold r.mu.
+func (r *Runner) record(run Run) {
+	if len(r.history) > 0 && r.history[0].ID == run.ID {
+		r.history[0] = run
+	} else {
+		r.history = append([]Run{run}, r.history...)
+	}
+
+	if len(r.history) > historySize {
+		r.history = r.history[:historySize]
+	}
+
+	if err := state.Save(runsStateName, r.history); err != nil {
+		log.Errorf("can't save run history: %v", err)
+	}
+}
+
+// Status returns the running crawl, if any, and finished runs, newest first.
+func (r *Runner) Status() (*Run, []Run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		current *Run
+		past    []Run
+	)
+
+	for _, run := range r.history {
+		if r.current != nil && run.ID == r.current.ID {
+			current = &run
+		} else {
+			past = append(past, run)
+		}
+	}
+
+	return current, past
+}
+
+// Get returns the run with id.
+func (r *Runner) Get(id int) (Run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, run := range r.history {
+		if run.ID == id {
+			return run, true
+		}
+	}
+
+	return Run{}, false
+}
+
+// Wait waits for the running crawl, if any, to finish.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// RunSchedule starts a crawl of everything at every activation of s until ctx
+// is done. Activations while a crawl is running are skipped.
+func (r *Runner) RunSchedule(ctx context.Context, s *schedule.Schedule) {
+	for {
+		next, err := s.Next(time.Now())
+		if err != nil {
+			log.Error(err)
+
+			return
+		}
+
+		log.Infof("Next scheduled crawl at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		if run, err := r.Start(TriggerSchedule, Target{}); errors.Is(err, ErrBusy) {
+			log.Warnf("Skipping scheduled crawl: crawl #%d is still running", run.ID)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package server runs the crawler as a daemon: crawls run on a schedule or on
+// request through an HTTP API, one at a time.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBodySize bounds request bodies.
+const maxBodySize = 1 << 20
+
+// Server is the HTTP API of the daemon. Everything but /healthz needs the
+// token as a bearer token.
+type Server struct {
+	runner *Runner
+	token  string
+	mux    *http.ServeMux
+}
+
+// New returns the API for runner, authenticating requests with token.
+func New(runner *Runner, token string) *Server {
+	s := &Server{runner: runner, token: token, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.HandleFunc("POST /runs", s.authenticated(s.startRun))
+	s.mux.HandleFunc("GET /runs", s.authenticated(s.listRuns))
+	s.mux.HandleFunc("GET /runs/{id}", s.authenticated(s.getRun))
+
+	return s
+}
+
+// Handle registers handler for pattern, e.g. for webhooks that authenticate
+// by other means than the token.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// startRun starts a crawl of the target in the body: {"publisher": ID},
+// {"repository": URL} or nothing, for every publisher.
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request) {
+	var target Target
+
+	err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&target)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+
+		return
+	}
+
+	if target.Publisher != "" && target.Repository != "" {
+		writeError(w, http.StatusBadRequest, "set either publisher or repository, not both")
+
+		return
+	}
+
+	run, err := s.runner.Start(TriggerAPI, target)
+	if errors.Is(err, ErrBusy) {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "run": run})
+
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+strconv.Itoa(run.ID))
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, _ *http.Request) {
+	current, past := s.runner.Status()
+
+	writeJSON(w, http.StatusOK, struct {
+		Current *Run  `json:"current"`
+		Past    []Run `json:"past"`
+	}{current, past})
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no such run")
+
+		return
+	}
+
+	run, ok := s.runner.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such run")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("can't write response: %v", err)
+	}
+}
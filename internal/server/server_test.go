@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const token = "s3cret"
+
+func do(t *testing.T, s *Server, method, path, auth, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if auth != "" {
+		req.Header.Set("Authorization", "Bearer "+auth)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	release := make(chan struct{})
+	targets := make(chan Target, 2)
+
+	runner, err := NewRunner(func(_ context.Context, target Target) error {
+		targets <- target
+		<-release
+
+		if target.Repository != "" {
+			return errors.New("boom")
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	s := New(runner, token)
+
+	assert.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/healthz", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(t, s, http.MethodGet, "/runs", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(t, s, http.MethodPost, "/runs", "wrong", "").Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(t, s, http.MethodPost, "/runs", token, `{"publisher":"a","repository":"b"}`).Code)
+
+	rec := do(t, s, http.MethodPost, "/runs", token, `{"publisher":"acme"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/runs/1", rec.Header().Get("Location"))
+	assert.Equal(t, Target{Publisher: "acme"}, <-targets)
+
+	// No overlapping runs.
+	assert.Equal(t, http.StatusConflict, do(t, s, http.MethodPost, "/runs", token, "").Code)
+
+	var status struct {
+		Current *Run  `json:"current"`
+		Past    []Run `json:"past"`
+	}
+
+	rec = do(t, s, http.MethodGet, "/runs", token, "")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.NotNil(t, status.Current)
+	assert.Equal(t, StatusRunning, status.Current.Status)
+	assert.Empty(t, status.Past)
+
+	release <- struct{}{}
+	runner.Wait()
+
+	rec = do(t, s, http.MethodPost, "/runs", token, `{"repository":"https://github.com/acme/app"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	<-targets
+	release <- struct{}{}
+	runner.Wait()
+
+	rec = do(t, s, http.MethodGet, "/runs/2", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var run Run
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &run))
+	assert.Equal(t, StatusFailed, run.Status)
+	assert.Equal(t, "boom", run.Error)
+	assert.Equal(t, http.StatusNotFound, do(t, s, http.MethodGet, "/runs/3", token, "").Code)
+
+	// The history survives a restart.
+	runner, err = NewRunner(nil)
+	require.NoError(t, err)
+
+	current, past := runner.Status()
+	assert.Nil(t, current)
+	require.Len(t, past, 2)
+	assert.Equal(t, StatusSucceeded, past[1].Status)
+}
+
+func TestRunnerSurvivesPanickingCrawl(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	runner, err := NewRunner(func(context.Context, Target) error {
+		panic("corrupt state")
+	})
+	require.NoError(t, err)
+
+	run, err := runner.Start(TriggerAPI, Target{})
+	require.NoError(t, err)
+	runner.Wait()
+
+	run, ok := runner.Get(run.ID)
+	require.True(t, ok)
+	assert.Equal(t, StatusFailed, run.Status)
+	assert.Equal(t, "panic: corrupt state", run.Error)
+
+	// The next run can start.
+	_, err = runner.Start(TriggerAPI, Target{})
+	require.NoError(t, err)
+	runner.Wait()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+	log "github.com/sirupsen/logrus"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// gitlabInstanceHeader holds the URL of the GitLab instance sending a hook.
+const gitlabInstanceHeader = "X-Gitlab-Instance"
+
+// Webhooks receives push and repository events from GitHub and GitLab and
+// queues the repositories they're about, if watched, for a crawl.
+type Webhooks struct {
+	queue *Queue
+	// watched tells whether a repository belongs to a known publisher.
+	watched func(repoURL string) bool
+
+	githubSecret []byte
+	gitlabToken  string
+}
+
+// NewWebhooks returns webhook handlers queueing to queue. GitHub deliveries
+// are verified with githubSecret, GitLab ones with gitlabToken; an empty one
+// disables the platform's endpoint.
+func NewWebhooks(queue *Queue, watched func(repoURL string) bool, githubSecret, gitlabToken string) *Webhooks {
+	return &Webhooks{queue: queue, watched: watched, githubSecret: []byte(githubSecret), gitlabToken: gitlabToken}
+}
+
+// Register adds POST /webhooks/github and POST /webhooks/gitlab to s. They
+// authenticate with the platform's signature or token, not with s's token.
+func (h *Webhooks) Register(s *Server) {
+	if len(h.githubSecret) > 0 {
+		s.Handle("POST /webhooks/github", http.HandlerFunc(h.github))
+	}
+
+	if h.gitlabToken != "" {
+		s.Handle("POST /webhooks/gitlab", http.HandlerFunc(h.gitlab))
+	}
+}
+
+func (h *Webhooks) github(w http.ResponseWriter, r *http.Request) {
+	payload, err := github.ValidatePayload(r, h.githubSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+
+		return
+	}
+
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		// Unknown event types end up here too: nothing to do for those.
+		writeJSON(w, http.StatusAccepted, map[string]any{"queued": []string{}})
+
+		return
+	}
+
+	var repoURLs []string
+
+	switch e := event.(type) {
+	case *github.PushEvent:
+		repo := e.GetRepo()
+		if !e.GetDeleted() &&
+			(e.GetRef() == "refs/heads/"+repo.GetDefaultBranch() || githubTouchesPubliccode(e.Commits)) {
+			repoURLs = append(repoURLs, repo.GetHTMLURL())
+		}
+	case *github.RepositoryEvent:
+		switch e.GetAction() {
+		case "created", "publicized", "transferred", "renamed":
+			repoURLs = append(repoURLs, e.GetRepo().GetHTMLURL())
+		}
+	case *github.InstallationRepositoriesEvent:
+		if e.GetAction() == "added" {
+			for _, repo := range e.RepositoriesAdded {
+				repoURLs = append(repoURLs, "https://github.com/"+repo.GetFullName())
+			}
+		}
+	}
+
+	h.enqueue(w, repoURLs)
+}
+
+func (h *Webhooks) gitlab(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(gitlab.HookEventToken(r)), []byte(h.gitlabToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "can't read body")
+
+		return
+	}
+
+	event, err := gitlab.ParseHook(gitlab.HookEventType(r), payload)
+	if err != nil {
+		writeJSON(w, http.StatusAccepted, map[string]any{"queued": []string{}})
+
+		return
+	}
+
+	var repoURLs []string
+
+	switch e := event.(type) {
+	case *gitlab.PushEvent:
+		touched := false
+
+		for _, commit := range e.Commits {
+			touched = touched || touchesPubliccode(commit.Added, commit.Modified, commit.Removed)
+		}
+
+		if e.Ref == "refs/heads/"+e.Project.DefaultBranch || touched {
+			repoURLs = append(repoURLs, e.Project.WebURL)
+		}
+	case *gitlab.PushSystemEvent:
+		// System hooks don't list the files, only pushes to the default branch count.
+		if e.Ref == "refs/heads/"+e.Project.DefaultBranch {
+			repoURLs = append(repoURLs, e.Project.WebURL)
+		}
+	case *gitlab.ProjectSystemEvent:
+		instance := strings.TrimSuffix(r.Header.Get(gitlabInstanceHeader), "/")
+
+		switch {
+		case e.EventName != "project_create" && e.EventName != "project_transfer" && e.EventName != "project_rename":
+		case instance == "":
+			log.Warnf("GitLab %s event for %s without %s header", e.EventName, e.PathWithNamespace, gitlabInstanceHeader)
+		default:
+			repoURLs = append(repoURLs, instance+"/"+e.PathWithNamespace)
+		}
+	}
+
+	h.enqueue(w, repoURLs)
+}
+
+// enqueue queues the watched repositories among repoURLs and responds with
+// the ones queued.
+func (h *Webhooks) enqueue(w http.ResponseWriter, repoURLs []string) {
+	queued := []string{}
+
+	for _, repoURL := range repoURLs {
+		if repoURL == "" || !h.watched(repoURL) {
+			continue
+		}
+
+		if h.queue.Add(repoURL) {
+			log.Infof("Queued %s for a crawl", repoURL)
+		}
+
+		queued = append(queued, repoURL)
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{"queued": queued})
+}
+
+func githubTouchesPubliccode(commits []*github.HeadCommit) bool {
+	for _, commit := range commits {
+		if touchesPubliccode(commit.Added, commit.Modified, commit.Removed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// touchesPubliccode tells whether any of the changed paths is a publiccode.yml.
+func touchesPubliccode(paths ...[]string) bool {
+	for _, list := range paths {
+		for _, p := range list {
+			if name := path.Base(p); name == "publiccode.yml" || name == "publiccode.yaml" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
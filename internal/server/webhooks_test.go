@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	githubSecret = "hook-secret"
+	gitlabToken  = "hook-token"
+)
+
+func newTestWebhooks(t *testing.T) (*Server, *Queue) {
+	t.Helper()
+
+	queue := NewQueue(nil)
+	s := New(nil, token)
+
+	watched := func(repoURL string) bool { return !strings.Contains(repoURL, "/other/") }
+	NewWebhooks(queue, watched, githubSecret, gitlabToken).Register(s)
+
+	return s, queue
+}
+
+func githubDelivery(t *testing.T, s *Server, event, body, secret string) int {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func gitlabDelivery(t *testing.T, s *Server, event, body, hookToken string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/gitlab", strings.NewReader(body))
+	req.Header.Set("X-Gitlab-Event", event)
+	req.Header.Set("X-Gitlab-Token", hookToken)
+	req.Header.Set("X-Gitlab-Instance", "https://gitlab.example.org")
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	s, queue := newTestWebhooks(t)
+
+	push := func(repo, ref, modified string) string {
+		return `{"ref":"` + ref + `","repository":{"html_url":"https://github.com/` + repo + `",` +
+			`"default_branch":"main"},"commits":[{"modified":["` + modified + `"]}]}`
+	}
+
+	assert.Equal(t, http.StatusUnauthorized,
+		githubDelivery(t, s, "push", push("acme/app", "refs/heads/main", "x.go"), "wrong"))
+	assert.Equal(t, http.StatusAccepted, githubDelivery(t, s, "ping", `{"zen":"hi"}`, githubSecret))
+
+	for _, body := range []string{
+		push("acme/app", "refs/heads/main", "main.go"),
+		push("acme/app", "refs/heads/main", "main.go"),
+		push("acme/lib", "refs/heads/feature", "main.go"),
+		push("acme/docs", "refs/heads/feature", "docs/publiccode.yml"),
+		push("other/app", "refs/heads/main", "publiccode.yml"),
+	} {
+		assert.Equal(t, http.StatusAccepted, githubDelivery(t, s, "push", body, githubSecret))
+	}
+
+	assert.Equal(t, http.StatusAccepted, githubDelivery(t, s, "repository",
+		`{"action":"created","repository":{"html_url":"https://github.com/acme/new"}}`, githubSecret))
+	assert.Equal(t, http.StatusAccepted, githubDelivery(t, s, "installation_repositories",
+		`{"action":"added","repositories_added":[{"full_name":"acme/added"}]}`, githubSecret))
+
+	assert.Equal(t, []string{
+		"https://github.com/acme/app",
+		"https://github.com/acme/docs",
+		"https://github.com/acme/new",
+		"https://github.com/acme/added",
+	}, queue.Pending())
+}
+
+func TestGitLabWebhook(t *testing.T) {
+	s, queue := newTestWebhooks(t)
+
+	assert.Equal(t, http.StatusUnauthorized, gitlabDelivery(t, s, "Push Hook", `{}`, "wrong"))
+
+	require.Equal(t, http.StatusAccepted, gitlabDelivery(t, s, "Push Hook",
+		`{"object_kind":"push","ref":"refs/heads/dev","project":{"web_url":"https://gitlab.example.org/acme/app",`+
+			`"default_branch":"main"},"commits":[{"added":["publiccode.yml"]}]}`, gitlabToken))
+	require.Equal(t, http.StatusAccepted, gitlabDelivery(t, s, "Push Hook",
+		`{"object_kind":"push","ref":"refs/heads/dev","project":{"web_url":"https://gitlab.example.org/acme/lib",`+
+			`"default_branch":"main"},"commits":[{"added":["lib.go"]}]}`, gitlabToken))
+	require.Equal(t, http.StatusAccepted, gitlabDelivery(t, s, "System Hook",
+		`{"event_name":"project_create","path_with_namespace":"acme/new"}`, gitlabToken))
+
+	assert.Equal(t, []string{
+		"https://gitlab.example.org/acme/app",
+		"https://gitlab.example.org/acme/new",
+	}, queue.Pending())
+}
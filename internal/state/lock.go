@@ -0,0 +1,51 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrLocked is returned by Lock when another crawl or gc holds the lock.
+var ErrLocked = errors.New("DATADIR is in use by another crawl or gc")
+
+// Lock takes the lock on DATADIR, so a crawl and gc, or two crawls, don't
+// change the clones and the state at the same time. It doesn't wait: if the
+// lock is held, it returns ErrLocked. The returned func releases the lock; the
+// lock is also released when the process exits.
+func Lock() (func(), error) {
+	datadir := viper.GetString("DATADIR")
+
+	if err := os.MkdirAll(datadir, 0o744); err != nil {
+		return nil, fmt.Errorf("can't create data directory (%s): %w", datadir, err)
+	}
+
+	path := filepath.Join(datadir, "lock")
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open %s: %w", path, err)
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+
+		if errors.Is(err, ErrLocked) {
+			return nil, ErrLocked
+		}
+
+		return nil, fmt.Errorf("can't lock %s: %w", path, err)
+	}
+
+	return func() {
+		if err := unlockFile(f); err != nil {
+			log.Errorf("can't unlock %s: %v", path, err)
+		}
+
+		f.Close()
+	}, nil
+}
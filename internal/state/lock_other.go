@@ -0,0 +1,14 @@
+//go:build !unix
+
+package state
+
+import "os"
+
+// Outside Unix, DATADIR isn't locked: the crawler only runs in containers.
+func lockFile(*os.File) error {
+	return nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package state
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockIsExclusive(t *testing.T) {
+	viper.Set("DATADIR", t.TempDir())
+	defer viper.Set("DATADIR", "")
+
+	unlock, err := Lock()
+	require.NoError(t, err)
+
+	_, err = Lock()
+	require.ErrorIs(t, err, ErrLocked)
+
+	unlock()
+
+	unlock, err = Lock()
+	require.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,88 @@
+// Package state persists small JSON documents under DATADIR/state so the
+// crawler can remember things between runs.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// Path returns the file that backs the state document called name.
+func Path(name string) string {
+	return filepath.Join(viper.GetString("DATADIR"), "state", name+".json")
+}
+
+// Load decodes the state document called name into v. A missing document is
+// not an error and leaves v untouched.
+func Load(name string, v any) error {
+	data, err := os.ReadFile(Path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't read state %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("can't parse state %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Save atomically replaces the state document called name with v.
+func Save(name string, v any) error {
+	return WriteJSON(Path(name), v)
+}
+
+// WriteJSON atomically replaces the file at path with v encoded as indented JSON.
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal %s: %w", filepath.Base(path), err)
+	}
+
+	return WriteFile(path, data)
+}
+
+// WriteFile atomically replaces the file at path with data, creating its
+// directory if needed.
+func WriteFile(path string, data []byte) error {
+	name := filepath.Base(path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o744); err != nil {
+		return fmt.Errorf("can't create directory for %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("can't write %s: %w", name, err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("can't write %s: %w", name, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("can't write %s: %w", name, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("can't write %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -29,6 +29,10 @@ func main() {
 
 	viper.SetDefault("DATADIR", "/app/data")
 	viper.SetDefault("ACTIVITY_DAYS", 60)
+	viper.SetDefault("HTTP_CACHE", true)
+	viper.SetDefault("HTTP_CACHE_MAX_AGE_DAYS", 30)
+	viper.SetDefault("HTTP_CACHE_MAX_SIZE", "1G")
+	viper.SetDefault("REPORT_KEEP", 30)
 
 	if err := viper.ReadInConfig(); err != nil {
 		var notFoundError viper.ConfigFileNotFoundError
@@ -0,0 +1,329 @@
+// Package osv matches dependencies against a local copy of the OSV
+// vulnerability database, so it works without network access.
+package osv
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/sbom"
+	log "github.com/sirupsen/logrus"
+)
+
+var pypiNameRe = regexp.MustCompile(`[-_.]+`)
+
+// supportedEcosystems are the ecosystems sbom extracts dependencies for; other
+// entries in the dump are skipped when loading.
+var supportedEcosystems = map[string]bool{
+	sbom.EcosystemGo:        true,
+	sbom.EcosystemNpm:       true,
+	sbom.EcosystemMaven:     true,
+	sbom.EcosystemPyPI:      true,
+	sbom.EcosystemPackagist: true,
+	sbom.EcosystemRubyGems:  true,
+}
+
+// Database is an in-memory index of OSV entries by package.
+type Database struct {
+	packages map[string][]affectedPackage
+	entries  int
+}
+
+// Finding is a dependency affected by a vulnerability.
+type Finding struct {
+	ID            string
+	Aliases       []string
+	Summary       string
+	Ecosystem     string
+	Package       string
+	Version       string
+	FixedVersions []string
+	// Source is the manifest the dependency was found in.
+	Source string
+}
+
+type affectedPackage struct {
+	id       string
+	aliases  []string
+	summary  string
+	ranges   []osvRange
+	versions map[string]bool
+}
+
+//nolint:tagliatelle // OSV schema field names.
+type osvEntry struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Withdrawn string   `json:"withdrawn"`
+	Affected  []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges   []osvRange `json:"ranges"`
+		Versions []string   `json:"versions"`
+	} `json:"affected"`
+}
+
+//nolint:tagliatelle // OSV schema field names.
+type osvRange struct {
+	Type   string     `json:"type"`
+	Events []osvEvent `json:"events"`
+}
+
+//nolint:tagliatelle // OSV schema field names.
+type osvEvent struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// Load reads the OSV dump in dir: the all.zip files as downloaded from the OSV
+// bucket (e.g. dir/Go/all.zip), or their extracted JSON files.
+func Load(dir string) (*Database, error) {
+	db := &Database{packages: make(map[string][]affectedPackage)}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return nil
+		case strings.EqualFold(filepath.Ext(path), ".zip"):
+			return db.loadZip(path)
+		case strings.EqualFold(filepath.Ext(path), ".json"):
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return db.add(path, f)
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't load OSV database from %s: %w", dir, err)
+	}
+
+	if db.entries == 0 {
+		return nil, fmt.Errorf("no OSV entries found in %s", dir)
+	}
+
+	log.Infof("Loaded %d OSV entries from %s", db.entries, dir)
+
+	return db, nil
+}
+
+func (db *Database) loadZip(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".json") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		err = db.add(path+"/"+f.Name, rc)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// add indexes the entry in r. Entries that can't be parsed are logged and skipped.
+func (db *Database) add(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var entry osvEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Debugf("skipping OSV entry %s: %v", name, err)
+
+		return nil
+	}
+
+	if entry.ID == "" || entry.Withdrawn != "" {
+		return nil
+	}
+
+	indexed := false
+
+	for _, affected := range entry.Affected {
+		ecosystem := affected.Package.Ecosystem
+		if !supportedEcosystems[ecosystem] {
+			continue
+		}
+
+		for _, r := range affected.Ranges {
+			sort.SliceStable(r.Events, func(i, j int) bool {
+				return compareVersions(r.Events[i].version(), r.Events[j].version()) < 0
+			})
+		}
+
+		versions := make(map[string]bool, len(affected.Versions))
+		for _, v := range affected.Versions {
+			versions[v] = true
+		}
+
+		key := packageKey(ecosystem, affected.Package.Name)
+		db.packages[key] = append(db.packages[key], affectedPackage{
+			id:       entry.ID,
+			aliases:  entry.Aliases,
+			summary:  entry.Summary,
+			ranges:   affected.Ranges,
+			versions: versions,
+		})
+		indexed = true
+	}
+
+	if indexed {
+		db.entries++
+	}
+
+	return nil
+}
+
+// Match returns the vulnerabilities affecting components. Components without
+// a pinned version can't be matched and are skipped.
+func (db *Database) Match(components []sbom.Component) []Finding {
+	var findings []Finding
+
+	for _, c := range components {
+		if c.Version == "" {
+			continue
+		}
+
+		seen := make(map[string]bool)
+
+		for _, affected := range db.packages[packageKey(c.Ecosystem, c.Name)] {
+			if seen[affected.id] || !affected.affects(c.Version) {
+				continue
+			}
+
+			seen[affected.id] = true
+
+			findings = append(findings, Finding{
+				ID:            affected.id,
+				Aliases:       affected.aliases,
+				Summary:       affected.summary,
+				Ecosystem:     c.Ecosystem,
+				Package:       c.Name,
+				Version:       c.Version,
+				FixedVersions: affected.fixedVersions(),
+				Source:        c.Source,
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Package != findings[j].Package {
+			return findings[i].Package < findings[j].Package
+		}
+
+		return findings[i].ID < findings[j].ID
+	})
+
+	return findings
+}
+
+func (a affectedPackage) affects(version string) bool {
+	if a.versions[version] || a.versions[strings.TrimPrefix(version, "v")] {
+		return true
+	}
+
+	for _, r := range a.ranges {
+		if (r.Type == "SEMVER" || r.Type == "ECOSYSTEM") && r.affects(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// affects evaluates the range's events, sorted when loading, as described in
+// the OSV schema: introduced opens the range, fixed and last_affected close it.
+func (r osvRange) affects(version string) bool {
+	affected := false
+
+	for _, e := range r.Events {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || compareVersions(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if compareVersions(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if compareVersions(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		}
+	}
+
+	return affected
+}
+
+func (a affectedPackage) fixedVersions() []string {
+	var fixed []string
+
+	for _, r := range a.ranges {
+		for _, e := range r.Events {
+			if e.Fixed != "" {
+				fixed = append(fixed, e.Fixed)
+			}
+		}
+	}
+
+	return fixed
+}
+
+func (e osvEvent) version() string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	default:
+		return e.LastAffected
+	}
+}
+
+func packageKey(ecosystem, name string) string {
+	switch ecosystem {
+	case sbom.EcosystemPyPI:
+		name = pypiNameRe.ReplaceAllString(strings.ToLower(name), "-")
+	case sbom.EcosystemPackagist:
+		name = strings.ToLower(name)
+	}
+
+	return ecosystem + ":" + name
+}
@@ -0,0 +1,122 @@
+package osv
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/sbom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.10", "1.2.9", 1},
+		{"1.0", "1.0.0", 0},
+		{"1.0.1", "1.0", 1},
+		{"1.0.0-beta.2", "1.0.0", -1},
+		{"1.0.0-beta.10", "1.0.0-beta.2", 1},
+		{"1.0rc1", "1.0", -1},
+		{"2.0.0+build.5", "2.0.0", 0},
+		{"0.0.0-20240101000000-abcdef123456", "0.1.0", -1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.want, compareVersions(tc.a, tc.b))
+			assert.Equal(t, -tc.want, compareVersions(tc.b, tc.a))
+		})
+	}
+}
+
+func TestLoadAndMatch(t *testing.T) {
+	dir := t.TempDir()
+
+	writeZip(t, filepath.Join(dir, "npm", "all.zip"), map[string]string{
+		"GHSA-lodash.json": `{
+			"id": "GHSA-lodash",
+			"aliases": ["CVE-2021-23337"],
+			"summary": "Command injection in lodash",
+			"affected": [{
+				"package": {"ecosystem": "npm", "name": "lodash"},
+				"ranges": [{"type": "SEMVER", "events": [{"fixed": "4.17.21"}, {"introduced": "0"}]}]
+			}]
+		}`,
+		"GHSA-withdrawn.json": `{"id": "GHSA-withdrawn", "withdrawn": "2024-01-01T00:00:00Z",
+			"affected": [{"package": {"ecosystem": "npm", "name": "lodash"}, "versions": ["4.17.20"]}]}`,
+		"broken.json": `{`,
+	})
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "PyPI"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PyPI", "PYSEC-1.json"), []byte(`{
+		"id": "PYSEC-1",
+		"affected": [{
+			"package": {"ecosystem": "PyPI", "name": "Typing_Extensions"},
+			"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "4.0"}, {"last_affected": "4.2"}]}],
+			"versions": ["3.9"]
+		}, {
+			"package": {"ecosystem": "Debian:12", "name": "python-typing-extensions"}
+		}]
+	}`), 0o600))
+
+	db, err := Load(dir)
+	require.NoError(t, err)
+
+	findings := db.Match([]sbom.Component{
+		{Ecosystem: sbom.EcosystemNpm, Name: "lodash", Version: "4.17.20", Source: "package-lock.json"},
+		{Ecosystem: sbom.EcosystemNpm, Name: "lodash", Version: "4.17.21"},
+		{Ecosystem: sbom.EcosystemNpm, Name: "react"},
+		{Ecosystem: sbom.EcosystemPyPI, Name: "typing-extensions", Version: "4.2"},
+		{Ecosystem: sbom.EcosystemPyPI, Name: "typing-extensions", Version: "4.3"},
+		{Ecosystem: sbom.EcosystemPyPI, Name: "typing.extensions", Version: "3.9"},
+	})
+
+	assert.Equal(t, []Finding{
+		{
+			ID:            "GHSA-lodash",
+			Aliases:       []string{"CVE-2021-23337"},
+			Summary:       "Command injection in lodash",
+			Ecosystem:     sbom.EcosystemNpm,
+			Package:       "lodash",
+			Version:       "4.17.20",
+			FixedVersions: []string{"4.17.21"},
+			Source:        "package-lock.json",
+		},
+		{ID: "PYSEC-1", Ecosystem: sbom.EcosystemPyPI, Package: "typing-extensions", Version: "4.2"},
+		{ID: "PYSEC-1", Ecosystem: sbom.EcosystemPyPI, Package: "typing.extensions", Version: "3.9"},
+	}, findings)
+}
+
+func TestLoadEmptyDirectory(t *testing.T) {
+	_, err := Load(t.TempDir())
+	require.Error(t, err)
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	w := zip.NewWriter(f)
+
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+
+		_, err = fw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,130 @@
+package osv
+
+import (
+	"strings"
+	"unicode"
+)
+
+// compareVersions compares two versions the way most ecosystems order them:
+// numeric parts numerically, a pre-release (after "-" or a letter suffix such
+// as "rc1") before the release itself. It's an approximation of the
+// ecosystem-specific rules, good enough to evaluate OSV ranges.
+func compareVersions(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+
+	aMain, aPre, _ := strings.Cut(a, "-")
+	bMain, bPre, _ := strings.Cut(b, "-")
+
+	if c := compareParts(tokenize(aMain), tokenize(bMain)); c != 0 {
+		return c
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return compareParts(tokenize(aPre), tokenize(bPre))
+	}
+}
+
+// tokenize splits a version into runs of digits and runs of letters.
+func tokenize(v string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		digits  bool
+	)
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(v) {
+		isDigit := unicode.IsDigit(r)
+
+		if !isDigit && !unicode.IsLetter(r) {
+			flush()
+
+			continue
+		}
+
+		if current.Len() > 0 && isDigit != digits {
+			flush()
+		}
+
+		digits = isDigit
+
+		current.WriteRune(r)
+	}
+
+	flush()
+
+	return tokens
+}
+
+func compareParts(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(a):
+			return -missingPart(b[i])
+		case i >= len(b):
+			return missingPart(a[i])
+		}
+
+		if c := compareToken(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// missingPart compares the extra token of the longer version with nothing:
+// 1.0.1 comes after 1.0, but 1.0rc1 comes before it.
+func missingPart(token string) int {
+	if isNumber(token) {
+		if strings.Trim(token, "0") == "" {
+			return 0
+		}
+
+		return 1
+	}
+
+	return -1
+}
+
+func compareToken(a, b string) int {
+	aNum, bNum := isNumber(a), isNumber(b)
+
+	switch {
+	case aNum && bNum:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(a, b)
+	case aNum:
+		return 1
+	case bNum:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func isNumber(token string) bool {
+	return token != "" && unicode.IsDigit(rune(token[0]))
+}
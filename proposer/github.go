@@ -0,0 +1,196 @@
+package proposer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/google/go-github/v43/github"
+)
+
+// GitHub opens pull requests. With a fork organisation, the branch is pushed
+// to a fork there; otherwise to the repository itself, which needs write
+// access for the GitHub App.
+type GitHub struct {
+	client  *github.Client
+	forkOrg string
+}
+
+// NewGitHub returns a GitHub proposer using client.
+func NewGitHub(client *github.Client, forkOrg string) GitHub {
+	return GitHub{client: client, forkOrg: forkOrg}
+}
+
+// NewGitHubFromEnv returns a GitHub proposer authenticated as
+// githubapp.DefaultAuth picks. Opening pull requests needs a GitHub App or
+// GITHUB_TOKEN.
+func NewGitHubFromEnv(_ context.Context, forkOrg string) (GitHub, error) {
+	auth, err := githubapp.DefaultAuth()
+	if err != nil {
+		return GitHub{}, fmt.Errorf("can't configure GitHub auth: %w", err)
+	}
+
+	if auth.Anonymous() {
+		return GitHub{}, errors.New(
+			"missing GitHub auth env (GIT_OAUTH_CLIENTID/GIT_OAUTH_SECRET or GITHUB_TOKEN)",
+		)
+	}
+
+	client := github.NewClient(&http.Client{Transport: &githubapp.Transport{Auth: auth}})
+
+	return NewGitHub(client, forkOrg), nil
+}
+
+// Propose implements Proposer.
+func (p GitHub) Propose(ctx context.Context, repository common.Repository, contents []byte) (Proposal, error) {
+	owner, name := common.SplitFullName(repository.Name)
+
+	upstream, _, err := p.client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't get %s: %w", repository.Name, err)
+	}
+
+	base := upstream.GetDefaultBranch()
+	headOwner, headRepo := owner, name
+
+	if p.forkOrg != "" {
+		if headRepo, err = p.fork(ctx, owner, name); err != nil {
+			return Proposal{}, err
+		}
+
+		headOwner = p.forkOrg
+	}
+
+	head := headOwner + ":" + Branch
+
+	prs, _, err := p.client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+		State: "all",
+		Head:  head,
+	})
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't list pull requests of %s: %w", repository.Name, err)
+	}
+
+	if len(prs) > 0 {
+		return Proposal{URL: prs[0].GetHTMLURL(), Existing: true}, nil
+	}
+
+	if err := p.ensureBranch(ctx, headOwner, headRepo, base); err != nil {
+		return Proposal{}, err
+	}
+
+	if err := p.ensureFile(ctx, headOwner, headRepo, contents); err != nil {
+		return Proposal{}, err
+	}
+
+	pr, _, err := p.client.PullRequests.Create(ctx, owner, name, &github.NewPullRequest{
+		Title:               github.String(title),
+		Head:                github.String(head),
+		Base:                github.String(base),
+		Body:                github.String(fmt.Sprintf(description, "pull request")),
+		MaintainerCanModify: github.Bool(true),
+	})
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't open pull request on %s: %w", repository.Name, err)
+	}
+
+	return Proposal{URL: pr.GetHTMLURL()}, nil
+}
+
+// fork forks owner/name into the fork organisation, if not done before, and
+// waits until the fork can be used. It returns the name of the fork.
+func (p GitHub) fork(ctx context.Context, owner, name string) (string, error) {
+	fork, _, err := p.client.Repositories.CreateFork(ctx, owner, name, &github.RepositoryCreateForkOptions{
+		Organization: p.forkOrg,
+	})
+
+	var accepted *github.AcceptedError
+	if err != nil && !errors.As(err, &accepted) {
+		return "", fmt.Errorf("can't fork %s/%s into %s: %w", owner, name, p.forkOrg, err)
+	}
+
+	if fork != nil && fork.GetName() != "" {
+		name = fork.GetName()
+	}
+
+	// Forking is asynchronous: the fork exists once its default branch does.
+	for range pollAttempts {
+		if fork, _, err := p.client.Repositories.Get(ctx, p.forkOrg, name); err == nil {
+			if _, _, err := p.client.Git.GetRef(ctx, p.forkOrg, name, "heads/"+fork.GetDefaultBranch()); err == nil {
+				return name, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	return "", fmt.Errorf("fork %s/%s isn't ready", p.forkOrg, name)
+}
+
+// ensureBranch creates Branch from base, unless it exists from an earlier
+// attempt.
+func (p GitHub) ensureBranch(ctx context.Context, owner, repo, base string) error {
+	_, _, err := p.client.Git.GetRef(ctx, owner, repo, "heads/"+Branch)
+	if err == nil {
+		return nil
+	}
+
+	if !isGitHubNotFound(err) {
+		return fmt.Errorf("can't get branch %s of %s/%s: %w", Branch, owner, repo, err)
+	}
+
+	ref, _, err := p.client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		return fmt.Errorf("can't get branch %s of %s/%s: %w", base, owner, repo, err)
+	}
+
+	_, _, err = p.client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + Branch),
+		Object: &github.GitObject{SHA: ref.Object.SHA},
+	})
+	if err != nil {
+		return fmt.Errorf("can't create branch %s on %s/%s: %w", Branch, owner, repo, err)
+	}
+
+	return nil
+}
+
+// ensureFile commits publiccode.yml to Branch, unless it's there from an
+// earlier attempt.
+func (p GitHub) ensureFile(ctx context.Context, owner, repo string, contents []byte) error {
+	_, _, _, err := p.client.Repositories.GetContents(ctx, owner, repo, FileName, &github.RepositoryContentGetOptions{
+		Ref: Branch,
+	})
+	if err == nil {
+		return nil
+	}
+
+	if !isGitHubNotFound(err) {
+		return fmt.Errorf("can't get %s from %s/%s: %w", FileName, owner, repo, err)
+	}
+
+	_, _, err = p.client.Repositories.CreateFile(ctx, owner, repo, FileName, &github.RepositoryContentFileOptions{
+		Message: github.String(commitMessage),
+		Content: contents,
+		Branch:  github.String(Branch),
+	})
+	if err != nil {
+		return fmt.Errorf("can't commit %s to %s/%s: %w", FileName, owner, repo, err)
+	}
+
+	return nil
+}
+
+func isGitHubNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
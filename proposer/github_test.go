@@ -0,0 +1,149 @@
+package proposer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/google/go-github/v43/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub is just enough of the GitHub API for a repository and its pull
+// requests.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	branches map[string]bool
+	files    map[string]bool
+	// pulls maps the head of each pull request to its URL.
+	pulls map[string]string
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *github.Client) {
+	t.Helper()
+
+	f := &fakeGitHub{branches: map[string]bool{"main": true}, files: map[string]bool{}, pulls: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/acme/app", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"name": "app", "default_branch": "main"})
+	})
+	mux.HandleFunc("GET /repos/acme/app/git/ref/heads/{branch}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if !f.branches[r.PathValue("branch")] {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "Not Found"})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"ref":    "refs/heads/" + r.PathValue("branch"),
+			"object": map[string]any{"sha": "abc"},
+		})
+	})
+	mux.HandleFunc("POST /repos/acme/app/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var ref struct{ Ref, SHA string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ref))
+		assert.Equal(t, "refs/heads/"+Branch, ref.Ref)
+		assert.Equal(t, "abc", ref.SHA)
+
+		f.mu.Lock()
+		f.branches[Branch] = true
+		f.mu.Unlock()
+
+		writeJSON(w, http.StatusCreated, ref)
+	})
+	mux.HandleFunc("GET /repos/acme/app/contents/publiccode.yml", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if !f.files[r.URL.Query().Get("ref")] {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "Not Found"})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"type": "file", "name": FileName})
+	})
+	mux.HandleFunc("PUT /repos/acme/app/contents/publiccode.yml", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.RepositoryContentFileOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		assert.Equal(t, Branch, opts.GetBranch())
+		assert.Equal(t, "name: app\n", string(opts.Content))
+
+		f.mu.Lock()
+		f.files[opts.GetBranch()] = true
+		f.mu.Unlock()
+
+		writeJSON(w, http.StatusCreated, map[string]any{})
+	})
+	mux.HandleFunc("GET /repos/acme/app/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		pulls := []map[string]any{}
+
+		if pr, ok := f.pulls[r.URL.Query().Get("head")]; ok {
+			pulls = append(pulls, map[string]any{"state": "closed", "html_url": pr})
+		}
+
+		writeJSON(w, http.StatusOK, pulls)
+	})
+	mux.HandleFunc("POST /repos/acme/app/pulls", func(w http.ResponseWriter, r *http.Request) {
+		var pr github.NewPullRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pr))
+		assert.Equal(t, "main", pr.GetBase())
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.pulls[pr.GetHead()] = "https://github.com/acme/app/pull/1"
+
+		writeJSON(w, http.StatusCreated, map[string]any{"state": "open", "html_url": f.pulls[pr.GetHead()]})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	return f, client
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestGitHubPropose(t *testing.T) {
+	f, client := newFakeGitHub(t)
+	p := NewGitHub(client, "")
+
+	u, err := url.Parse("https://github.com/acme/app")
+	require.NoError(t, err)
+
+	repository := common.Repository{Name: "acme/app", URL: *u}
+
+	proposal, err := p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://github.com/acme/app/pull/1"}, proposal)
+	assert.True(t, f.branches[Branch])
+
+	// Once closed, the pull request still counts: no second one is opened.
+	proposal, err = p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://github.com/acme/app/pull/1", Existing: true}, proposal)
+	assert.Len(t, f.pulls, 1)
+}
@@ -0,0 +1,163 @@
+package proposer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// GitLab opens merge requests on any GitLab instance the token is valid for.
+// With a fork namespace, the branch is pushed to a fork there; otherwise to
+// the project itself, which needs the Developer role for the token's user.
+type GitLab struct {
+	token         string
+	forkNamespace string
+}
+
+// NewGitLab returns a GitLab proposer authenticating with token.
+func NewGitLab(token, forkNamespace string) GitLab {
+	return GitLab{token: token, forkNamespace: forkNamespace}
+}
+
+// Propose implements Proposer.
+func (p GitLab) Propose(ctx context.Context, repository common.Repository, contents []byte) (Proposal, error) {
+	client, err := gitlab.NewClient(p.token, gitlab.WithBaseURL(repository.URL.Scheme+"://"+repository.URL.Host))
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't create GitLab client: %w", err)
+	}
+
+	project, _, err := client.Projects.GetProject(repository.Name, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't get %s: %w", repository.Name, err)
+	}
+
+	source := project
+
+	if p.forkNamespace != "" {
+		if source, err = p.fork(ctx, client, project); err != nil {
+			return Proposal{}, err
+		}
+	}
+
+	mrs, _, err := client.MergeRequests.ListProjectMergeRequests(project.ID, &gitlab.ListProjectMergeRequestsOptions{
+		State:        gitlab.Ptr("all"),
+		SourceBranch: gitlab.Ptr(Branch),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't list merge requests of %s: %w", repository.Name, err)
+	}
+
+	for _, mr := range mrs {
+		if mr.SourceProjectID == source.ID {
+			return Proposal{URL: mr.WebURL, Existing: true}, nil
+		}
+	}
+
+	if err := ensureGitLabBranch(ctx, client, source); err != nil {
+		return Proposal{}, err
+	}
+
+	if err := ensureGitLabFile(ctx, client, source, contents); err != nil {
+		return Proposal{}, err
+	}
+
+	mr, _, err := client.MergeRequests.CreateMergeRequest(source.ID, &gitlab.CreateMergeRequestOptions{
+		Title:              gitlab.Ptr(title),
+		Description:        gitlab.Ptr(fmt.Sprintf(description, "merge request")),
+		SourceBranch:       gitlab.Ptr(Branch),
+		TargetBranch:       gitlab.Ptr(project.DefaultBranch),
+		TargetProjectID:    gitlab.Ptr(project.ID),
+		RemoveSourceBranch: gitlab.Ptr(true),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return Proposal{}, fmt.Errorf("can't open merge request on %s: %w", repository.Name, err)
+	}
+
+	return Proposal{URL: mr.WebURL}, nil
+}
+
+// fork forks the project into the fork namespace, if not done before, and
+// waits until the fork can be used.
+func (p GitLab) fork(ctx context.Context, client *gitlab.Client, project *gitlab.Project) (*gitlab.Project, error) {
+	path := p.forkNamespace + "/" + project.Path
+
+	fork, _, err := client.Projects.GetProject(path, nil, gitlab.WithContext(ctx))
+	if errors.Is(err, gitlab.ErrNotFound) {
+		fork, _, err = client.Projects.ForkProject(project.ID, &gitlab.ForkProjectOptions{
+			NamespacePath: gitlab.Ptr(p.forkNamespace),
+		}, gitlab.WithContext(ctx))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't fork %s into %s: %w", project.PathWithNamespace, p.forkNamespace, err)
+	}
+
+	// Forking is asynchronous: the fork is ready once its default branch exists.
+	for range pollAttempts {
+		_, _, err := client.Branches.GetBranch(fork.ID, project.DefaultBranch, gitlab.WithContext(ctx))
+		if err == nil {
+			return fork, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	return nil, fmt.Errorf("fork %s isn't ready", path)
+}
+
+// ensureGitLabBranch creates Branch from the default branch, unless it exists
+// from an earlier attempt.
+func ensureGitLabBranch(ctx context.Context, client *gitlab.Client, project *gitlab.Project) error {
+	_, _, err := client.Branches.GetBranch(project.ID, Branch, gitlab.WithContext(ctx))
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, gitlab.ErrNotFound) {
+		return fmt.Errorf("can't get branch %s of %s: %w", Branch, project.PathWithNamespace, err)
+	}
+
+	_, _, err = client.Branches.CreateBranch(project.ID, &gitlab.CreateBranchOptions{
+		Branch: gitlab.Ptr(Branch),
+		Ref:    gitlab.Ptr(project.DefaultBranch),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("can't create branch %s on %s: %w", Branch, project.PathWithNamespace, err)
+	}
+
+	return nil
+}
+
+// ensureGitLabFile commits publiccode.yml to Branch, unless it's there from
+// an earlier attempt.
+func ensureGitLabFile(ctx context.Context, client *gitlab.Client, project *gitlab.Project, contents []byte) error {
+	_, _, err := client.RepositoryFiles.GetFileMetaData(project.ID, FileName, &gitlab.GetFileMetaDataOptions{
+		Ref: gitlab.Ptr(Branch),
+	}, gitlab.WithContext(ctx))
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, gitlab.ErrNotFound) {
+		return fmt.Errorf("can't get %s from %s: %w", FileName, project.PathWithNamespace, err)
+	}
+
+	_, _, err = client.RepositoryFiles.CreateFile(project.ID, FileName, &gitlab.CreateFileOptions{
+		Branch:        gitlab.Ptr(Branch),
+		Content:       gitlab.Ptr(string(contents)),
+		CommitMessage: gitlab.Ptr(commitMessage),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("can't commit %s to %s: %w", FileName, project.PathWithNamespace, err)
+	}
+
+	return nil
+}
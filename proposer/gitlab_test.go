@@ -0,0 +1,301 @@
+package proposer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitLab is just enough of the GitLab API for a project, its fork in the
+// bot namespace and their merge requests.
+type fakeGitLab struct {
+	mu sync.Mutex
+	// projects maps the path of each project to its ID.
+	projects map[string]int
+	// branches and files are keyed by project ID, files then by branch.
+	branches map[int]map[string]bool
+	files    map[int]map[string]bool
+	mrs      []fakeMergeRequest
+	// forkPolls is how often the default branch of a new fork isn't there yet.
+	forkPolls int
+	forks     int
+	commits   int
+}
+
+type fakeMergeRequest struct {
+	SourceProjectID int    `json:"source_project_id"`
+	TargetProjectID int    `json:"target_project_id"`
+	SourceBranch    string `json:"source_branch"`
+	State           string `json:"state"`
+	WebURL          string `json:"web_url"`
+}
+
+func newFakeGitLab(t *testing.T) (*fakeGitLab, *url.URL) {
+	t.Helper()
+
+	f := &fakeGitLab{
+		projects: map[string]int{"acme/app": 1},
+		branches: map[int]map[string]bool{1: {"main": true}},
+		files:    map[int]map[string]bool{1: {}},
+	}
+
+	const filePath = "/api/v4/projects/{id}/repository/files/publiccode.yml"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		id, ok := f.project(r.PathValue("id"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "404 Project Not Found"})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, f.projectJSON(id))
+	})
+	mux.HandleFunc("POST /api/v4/projects/1/fork", func(w http.ResponseWriter, r *http.Request) {
+		var opts struct {
+			NamespacePath string `json:"namespace_path"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		assert.Equal(t, "bot", opts.NamespacePath)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.forks++
+		f.projects["bot/app"] = 2
+		f.branches[2] = map[string]bool{"main": true}
+		f.files[2] = map[string]bool{}
+
+		writeJSON(w, http.StatusCreated, f.projectJSON(2))
+	})
+	mux.HandleFunc("GET /api/v4/projects/{id}/repository/branches/{branch}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		id, _ := f.project(r.PathValue("id"))
+		branch := r.PathValue("branch")
+
+		if id == 2 && branch == "main" && f.forkPolls > 0 {
+			f.forkPolls--
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "404 Branch Not Found"})
+
+			return
+		}
+
+		if !f.branches[id][branch] {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "404 Branch Not Found"})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"name": branch})
+	})
+	mux.HandleFunc("POST /api/v4/projects/{id}/repository/branches", func(w http.ResponseWriter, r *http.Request) {
+		var opts struct{ Branch, Ref string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		assert.Equal(t, Branch, opts.Branch)
+		assert.Equal(t, "main", opts.Ref)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		id, _ := f.project(r.PathValue("id"))
+		f.branches[id][opts.Branch] = true
+
+		writeJSON(w, http.StatusCreated, map[string]any{"name": opts.Branch})
+	})
+	mux.HandleFunc("HEAD "+filePath, func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		id, _ := f.project(r.PathValue("id"))
+
+		if !f.files[id][r.URL.Query().Get("ref")] {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("X-Gitlab-File-Name", FileName)
+	})
+	mux.HandleFunc("POST "+filePath, func(w http.ResponseWriter, r *http.Request) {
+		var opts struct{ Branch, Content string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		assert.Equal(t, Branch, opts.Branch)
+		assert.Equal(t, "name: app\n", opts.Content)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		id, _ := f.project(r.PathValue("id"))
+		f.files[id][opts.Branch] = true
+		f.commits++
+
+		writeJSON(w, http.StatusCreated, map[string]any{"file_path": FileName, "branch": opts.Branch})
+	})
+	mux.HandleFunc("GET /api/v4/projects/1/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		mrs := []fakeMergeRequest{}
+
+		for _, mr := range f.mrs {
+			if mr.SourceBranch == r.URL.Query().Get("source_branch") {
+				mrs = append(mrs, mr)
+			}
+		}
+
+		writeJSON(w, http.StatusOK, mrs)
+	})
+	mux.HandleFunc("POST /api/v4/projects/{id}/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		var mr fakeMergeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&mr))
+		assert.Equal(t, 1, mr.TargetProjectID)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		mr.SourceProjectID, _ = f.project(r.PathValue("id"))
+		mr.State = "opened"
+		mr.WebURL = fmt.Sprintf("https://gitlab.example.org/acme/app/-/merge_requests/%d", len(f.mrs)+1)
+		f.mrs = append(f.mrs, mr)
+
+		writeJSON(w, http.StatusCreated, mr)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL + "/acme/app")
+	require.NoError(t, err)
+
+	return f, u
+}
+
+// project returns the ID of the project with the ID or path pid.
+func (f *fakeGitLab) project(pid string) (int, bool) {
+	if id, err := strconv.Atoi(pid); err == nil {
+		return id, id == 1 || (id == 2 && f.forks > 0)
+	}
+
+	id, ok := f.projects[pid]
+
+	return id, ok
+}
+
+func (f *fakeGitLab) projectJSON(id int) map[string]any {
+	path := "acme/app"
+	if id == 2 {
+		path = "bot/app"
+	}
+
+	return map[string]any{"id": id, "path": "app", "path_with_namespace": path, "default_branch": "main"}
+}
+
+func TestGitLabPropose(t *testing.T) {
+	f, u := newFakeGitLab(t)
+	p := NewGitLab("token", "")
+
+	repository := common.Repository{Name: "acme/app", URL: *u}
+
+	// A merge request from another project's branch with the same name doesn't
+	// count.
+	f.mrs = append(f.mrs, fakeMergeRequest{
+		SourceProjectID: 3, TargetProjectID: 1, SourceBranch: Branch, State: "opened",
+		WebURL: "https://gitlab.example.org/acme/app/-/merge_requests/0",
+	})
+
+	proposal, err := p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://gitlab.example.org/acme/app/-/merge_requests/2"}, proposal)
+	assert.True(t, f.branches[1][Branch])
+	assert.True(t, f.files[1][Branch])
+
+	// Once closed, the merge request still counts: no second one is opened.
+	f.mrs[1].State = "closed"
+
+	proposal, err = p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://gitlab.example.org/acme/app/-/merge_requests/2", Existing: true}, proposal)
+	assert.Len(t, f.mrs, 2)
+	assert.Equal(t, 1, f.commits)
+}
+
+func TestGitLabProposeResumesEarlierAttempt(t *testing.T) {
+	f, u := newFakeGitLab(t)
+
+	// An earlier attempt created the branch and committed the file, but didn't
+	// get to open the merge request.
+	f.branches[1][Branch] = true
+	f.files[1][Branch] = true
+
+	proposal, err := NewGitLab("token", "").Propose(
+		context.Background(), common.Repository{Name: "acme/app", URL: *u}, []byte("name: app\n"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://gitlab.example.org/acme/app/-/merge_requests/1"}, proposal)
+	assert.Equal(t, 0, f.commits)
+}
+
+func TestGitLabProposeFromFork(t *testing.T) {
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+
+	pollInterval = time.Millisecond
+
+	f, u := newFakeGitLab(t)
+	f.forkPolls = 2
+	p := NewGitLab("token", "bot")
+
+	repository := common.Repository{Name: "acme/app", URL: *u}
+
+	// The fork is only used once its default branch is there.
+	proposal, err := p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://gitlab.example.org/acme/app/-/merge_requests/1"}, proposal)
+	assert.Equal(t, 0, f.forkPolls)
+	assert.Equal(t, 2, f.mrs[0].SourceProjectID)
+	assert.True(t, f.branches[2][Branch])
+	assert.True(t, f.files[2][Branch])
+	assert.False(t, f.branches[1][Branch])
+
+	// The existing fork and its open merge request are reused.
+	proposal, err = p.Propose(context.Background(), repository, []byte("name: app\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Proposal{URL: "https://gitlab.example.org/acme/app/-/merge_requests/1", Existing: true}, proposal)
+	assert.Equal(t, 1, f.forks)
+	assert.Len(t, f.mrs, 1)
+}
+
+func TestGitLabProposeForkNotReady(t *testing.T) {
+	defer func(interval time.Duration, attempts int) {
+		pollInterval, pollAttempts = interval, attempts
+	}(pollInterval, pollAttempts)
+
+	pollInterval, pollAttempts = time.Millisecond, 3
+
+	f, u := newFakeGitLab(t)
+	f.forkPolls = 5
+
+	_, err := NewGitLab("token", "bot").Propose(
+		context.Background(), common.Repository{Name: "acme/app", URL: *u}, []byte("name: app\n"),
+	)
+	require.ErrorContains(t, err, "fork bot/app isn't ready")
+	assert.Empty(t, f.mrs)
+}
@@ -0,0 +1,50 @@
+// Package proposer opens pull and merge requests that add a publiccode.yml to
+// repositories lacking one.
+package proposer
+
+import (
+	"context"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+)
+
+const (
+	// Branch is the branch the proposed publiccode.yml is committed to. It's the
+	// same for every repository, which is what makes proposing idempotent: an
+	// existing pull or merge request from it, open or closed, is never repeated.
+	Branch   = "add-publiccode-yml"
+	FileName = "publiccode.yml"
+
+	commitMessage = "Add publiccode.yml"
+	title         = "publiccode.yml toevoegen"
+	// description is formatted with the name of the request: pull or merge.
+	description = `Deze %[1]s voegt een publiccode.yml toe, zodat de software vindbaar
+wordt in het register van developer.overheid.nl.
+
+Het bestand is automatisch ingevuld op basis van de repository. Bovenaan staat
+welke velden een controle nodig hebben; pas ze gerust aan in deze branch. Zie
+https://yml.publiccode.tools voor de betekenis van alle velden.
+
+Geen interesse? Sluit deze %[1]s, dan volgt er geen nieuwe.`
+)
+
+// pollInterval and pollAttempts bound how long to wait for a fork to be ready.
+var (
+	pollInterval = 5 * time.Second
+	pollAttempts = 24
+)
+
+// Proposal is a pull or merge request adding publiccode.yml.
+type Proposal struct {
+	URL string
+	// Existing is true when the request was opened before, and may have been
+	// closed since.
+	Existing bool
+}
+
+// Proposer opens a pull or merge request adding contents as publiccode.yml to
+// the repository, or returns the one opened before.
+type Proposer interface {
+	Propose(ctx context.Context, repository common.Repository, contents []byte) (Proposal, error)
+}
@@ -0,0 +1,182 @@
+// Package sbom extracts the dependencies of a repository from the manifests in
+// its clone and describes them as a CycloneDX software bill of materials.
+package sbom
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+)
+
+// maxManifests caps the number of manifests read from a single repository.
+const maxManifests = 100
+
+// Ecosystems, named as in the OSV schema.
+const (
+	EcosystemGo        = "Go"
+	EcosystemNpm       = "npm"
+	EcosystemMaven     = "Maven"
+	EcosystemPyPI      = "PyPI"
+	EcosystemPackagist = "Packagist"
+	EcosystemRubyGems  = "RubyGems"
+)
+
+// Component is a dependency declared in a manifest. Version is empty when the
+// manifest only has a range and no lockfile pins it.
+type Component struct {
+	Ecosystem string
+	// Name is the package name in its ecosystem, e.g. groupId:artifactId for Maven.
+	Name    string
+	Version string
+	// Source is the path of the manifest the dependency was found in.
+	Source string
+}
+
+// PURL returns the package URL of the component.
+func (c Component) PURL() string {
+	var typ, namespace, name string
+
+	switch c.Ecosystem {
+	case EcosystemGo:
+		typ = "golang"
+		namespace, name = path.Split(c.Name)
+	case EcosystemNpm:
+		typ = "npm"
+		if strings.HasPrefix(c.Name, "@") {
+			namespace, name = path.Split(c.Name)
+		} else {
+			name = c.Name
+		}
+	case EcosystemMaven:
+		typ = "maven"
+		namespace, name, _ = strings.Cut(c.Name, ":")
+	case EcosystemPyPI:
+		typ = "pypi"
+		name = strings.ReplaceAll(strings.ToLower(c.Name), "_", "-")
+	case EcosystemPackagist:
+		typ = "composer"
+		namespace, name = path.Split(c.Name)
+	case EcosystemRubyGems:
+		typ = "gem"
+		name = c.Name
+	default:
+		return ""
+	}
+
+	purl := "pkg:" + typ + "/"
+
+	if namespace = strings.Trim(namespace, "/"); namespace != "" {
+		for _, segment := range strings.Split(namespace, "/") {
+			purl += purlEscape(segment) + "/"
+		}
+	}
+
+	purl += purlEscape(name)
+
+	if c.Version != "" {
+		purl += "@" + purlEscape(c.Version)
+	}
+
+	return purl
+}
+
+// purlEscape percent-encodes a package URL segment, including the @ that
+// would otherwise be read as the start of the version.
+func purlEscape(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "@", "%40")
+}
+
+// ReadRepository returns the dependencies declared in the manifests in the
+// HEAD tree of the repository's bare clone.
+func ReadRepository(repository common.Repository) ([]Component, error) {
+	files, err := git.ReadHeadFiles(repository, IsManifest, maxManifests)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromFiles(files), nil
+}
+
+// FromFiles parses the manifests in files. When a directory has a lockfile,
+// the less precise manifest next to it (e.g. package.json) is ignored.
+func FromFiles(files []git.File) []Component {
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file.Path] = true
+	}
+
+	seen := make(map[string]bool)
+
+	var components []Component
+
+	for _, file := range files {
+		if supersededByLockfile(file.Path, present) {
+			continue
+		}
+
+		for _, c := range parseManifest(file) {
+			key := c.Ecosystem + " " + c.Name + " " + c.Version
+			if c.Name == "" || seen[key] {
+				continue
+			}
+
+			seen[key] = true
+
+			components = append(components, c)
+		}
+	}
+
+	sort.SliceStable(components, func(i, j int) bool {
+		if components[i].Ecosystem != components[j].Ecosystem {
+			return components[i].Ecosystem < components[j].Ecosystem
+		}
+
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
+
+// IsManifest tells whether the file at p is a manifest FromFiles understands.
+// Vendored dependencies are skipped.
+func IsManifest(p string) bool {
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if dir == "node_modules" || dir == "vendor" {
+			return false
+		}
+	}
+
+	_, ok := parsers[path.Base(p)]
+
+	return ok
+}
+
+func supersededByLockfile(p string, present map[string]bool) bool {
+	dir := path.Dir(p)
+
+	for _, lockfile := range lockfiles[path.Base(p)] {
+		if present[path.Join(dir, lockfile)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseManifest(file git.File) []Component {
+	parse, ok := parsers[path.Base(file.Path)]
+	if !ok {
+		return nil
+	}
+
+	components := parse(file.Contents)
+	for i := range components {
+		components[i].Source = file.Path
+	}
+
+	return components
+}
@@ -0,0 +1,129 @@
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/state"
+	"github.com/spf13/viper"
+)
+
+const cycloneDXSpecVersion = "1.5"
+
+// Document is a CycloneDX JSON document. Only the fields the crawler fills in
+// are modelled.
+//
+//nolint:tagliatelle // CycloneDX field names.
+type Document struct {
+	BOMFormat    string     `json:"bomFormat"`
+	SpecVersion  string     `json:"specVersion"`
+	SerialNumber string     `json:"serialNumber"`
+	Version      int        `json:"version"`
+	Metadata     Metadata   `json:"metadata"`
+	Components   []BOMEntry `json:"components"`
+}
+
+// Metadata describes the repository the SBOM is about.
+type Metadata struct {
+	Timestamp time.Time `json:"timestamp"`
+	Component BOMEntry  `json:"component"`
+}
+
+// BOMEntry is a CycloneDX component.
+//
+//nolint:tagliatelle // CycloneDX field names.
+type BOMEntry struct {
+	Type               string              `json:"type"`
+	BOMRef             string              `json:"bom-ref,omitempty"`
+	Name               string              `json:"name"`
+	Group              string              `json:"group,omitempty"`
+	Version            string              `json:"version,omitempty"`
+	PURL               string              `json:"purl,omitempty"`
+	ExternalReferences []ExternalReference `json:"externalReferences,omitempty"`
+	Properties         []Property          `json:"properties,omitempty"`
+}
+
+// ExternalReference links to something outside the SBOM, like the repository.
+type ExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Property is a name/value pair.
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// sourceProperty records which manifest a component was found in.
+const sourceProperty = "don:manifest"
+
+// CycloneDX returns a CycloneDX SBOM for the repository with its components.
+func CycloneDX(repository common.Repository, components []Component) Document {
+	doc := Document{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: Metadata{
+			Timestamp: time.Now().UTC(),
+			Component: BOMEntry{
+				Type:    "application",
+				Name:    repository.Name,
+				Version: repository.Version,
+				ExternalReferences: []ExternalReference{
+					{Type: "vcs", URL: repository.CanonicalURL.String()},
+				},
+			},
+		},
+		Components: make([]BOMEntry, 0, len(components)),
+	}
+
+	for _, c := range components {
+		entry := BOMEntry{
+			Type:       "library",
+			BOMRef:     c.PURL(),
+			Name:       c.Name,
+			Version:    c.Version,
+			PURL:       c.PURL(),
+			Properties: []Property{{Name: sourceProperty, Value: c.Source}},
+		}
+
+		if c.Ecosystem == EcosystemMaven {
+			entry.Group, entry.Name, _ = strings.Cut(c.Name, ":")
+		}
+
+		doc.Components = append(doc.Components, entry)
+	}
+
+	return doc
+}
+
+// Path returns where the SBOM of the repository is stored:
+// DATADIR/sbom/<host>/<vendor>/<repo>.cdx.json.
+func Path(repository common.Repository) string {
+	return filepath.Join(
+		viper.GetString("DATADIR"), "sbom", repository.URL.Host, filepath.FromSlash(repository.Name)+".cdx.json",
+	)
+}
+
+// Save writes doc to Path(repository).
+func Save(repository common.Repository, doc Document) error {
+	return state.WriteJSON(Path(repository), doc)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+
+	_, _ = rand.Read(b[:])
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
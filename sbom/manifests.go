@@ -0,0 +1,420 @@
+package sbom
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// parsers maps manifest file names to their parser.
+var parsers = map[string]func(contents string) []Component{
+	"go.mod":            parseGoMod,
+	"package.json":      parsePackageJSON,
+	"package-lock.json": parsePackageLock,
+	"yarn.lock":         parseYarnLock,
+	"pom.xml":           parsePom,
+	"requirements.txt":  parseRequirements,
+	"composer.json":     parseComposerJSON,
+	"composer.lock":     parseComposerLock,
+	"Gemfile":           parseGemfile,
+	"Gemfile.lock":      parseGemfileLock,
+}
+
+// lockfiles maps manifests to the lockfiles that pin their dependencies.
+var lockfiles = map[string][]string{
+	"package.json":  {"package-lock.json", "yarn.lock"},
+	"composer.json": {"composer.lock"},
+	"Gemfile":       {"Gemfile.lock"},
+}
+
+var (
+	requirementRe  = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(?:\[[^\]]*\])?\s*(?:==\s*([^\s;,#]+))?`)
+	gemfileGemRe   = regexp.MustCompile(`^\s*gem\s+["']([^"']+)["'](?:\s*,\s*["']\s*(?:=\s*)?([0-9][^"']*)["'])?`)
+	gemfileLockRe  = regexp.MustCompile(`^    ([^\s(]+) \(([^)]+)\)$`)
+	yarnVersionRe  = regexp.MustCompile(`^\s+version:?\s+"?([^"\s]+)"?`)
+	pomPropertyRe  = regexp.MustCompile(`\$\{([^}]+)\}`)
+	exactVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9A-Za-z-]+)*(\+[0-9A-Za-z.-]+)?$`)
+)
+
+func parseGoMod(contents string) []Component {
+	var (
+		components []Component
+		inRequire  bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 0:
+			continue
+		case inRequire && fields[0] == ")":
+			inRequire = false
+
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !inRequire:
+			continue
+		}
+
+		if len(fields) >= 2 {
+			components = append(components, Component{Ecosystem: EcosystemGo, Name: fields[0], Version: fields[1]})
+		}
+	}
+
+	return components
+}
+
+// parsePackageJSON returns the dependencies of a package.json. Versions are
+// only kept when they're exact, ranges can't be resolved without a lockfile.
+func parsePackageJSON(contents string) []Component {
+	var manifest struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"` //nolint:tagliatelle // package.json field.
+	}
+
+	if err := json.Unmarshal([]byte(contents), &manifest); err != nil {
+		return nil
+	}
+
+	var components []Component
+
+	for _, deps := range []map[string]string{manifest.Dependencies, manifest.DevDependencies} {
+		for name, version := range deps {
+			components = append(components, Component{
+				Ecosystem: EcosystemNpm,
+				Name:      name,
+				Version:   exactVersion(strings.TrimPrefix(version, "=")),
+			})
+		}
+	}
+
+	return sortComponents(components)
+}
+
+func parsePackageLock(contents string) []Component {
+	var lock struct {
+		// Packages is used by lockfile version 2 and 3, keyed by node_modules path.
+		Packages map[string]struct {
+			Version string `json:"version"`
+			Link    bool   `json:"link"`
+		} `json:"packages"`
+		// Dependencies is used by lockfile version 1.
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+
+	if err := json.Unmarshal([]byte(contents), &lock); err != nil {
+		return nil
+	}
+
+	var components []Component
+
+	if len(lock.Packages) > 0 {
+		for key, pkg := range lock.Packages {
+			idx := strings.LastIndex(key, "node_modules/")
+			if idx < 0 || pkg.Link || pkg.Version == "" {
+				continue
+			}
+
+			components = append(components, Component{
+				Ecosystem: EcosystemNpm,
+				Name:      key[idx+len("node_modules/"):],
+				Version:   pkg.Version,
+			})
+		}
+
+		return sortComponents(components)
+	}
+
+	for name, dep := range lock.Dependencies {
+		components = append(components, Component{Ecosystem: EcosystemNpm, Name: name, Version: dep.Version})
+	}
+
+	return sortComponents(components)
+}
+
+// parseYarnLock supports both the classic and the berry yarn.lock format.
+func parseYarnLock(contents string) []Component {
+	var (
+		components []Component
+		names      []string
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			names = nil
+		case !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":"):
+			names = nil
+
+			for _, spec := range strings.Split(strings.TrimSuffix(line, ":"), ",") {
+				spec = strings.Trim(strings.TrimSpace(spec), `"`)
+
+				// The name ends at the last @, which isn't the scope's.
+				if idx := strings.LastIndex(spec, "@"); idx > 0 {
+					names = append(names, spec[:idx])
+				}
+			}
+		case len(names) > 0:
+			m := yarnVersionRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+
+			components = append(components, Component{Ecosystem: EcosystemNpm, Name: names[0], Version: m[1]})
+			names = nil
+		}
+	}
+
+	return components
+}
+
+type pomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+type pomProject struct {
+	GroupID    string        `xml:"groupId"`
+	Version    string        `xml:"version"`
+	Parent     pomDependency `xml:"parent"`
+	Properties struct {
+		Entries []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+	Dependencies         []pomDependency `xml:"dependencies>dependency"`
+	DependencyManagement []pomDependency `xml:"dependencyManagement>dependencies>dependency"`
+}
+
+// parsePom returns the dependencies of a pom.xml, resolving ${...} versions
+// from the pom's own properties. Properties inherited from a parent pom can't be
+// resolved and leave the version empty.
+func parsePom(contents string) []Component {
+	var project pomProject
+	if err := xml.Unmarshal([]byte(contents), &project); err != nil {
+		return nil
+	}
+
+	// groupId and version are inherited from the parent when not set.
+	if project.GroupID == "" {
+		project.GroupID = project.Parent.GroupID
+	}
+
+	if project.Version == "" {
+		project.Version = project.Parent.Version
+	}
+
+	properties := map[string]string{
+		"project.version":        project.Version,
+		"project.groupId":        project.GroupID,
+		"project.parent.version": project.Parent.Version,
+	}
+
+	for _, entry := range project.Properties.Entries {
+		properties[entry.XMLName.Local] = strings.TrimSpace(entry.Value)
+	}
+
+	resolve := func(value string) string {
+		value = strings.TrimSpace(value)
+		for range 5 {
+			if !pomPropertyRe.MatchString(value) {
+				return value
+			}
+
+			value = pomPropertyRe.ReplaceAllStringFunc(value, func(ref string) string {
+				return properties[ref[2:len(ref)-1]]
+			})
+		}
+
+		return ""
+	}
+
+	managed := make(map[string]string, len(project.DependencyManagement))
+	for _, dep := range project.DependencyManagement {
+		managed[resolve(dep.GroupID)+":"+resolve(dep.ArtifactID)] = resolve(dep.Version)
+	}
+
+	components := make([]Component, 0, len(project.Dependencies))
+
+	for _, dep := range project.Dependencies {
+		name := resolve(dep.GroupID) + ":" + resolve(dep.ArtifactID)
+
+		version := resolve(dep.Version)
+		if version == "" {
+			version = managed[name]
+		}
+
+		components = append(components, Component{Ecosystem: EcosystemMaven, Name: name, Version: version})
+	}
+
+	return components
+}
+
+func parseRequirements(contents string) []Component {
+	var components []Component
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+
+		m := requirementRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		components = append(components, Component{Ecosystem: EcosystemPyPI, Name: m[1], Version: m[2]})
+	}
+
+	return components
+}
+
+func parseComposerJSON(contents string) []Component {
+	var manifest struct {
+		Require    map[string]string `json:"require"`
+		RequireDev map[string]string `json:"require-dev"` //nolint:tagliatelle // composer.json field.
+	}
+
+	if err := json.Unmarshal([]byte(contents), &manifest); err != nil {
+		return nil
+	}
+
+	var components []Component
+
+	for _, deps := range []map[string]string{manifest.Require, manifest.RequireDev} {
+		for name, version := range deps {
+			if !isComposerPackage(name) {
+				continue
+			}
+
+			components = append(components, Component{
+				Ecosystem: EcosystemPackagist,
+				Name:      name,
+				Version:   exactVersion(strings.TrimPrefix(version, "v")),
+			})
+		}
+	}
+
+	return sortComponents(components)
+}
+
+func parseComposerLock(contents string) []Component {
+	type lockPackage struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	var lock struct {
+		Packages    []lockPackage `json:"packages"`
+		PackagesDev []lockPackage `json:"packages-dev"` //nolint:tagliatelle // composer.lock field.
+	}
+
+	if err := json.Unmarshal([]byte(contents), &lock); err != nil {
+		return nil
+	}
+
+	components := make([]Component, 0, len(lock.Packages)+len(lock.PackagesDev))
+
+	for _, pkg := range append(lock.Packages, lock.PackagesDev...) {
+		components = append(components, Component{
+			Ecosystem: EcosystemPackagist,
+			Name:      pkg.Name,
+			Version:   strings.TrimPrefix(pkg.Version, "v"),
+		})
+	}
+
+	return components
+}
+
+func parseGemfile(contents string) []Component {
+	var components []Component
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		m := gemfileGemRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		components = append(components, Component{
+			Ecosystem: EcosystemRubyGems,
+			Name:      m[1],
+			Version:   exactVersion(strings.TrimSpace(m[2])),
+		})
+	}
+
+	return components
+}
+
+// parseGemfileLock reads the specs of the GEM section of a Gemfile.lock.
+func parseGemfileLock(contents string) []Component {
+	var (
+		components []Component
+		inGems     bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line != "" && !strings.HasPrefix(line, " ") {
+			inGems = line == "GEM"
+
+			continue
+		}
+
+		if !inGems {
+			continue
+		}
+
+		if m := gemfileLockRe.FindStringSubmatch(line); m != nil {
+			components = append(components, Component{Ecosystem: EcosystemRubyGems, Name: m[1], Version: m[2]})
+		}
+	}
+
+	return components
+}
+
+// exactVersion returns version if it pins a single version, "" otherwise.
+func exactVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if !exactVersionRe.MatchString(version) {
+		return ""
+	}
+
+	return version
+}
+
+// isComposerPackage filters out platform requirements like php and ext-json.
+func isComposerPackage(name string) bool {
+	return strings.Contains(name, "/")
+}
+
+// sortComponents sorts components parsed from maps, so the output is stable.
+func sortComponents(components []Component) []Component {
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
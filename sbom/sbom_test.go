@@ -0,0 +1,179 @@
+package sbom
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []Component
+	}{
+		{
+			name: "go.mod",
+			contents: "module example.org/app\n\ngo 1.25\n\nrequire github.com/spf13/viper v1.21.0\n\n" +
+				"require (\n\tgithub.com/sirupsen/logrus v1.9.4 // indirect\n)\n\nreplace foo => ./foo\n",
+			want: []Component{
+				{Ecosystem: EcosystemGo, Name: "github.com/spf13/viper", Version: "v1.21.0"},
+				{Ecosystem: EcosystemGo, Name: "github.com/sirupsen/logrus", Version: "v1.9.4"},
+			},
+		},
+		{
+			name:     "package.json",
+			contents: `{"dependencies": {"react": "^18.2.0", "lodash": "4.17.21"}, "devDependencies": {"@types/node": "20.1.0"}}`,
+			want: []Component{
+				{Ecosystem: EcosystemNpm, Name: "@types/node", Version: "20.1.0"},
+				{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.21"},
+				{Ecosystem: EcosystemNpm, Name: "react"},
+			},
+		},
+		{
+			name: "package-lock.json",
+			contents: `{"lockfileVersion": 3, "packages": {"": {"name": "app"},` +
+				`"node_modules/@babel/core": {"version": "7.24.0"},` +
+				`"node_modules/a/node_modules/b": {"version": "1.0.0"},` +
+				`"node_modules/local": {"link": true}}}`,
+			want: []Component{
+				{Ecosystem: EcosystemNpm, Name: "@babel/core", Version: "7.24.0"},
+				{Ecosystem: EcosystemNpm, Name: "b", Version: "1.0.0"},
+			},
+		},
+		{
+			name: "yarn.lock",
+			contents: "# yarn lockfile v1\n\n\"@babel/code-frame@^7.0.0\", \"@babel/code-frame@^7.22.13\":\n" +
+				"  version \"7.22.13\"\n  resolved \"https://registry.yarnpkg.com/x\"\n\n" +
+				"\"lodash@npm:^4.17.21\":\n  version: 4.17.21\n",
+			want: []Component{
+				{Ecosystem: EcosystemNpm, Name: "@babel/code-frame", Version: "7.22.13"},
+				{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.21"},
+			},
+		},
+		{
+			name: "pom.xml",
+			contents: `<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <parent><groupId>nl.example</groupId><version>2.0.0</version></parent>
+  <properties><jackson.version>2.17.0</jackson.version></properties>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId><version>2.0.12</version></dependency>
+  </dependencies></dependencyManagement>
+  <dependencies>
+    <dependency><groupId>com.fasterxml.jackson.core</groupId><artifactId>jackson-databind</artifactId>` +
+				`<version>${jackson.version}</version></dependency>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId></dependency>
+    <dependency><groupId>${project.groupId}</groupId><artifactId>common</artifactId>` +
+				`<version>${project.version}</version></dependency>
+  </dependencies>
+</project>`,
+			want: []Component{
+				{Ecosystem: EcosystemMaven, Name: "com.fasterxml.jackson.core:jackson-databind", Version: "2.17.0"},
+				{Ecosystem: EcosystemMaven, Name: "org.slf4j:slf4j-api", Version: "2.0.12"},
+				{Ecosystem: EcosystemMaven, Name: "nl.example:common", Version: "2.0.0"},
+			},
+		},
+		{
+			name:     "requirements.txt",
+			contents: "# deps\n-r base.txt\nDjango==4.2.11\nrequests[security] == 2.31.0 ; python_version > '3'\nnumpy>=1.26\n",
+			want: []Component{
+				{Ecosystem: EcosystemPyPI, Name: "Django", Version: "4.2.11"},
+				{Ecosystem: EcosystemPyPI, Name: "requests", Version: "2.31.0"},
+				{Ecosystem: EcosystemPyPI, Name: "numpy"},
+			},
+		},
+		{
+			name:     "composer.json",
+			contents: `{"require": {"php": ">=8.1", "ext-json": "*", "monolog/monolog": "3.5.0", "symfony/console": "^6.4"}}`,
+			want: []Component{
+				{Ecosystem: EcosystemPackagist, Name: "monolog/monolog", Version: "3.5.0"},
+				{Ecosystem: EcosystemPackagist, Name: "symfony/console"},
+			},
+		},
+		{
+			name:     "composer.lock",
+			contents: `{"packages": [{"name": "monolog/monolog", "version": "3.5.0"}], "packages-dev": [{"name": "phpunit/phpunit", "version": "v10.5.0"}]}`,
+			want: []Component{
+				{Ecosystem: EcosystemPackagist, Name: "monolog/monolog", Version: "3.5.0"},
+				{Ecosystem: EcosystemPackagist, Name: "phpunit/phpunit", Version: "10.5.0"},
+			},
+		},
+		{
+			name:     "Gemfile",
+			contents: "source 'https://rubygems.org'\ngem 'rails', '7.1.3'\ngem \"puma\", \"~> 6.0\"\n",
+			want: []Component{
+				{Ecosystem: EcosystemRubyGems, Name: "rails", Version: "7.1.3"},
+				{Ecosystem: EcosystemRubyGems, Name: "puma"},
+			},
+		},
+		{
+			name: "Gemfile.lock",
+			contents: "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (3.0.9)\n    rails (7.1.3)\n" +
+				"      rack (>= 2.2.4)\n\nPLATFORMS\n  ruby\n",
+			want: []Component{
+				{Ecosystem: EcosystemRubyGems, Name: "rack", Version: "3.0.9"},
+				{Ecosystem: EcosystemRubyGems, Name: "rails", Version: "7.1.3"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parsers[tc.name](tc.contents))
+		})
+	}
+}
+
+func TestFromFilesPrefersLockfiles(t *testing.T) {
+	components := FromFiles([]git.File{
+		{Path: "web/package.json", Contents: `{"dependencies": {"lodash": "^4.17.0"}}`},
+		{Path: "web/package-lock.json", Contents: `{"packages": {"node_modules/lodash": {"version": "4.17.21"}}}`},
+		{Path: "tools/package.json", Contents: `{"dependencies": {"lodash": "4.17.21"}}`},
+		{Path: "go.mod", Contents: "require github.com/spf13/viper v1.21.0\n"},
+	})
+
+	assert.Equal(t, []Component{
+		{Ecosystem: EcosystemGo, Name: "github.com/spf13/viper", Version: "v1.21.0", Source: "go.mod"},
+		{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.21", Source: "web/package-lock.json"},
+	}, components)
+}
+
+func TestIsManifest(t *testing.T) {
+	assert.True(t, IsManifest("go.mod"))
+	assert.True(t, IsManifest("frontend/package-lock.json"))
+	assert.False(t, IsManifest("node_modules/foo/package.json"))
+	assert.False(t, IsManifest("vendor/github.com/foo/go.mod"))
+	assert.False(t, IsManifest("README.md"))
+}
+
+func TestPURL(t *testing.T) {
+	assert.Equal(t, "pkg:golang/github.com/spf13/viper@v1.21.0",
+		Component{Ecosystem: EcosystemGo, Name: "github.com/spf13/viper", Version: "v1.21.0"}.PURL())
+	assert.Equal(t, "pkg:npm/%40babel/core@7.24.0",
+		Component{Ecosystem: EcosystemNpm, Name: "@babel/core", Version: "7.24.0"}.PURL())
+	assert.Equal(t, "pkg:maven/org.slf4j/slf4j-api@2.0.12",
+		Component{Ecosystem: EcosystemMaven, Name: "org.slf4j:slf4j-api", Version: "2.0.12"}.PURL())
+	assert.Equal(t, "pkg:pypi/typing-extensions",
+		Component{Ecosystem: EcosystemPyPI, Name: "Typing_Extensions"}.PURL())
+}
+
+func TestCycloneDX(t *testing.T) {
+	u, err := url.Parse("https://github.com/example/app.git")
+	require.NoError(t, err)
+
+	doc := CycloneDX(common.Repository{Name: "example/app", CanonicalURL: *u}, []Component{
+		{Ecosystem: EcosystemMaven, Name: "org.slf4j:slf4j-api", Version: "2.0.12", Source: "pom.xml"},
+	})
+
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Regexp(t, `^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, doc.SerialNumber)
+	assert.Equal(t, "https://github.com/example/app.git", doc.Metadata.Component.ExternalReferences[0].URL)
+	require.Len(t, doc.Components, 1)
+	assert.Equal(t, "org.slf4j", doc.Components[0].Group)
+	assert.Equal(t, "slf4j-api", doc.Components[0].Name)
+	assert.Equal(t, "pkg:maven/org.slf4j/slf4j-api@2.0.12", doc.Components[0].PURL)
+}
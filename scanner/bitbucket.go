@@ -3,11 +3,13 @@ package scanner
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/httpcache"
 	"github.com/ktrysmt/go-bitbucket"
 	log "github.com/sirupsen/logrus"
 )
@@ -18,6 +20,7 @@ type BitBucketScanner struct {
 
 func NewBitBucketScanner() Scanner {
 	client, _ := bitbucket.NewBasicAuth("", "")
+	client.HttpClient = &http.Client{Transport: httpcache.New(nil)}
 
 	return BitBucketScanner{client: client}
 }
@@ -60,39 +63,35 @@ func (scanner BitBucketScanner) ScanGroupOfRepos(
 			continue
 		}
 
-		opt := &bitbucket.RepositoryFilesOptions{
-			Owner:    owner,
-			RepoSlug: r.Slug,
-			Ref:      r.Mainbranch.Name,
-			Path:     "publiccode.yml",
-		}
-
-		res, err := scanner.client.Repositories.Repository.GetFileContent(opt)
+		ref, err := scanner.bitbucketPubliccodeRef(owner, r.Slug, r.Mainbranch.Name, publisher)
 		if err != nil {
 			log.Infof("[%s]: no publiccode.yml: %s", r.Full_name, err.Error())
 
 			continue
 		}
 
-		if res != nil {
-			u, err := url.Parse(fmt.Sprintf("https://bitbucket.org/%s/%s.git", owner, r.Slug))
-			if err != nil {
-				return fmt.Errorf("failed to get canonical repo URL for %s: %w", url.String(), err)
-			}
-
-			repositories <- common.Repository{
-				Name:         r.Full_name,
-				Title:        r.Name,
-				Description:  r.Description,
-				FileRawURL:   fmt.Sprintf("https://bitbucket.org/%s/%s/raw/%s/publiccode.yml", owner, r.Slug, r.Mainbranch.Name),
-				URL:          *u,
-				CanonicalURL: *u,
-				IsFork:       bitbucketRepositoryIsFork(&r),
-				GitBranch:    r.Mainbranch.Name,
-				CreatedAt:    bitbucketTime(r.CreatedOnTime),
-				UpdatedAt:    bitbucketTime(r.UpdatedOnTime),
-				Publisher:    publisher,
-			}
+		u, err := url.Parse(fmt.Sprintf("https://bitbucket.org/%s/%s.git", owner, r.Slug))
+		if err != nil {
+			return fmt.Errorf("failed to get canonical repo URL for %s: %w", url.String(), err)
+		}
+
+		repositories <- common.Repository{
+			Name:          r.Full_name,
+			ProviderID:    r.Uuid,
+			Title:         r.Name,
+			Description:   r.Description,
+			FileRawURL:    fmt.Sprintf("https://bitbucket.org/%s/%s/raw/%s/publiccode.yml", owner, r.Slug, ref.name),
+			PubliccodeRef: ref.name,
+			Version:       ref.version,
+			URL:           *u,
+			CanonicalURL:  *u,
+			IsFork:        bitbucketRepositoryIsFork(&r),
+			UpstreamURL:   bitbucketUpstreamURL(&r),
+			Languages:     bitbucketLanguages(&r),
+			GitBranch:     r.Mainbranch.Name,
+			CreatedAt:     bitbucketTime(r.CreatedOnTime),
+			UpdatedAt:     bitbucketTime(r.UpdatedOnTime),
+			Publisher:     publisher,
 		}
 	}
 
@@ -123,37 +122,33 @@ func (scanner BitBucketScanner) ScanRepo(
 		return err
 	}
 
-	filesOpt := &bitbucket.RepositoryFilesOptions{
-		Owner:    owner,
-		RepoSlug: slug,
-		Ref:      "HEAD",
-		Path:     "publiccode.yml",
-	}
-
-	res, err := scanner.client.Repositories.Repository.GetFileContent(filesOpt)
+	ref, err := scanner.bitbucketPubliccodeRef(owner, slug, repo.Mainbranch.Name, publisher)
 	if err != nil {
 		return fmt.Errorf("[%s]: no publiccode.yml: %w", url.String(), err)
 	}
 
-	if res != nil {
-		canonicalURL, err := url.Parse(fmt.Sprintf("https://bitbucket.org/%s/%s.git", owner, repo.Slug))
-		if err != nil {
-			return fmt.Errorf("failed to get canonical repo URL for %s: %w", url.String(), err)
-		}
+	canonicalURL, err := url.Parse(fmt.Sprintf("https://bitbucket.org/%s/%s.git", owner, repo.Slug))
+	if err != nil {
+		return fmt.Errorf("failed to get canonical repo URL for %s: %w", url.String(), err)
+	}
 
-		repositories <- common.Repository{
-			Name:         repo.Full_name,
-			Title:        repo.Name,
-			Description:  repo.Description,
-			FileRawURL:   fmt.Sprintf("https://bitbucket.org/%s/%s/raw/%s/publiccode.yml", owner, slug, repo.Mainbranch.Name),
-			URL:          url,
-			CanonicalURL: *canonicalURL,
-			IsFork:       bitbucketRepositoryIsFork(repo),
-			GitBranch:    repo.Mainbranch.Name,
-			CreatedAt:    bitbucketTime(repo.CreatedOnTime),
-			UpdatedAt:    bitbucketTime(repo.UpdatedOnTime),
-			Publisher:    publisher,
-		}
+	repositories <- common.Repository{
+		Name:          repo.Full_name,
+		ProviderID:    repo.Uuid,
+		Title:         repo.Name,
+		Description:   repo.Description,
+		FileRawURL:    fmt.Sprintf("https://bitbucket.org/%s/%s/raw/%s/publiccode.yml", owner, slug, ref.name),
+		PubliccodeRef: ref.name,
+		Version:       ref.version,
+		URL:           url,
+		CanonicalURL:  *canonicalURL,
+		IsFork:        bitbucketRepositoryIsFork(repo),
+		UpstreamURL:   bitbucketUpstreamURL(repo),
+		Languages:     bitbucketLanguages(repo),
+		GitBranch:     repo.Mainbranch.Name,
+		CreatedAt:     bitbucketTime(repo.CreatedOnTime),
+		UpdatedAt:     bitbucketTime(repo.UpdatedOnTime),
+		Publisher:     publisher,
 	}
 
 	return nil
@@ -165,6 +160,70 @@ func (scanner BitBucketScanner) LastCommitTimeFromAPI(_ url.URL) (time.Time, err
 	return time.Time{}, errors.New("bitbucket last commit lookup not implemented")
 }
 
+// bitbucketPubliccodeRef returns the first ref, in the order given by
+// publiccodeRefs, that contains publiccode.yml.
+func (scanner BitBucketScanner) bitbucketPubliccodeRef(
+	owner, slug, mainBranch string, publisher common.Publisher,
+) (publiccodeRef, error) {
+	refs := publiccodeRefs(publisher, mainBranch, func() (string, error) {
+		return scanner.bitbucketLatestTag(owner, slug)
+	})
+
+	var err error
+
+	for _, ref := range refs {
+		_, err = scanner.client.Repositories.Repository.GetFileContent(&bitbucket.RepositoryFilesOptions{
+			Owner:    owner,
+			RepoSlug: slug,
+			Ref:      ref.name,
+			Path:     "publiccode.yml",
+		})
+		if err == nil {
+			return ref, nil
+		}
+	}
+
+	return publiccodeRef{}, err
+}
+
+// bitbucketLatestTag returns the most recent tag of the repository, or "" if
+// it has no tags. Bitbucket has no releases, so tags stand in for them.
+func (scanner BitBucketScanner) bitbucketLatestTag(owner, slug string) (string, error) {
+	tags, err := scanner.client.Repositories.Repository.ListTags(&bitbucket.RepositoryTagOptions{
+		Owner:    owner,
+		RepoSlug: slug,
+		Sort:     "-target.date",
+		Pagelen:  1,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(tags.Tags) == 0 {
+		return "", nil
+	}
+
+	return tags.Tags[0].Name, nil
+}
+
 func bitbucketRepositoryIsFork(repo *bitbucket.Repository) bool {
 	return repo != nil && repo.Parent != nil
 }
+
+// bitbucketUpstreamURL returns the clone URL of the repository the fork was created from.
+func bitbucketUpstreamURL(repo *bitbucket.Repository) string {
+	if !bitbucketRepositoryIsFork(repo) || repo.Parent.Full_name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("https://bitbucket.org/%s.git", repo.Parent.Full_name)
+}
+
+// bitbucketLanguages returns the single language Bitbucket records for a repository.
+func bitbucketLanguages(repo *bitbucket.Repository) []string {
+	if repo == nil || repo.Language == "" {
+		return nil
+	}
+
+	return []string{repo.Language}
+}
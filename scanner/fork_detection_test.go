@@ -1,11 +1,16 @@
 package scanner
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/google/go-github/v43/github"
 	"github.com/ktrysmt/go-bitbucket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
 
@@ -30,3 +35,81 @@ func TestBitbucketRepositoryIsFork(t *testing.T) {
 	assert.False(t, bitbucketRepositoryIsFork(&bitbucket.Repository{}))
 	assert.False(t, bitbucketRepositoryIsFork(nil))
 }
+
+func TestUpstreamURLs(t *testing.T) {
+	assert.Equal(t, "https://github.com/upstream/repo.git", githubUpstreamURL(&github.Repository{
+		Fork:   github.Bool(true),
+		Parent: &github.Repository{CloneURL: github.String("https://github.com/upstream/repo.git")},
+	}))
+	assert.Empty(t, githubUpstreamURL(&github.Repository{Fork: github.Bool(false)}))
+
+	assert.Equal(t, "https://gitlab.com/upstream/repo.git", gitlabUpstreamURL(&gitlab.Project{
+		ForkedFromProject: &gitlab.ForkParent{ID: 1, HTTPURLToRepo: "https://gitlab.com/upstream/repo.git"},
+	}))
+	assert.Empty(t, gitlabUpstreamURL(&gitlab.Project{}))
+
+	assert.Equal(t, "https://bitbucket.org/upstream/repo.git", bitbucketUpstreamURL(&bitbucket.Repository{
+		Parent: &bitbucket.Repository{Full_name: "upstream/repo"},
+	}))
+	assert.Empty(t, bitbucketUpstreamURL(nil))
+}
+
+func TestGitHubForkDiverged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/upstream/repo/compare/main...fork:develop", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ahead_by": 3, "behind_by": 1}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	scanner := GitHubScanner{client: client, ctx: context.Background()}
+
+	diverged := scanner.githubForkDiverged(&github.Repository{
+		FullName:      github.String("fork/repo"),
+		DefaultBranch: github.String("develop"),
+		Owner:         &github.User{Login: github.String("fork")},
+		Parent: &github.Repository{
+			Name:          github.String("repo"),
+			DefaultBranch: github.String("main"),
+			Owner:         &github.User{Login: github.String("upstream")},
+		},
+	})
+	require.NotNil(t, diverged)
+	assert.True(t, *diverged)
+}
+
+func TestGitLabForkDivergedComparesAcrossProjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v4/projects/1":
+			_, _ = w.Write([]byte(`{"id":1,"default_branch":"main","path_with_namespace":"upstream/repo"}`))
+		case "/api/v4/projects/2/repository/compare":
+			assert.Equal(t, "1", r.URL.Query().Get("from_project_id"))
+			assert.Equal(t, "main", r.URL.Query().Get("from"))
+			assert.Equal(t, "master", r.URL.Query().Get("to"))
+			_, _ = w.Write([]byte(`{"commits":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	client, err := newGitlabClient(*baseURL)
+	require.NoError(t, err)
+
+	diverged := gitlabForkDiverged(client, gitlab.Project{
+		ID:                2,
+		DefaultBranch:     "master",
+		ForkedFromProject: &gitlab.ForkParent{ID: 1},
+	})
+	require.NotNil(t, diverged)
+	assert.False(t, *diverged)
+}
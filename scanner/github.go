@@ -7,20 +7,25 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
 	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/developer-overheid-nl/don-crawler/internal/httpcache"
 	"github.com/google/go-github/v43/github"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
 )
 
 type GitHubScanner struct {
 	client *github.Client
 	ctx    context.Context
+	// httpClient and graphqlURL are used for the GraphQL API.
+	httpClient *http.Client
+	graphqlURL string
+	graphql    *graphqlSupport
 }
 
 var githubCommitRateLimit = struct {
@@ -28,47 +33,61 @@ var githubCommitRateLimit = struct {
 	reset time.Time
 }{}
 
-// NewGitHubScanner returns a new GitHubScanner using a GitHub App installation token (GIT_OAUTH_* env vars).
+// NewGitHubScanner returns a new GitHubScanner. Requests are authenticated as
+// githubapp.DefaultAuth picks, the GitHub env vars are read on the first one,
+// and revalidated with the HTTP cache.
 func NewGitHubScanner() Scanner {
-	ctx := context.Background()
-
-	var httpClient *http.Client
-
-	provider, err := githubapp.DefaultProvider()
-	if err != nil {
-		log.Fatalf("GitHub API auth: unable to configure GitHub App: %v", err)
+	httpClient := &http.Client{Transport: httpcache.New(&githubapp.Transport{})}
+
+	return GitHubScanner{
+		client:     github.NewClient(httpClient),
+		ctx:        context.Background(),
+		httpClient: httpClient,
+		graphqlURL: githubGraphQLURL,
+		graphql:    &graphqlSupport{},
 	}
-
-	if provider == nil {
-		log.Fatal("GitHub API auth: missing GitHub App env (GIT_OAUTH_CLIENTID/GIT_OAUTH_INSTALLATION_ID/GIT_OAUTH_SECRET)")
-	}
-
-	log.Infof("GitHub API auth: using GitHub App installation token")
-
-	httpClient = oauth2.NewClient(ctx, provider.TokenSource(ctx))
-
-	client := github.NewClient(httpClient)
-
-	return GitHubScanner{client: client, ctx: ctx}
 }
 
 // ScanGroupOfRepos scans a GitHub organization represented by url, associated to
 // publisher and sends any repository containing a publiccode.yml to the repositories
 // channel as a [common.Repository].
+// The repositories are listed with the GraphQL API, in one query per page, and
+// with REST and a few calls per repository if that fails.
 // It returns any error encountered if any, otherwise nil.
 func (scanner GitHubScanner) ScanGroupOfRepos(
 	url url.URL, publisher common.Publisher, repositories chan common.Repository,
 ) error {
 	log.Debugf("GitHubScanner.ScanGroupOfRepos(%s)", url.String())
 
-	opt := &github.RepositoryListByOrgOptions{}
-
 	splitted := strings.Split(strings.Trim(url.Path, "/"), "/")
 	if len(splitted) != 1 {
 		return fmt.Errorf("doesn't look like a GitHub org %s", url.String())
 	}
 
 	orgName := splitted[0]
+	sent := make(map[string]bool)
+
+	err := scanner.scanGroupGraphQL(orgName, publisher, repositories, sent)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, errGraphQLUnavailable) {
+		log.Debugf("%s, scanning %s with REST", err.Error(), url.String())
+	} else {
+		log.Warnf("%s, scanning %s with REST", err.Error(), url.String())
+	}
+
+	return scanner.scanGroupREST(url, orgName, publisher, repositories, sent)
+}
+
+// scanGroupREST is ScanGroupOfRepos with the REST API. Repositories in sent
+// are skipped.
+func (scanner GitHubScanner) scanGroupREST(
+	url url.URL, orgName string, publisher common.Publisher, repositories chan common.Repository,
+	sent map[string]bool,
+) error {
+	opt := &github.RepositoryListByOrgOptions{}
 
 	for {
 	Retry:
@@ -124,6 +143,10 @@ func (scanner GitHubScanner) ScanGroupOfRepos(
 				continue
 			}
 
+			if sent[strings.ToLower(r.GetFullName())] {
+				continue
+			}
+
 			repoURL, err := url.Parse(*r.HTMLURL)
 			if err != nil {
 				log.Errorf("can't parse URL %s: %s", *r.URL, err.Error())
@@ -199,18 +222,39 @@ Retry:
 		return fmt.Errorf("skipping private or archived repo %s", *repo.FullName)
 	}
 
-	file, _, resp, err := scanner.client.Repositories.GetContents(scanner.ctx, orgName, repoName, "publiccode.yml", nil)
-	if errors.As(err, &rateLimitError) {
-		log.Infof("GitHub rate limit hit, sleeping until %s", resp.Rate.Reset.Time.String())
-		time.Sleep(time.Until(resp.Rate.Reset.Time))
+	var (
+		file *github.RepositoryContent
+		ref  publiccodeRef
+	)
 
-		goto Retry
-	}
+	refs := publiccodeRefs(publisher, repo.GetDefaultBranch(), func() (string, error) {
+		return scanner.githubLatestRelease(repo)
+	})
 
-	if errors.As(err, &abuseRateLimitError) {
-		secondaryRateLimit(abuseRateLimitError)
+	for i, candidate := range refs {
+		ref = candidate
 
-		goto Retry
+		file, _, resp, err = scanner.client.Repositories.GetContents(
+			scanner.ctx, orgName, repoName, "publiccode.yml", &github.RepositoryContentGetOptions{Ref: ref.name},
+		)
+		if errors.As(err, &rateLimitError) {
+			log.Infof("GitHub rate limit hit, sleeping until %s", resp.Rate.Reset.Time.String())
+			time.Sleep(time.Until(resp.Rate.Reset.Time))
+
+			goto Retry
+		}
+
+		if errors.As(err, &abuseRateLimitError) {
+			secondaryRateLimit(abuseRateLimitError)
+
+			goto Retry
+		}
+
+		if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound || i == len(refs)-1 {
+			break
+		}
+
+		log.Infof("[%s]: publiccode.yml not found on %s, trying %s", *repo.FullName, ref.name, refs[i+1].name)
 	}
 
 	var fileRawURL string
@@ -218,9 +262,9 @@ Retry:
 	if err != nil {
 		if resp != nil && resp.StatusCode == http.StatusNotFound {
 			log.Warnf(
-				"[%s]: publiccode.yml not found on branch %s",
+				"[%s]: publiccode.yml not found on %s",
 				*repo.FullName,
-				repo.GetDefaultBranch(),
+				ref.name,
 			)
 		} else {
 			return fmt.Errorf("[%s]: failed to get publiccode.yml: %w", *repo.FullName, err)
@@ -233,24 +277,43 @@ Retry:
 		}
 	}
 
+	if fileRawURL == "" {
+		ref = publiccodeRef{}
+	}
+
 	canonicalURL, err := url.Parse(*repo.CloneURL)
 	if err != nil {
 		return fmt.Errorf("failed to get canonical repo URL for %s: %w", url.String(), err)
 	}
 
+	upstreamURL := githubUpstreamURL(repo)
+
+	var diverged *bool
+	if upstreamURL != "" {
+		diverged = scanner.githubForkDiverged(repo)
+	}
+
 	repositories <- common.Repository{
-		Name:         *repo.FullName,
-		Title:        repo.GetName(),
-		Description:  repo.GetDescription(),
-		FileRawURL:   fileRawURL,
-		URL:          url,
-		CanonicalURL: *canonicalURL,
-		IsFork:       githubRepositoryIsFork(repo),
-		GitBranch:    *repo.DefaultBranch,
-		CreatedAt:    repo.GetCreatedAt().Time,
-		UpdatedAt:    repo.GetUpdatedAt().Time,
-		Publisher:    publisher,
-		Headers:      make(map[string]string),
+		Name:                 *repo.FullName,
+		ProviderID:           strconv.FormatInt(repo.GetID(), 10),
+		Title:                repo.GetName(),
+		Description:          repo.GetDescription(),
+		FileRawURL:           fileRawURL,
+		PubliccodeRef:        ref.name,
+		Version:              ref.version,
+		URL:                  url,
+		CanonicalURL:         *canonicalURL,
+		IsFork:               githubRepositoryIsFork(repo),
+		UpstreamURL:          upstreamURL,
+		DivergedFromUpstream: diverged,
+		Languages:            scanner.githubLanguages(repo),
+		License:              common.NormalizeSPDXID(repo.GetLicense().GetSPDXID()),
+		Topics:               repo.Topics,
+		GitBranch:            *repo.DefaultBranch,
+		CreatedAt:            repo.GetCreatedAt().Time,
+		UpdatedAt:            repo.GetUpdatedAt().Time,
+		Publisher:            publisher,
+		Headers:              make(map[string]string),
 	}
 
 	return nil
@@ -370,6 +433,83 @@ func isDotGitHubRepoName(repoName string) bool {
 	return strings.EqualFold(repoNameNormalized, ".github")
 }
 
+// githubLatestRelease returns the tag of the latest release of repo, or "" if
+// it has no releases.
+func (scanner GitHubScanner) githubLatestRelease(repo *github.Repository) (string, error) {
+	release, resp, err := scanner.client.Repositories.GetLatestRelease(
+		scanner.ctx, repo.GetOwner().GetLogin(), repo.GetName(),
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return release.GetTagName(), nil
+}
+
 func githubRepositoryIsFork(repo *github.Repository) bool {
 	return repo != nil && repo.GetFork()
 }
+
+// githubUpstreamURL returns the clone URL of the repository the fork was created from.
+func githubUpstreamURL(repo *github.Repository) string {
+	if !githubRepositoryIsFork(repo) || repo.Parent == nil {
+		return ""
+	}
+
+	return repo.Parent.GetCloneURL()
+}
+
+// githubForkDiverged reports whether the fork's default branch has commits that
+// aren't in the parent's default branch. It returns nil if that can't be determined.
+func (scanner GitHubScanner) githubForkDiverged(repo *github.Repository) *bool {
+	parent := repo.GetParent()
+	if parent == nil || parent.GetOwner() == nil || repo.GetOwner() == nil {
+		return nil
+	}
+
+	head := repo.GetOwner().GetLogin() + ":" + repo.GetDefaultBranch()
+
+	comparison, _, err := scanner.client.Repositories.CompareCommits(
+		scanner.ctx,
+		parent.GetOwner().GetLogin(),
+		parent.GetName(),
+		parent.GetDefaultBranch(),
+		head,
+		&github.ListOptions{PerPage: 1},
+	)
+	if err != nil {
+		log.Debugf("[%s] can't compare fork with %s: %v", repo.GetFullName(), parent.GetFullName(), err)
+
+		return nil
+	}
+
+	diverged := comparison.GetAheadBy() > 0
+
+	return &diverged
+}
+
+// githubLanguages returns the repository's main languages, falling back to the
+// primary language GitHub reports if the languages can't be listed.
+func (scanner GitHubScanner) githubLanguages(repo *github.Repository) []string {
+	languages, _, err := scanner.client.Repositories.ListLanguages(
+		scanner.ctx, repo.GetOwner().GetLogin(), repo.GetName(),
+	)
+	if err != nil || len(languages) == 0 {
+		if repo.GetLanguage() == "" {
+			return nil
+		}
+
+		return []string{repo.GetLanguage()}
+	}
+
+	shares := make(map[string]float64, len(languages))
+	for language, bytes := range languages {
+		shares[language] = float64(bytes)
+	}
+
+	return common.MainLanguages(shares)
+}
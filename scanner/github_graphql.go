@@ -0,0 +1,436 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	githubapp "github.com/developer-overheid-nl/don-crawler/internal/githubapp"
+	"github.com/google/go-github/v43/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	githubGraphQLURL = "https://api.github.com/graphql"
+	// githubGraphQLPageSize keeps the cost of a page, with its nested
+	// languages and topics, well under GitHub's node limit.
+	githubGraphQLPageSize = 50
+)
+
+// errGraphQLUnavailable is returned when the GraphQL API can't be used at all,
+// as with anonymous access, which it doesn't allow.
+var errGraphQLUnavailable = errors.New("GitHub GraphQL API unavailable")
+
+// githubOrgQuery lists the repositories of an organization or user with
+// everything ScanRepo would otherwise get in separate REST calls, publiccode.yml
+// included. $ref is the ref the publisher prefers for publiccode.yml, HEAD if
+// none.
+const githubOrgQuery = `query($login: String!, $cursor: String, $first: Int!, $ref: String!) {
+  repositoryOwner(login: $login) {
+    repositories(first: $first, after: $cursor, ownerAffiliations: OWNER, orderBy: {field: NAME, direction: ASC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        databaseId
+        name
+        nameWithOwner
+        description
+        url
+        isFork
+        isArchived
+        isPrivate
+        createdAt
+        updatedAt
+        owner { login }
+        licenseInfo { spdxId }
+        primaryLanguage { name }
+        languages(first: 20, orderBy: {field: SIZE, direction: DESC}) { edges { size node { name } } }
+        repositoryTopics(first: 20) { nodes { topic { name } } }
+        parent { url name owner { login } defaultBranchRef { name } nameWithOwner }
+        defaultBranchRef { name target { ... on Commit { committedDate } } }
+        preferred: object(expression: $ref) { ... on Blob { oid byteSize isTruncated text } }
+        publiccode: object(expression: "HEAD:publiccode.yml") { ... on Blob { oid byteSize isTruncated text } }
+      }
+    }
+  }
+}`
+
+// graphqlSupport remembers that the GraphQL API can't be used, so it's tried
+// only once. It's shared by the copies of a GitHubScanner.
+type graphqlSupport struct {
+	unavailable atomic.Bool
+}
+
+//nolint:tagliatelle // GraphQL uses camelCase
+type githubGraphQLRepository struct {
+	DatabaseID    int64     `json:"databaseId"`
+	Name          string    `json:"name"`
+	NameWithOwner string    `json:"nameWithOwner"`
+	Description   string    `json:"description"`
+	URL           string    `json:"url"`
+	IsFork        bool      `json:"isFork"`
+	IsArchived    bool      `json:"isArchived"`
+	IsPrivate     bool      `json:"isPrivate"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	LicenseInfo *struct {
+		SpdxID string `json:"spdxId"`
+	} `json:"licenseInfo"`
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	Languages struct {
+		Edges []struct {
+			Size int64 `json:"size"`
+			Node struct {
+				Name string `json:"name"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"languages"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	Parent *struct {
+		URL   string `json:"url"`
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+		DefaultBranchRef *struct {
+			Name string `json:"name"`
+		} `json:"defaultBranchRef"`
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"parent"`
+	DefaultBranchRef *struct {
+		Name   string `json:"name"`
+		Target struct {
+			CommittedDate time.Time `json:"committedDate"`
+		} `json:"target"`
+	} `json:"defaultBranchRef"`
+	Preferred  *githubGraphQLBlob `json:"preferred"`
+	Publiccode *githubGraphQLBlob `json:"publiccode"`
+}
+
+//nolint:tagliatelle // GraphQL uses camelCase
+type githubGraphQLBlob struct {
+	OID         string `json:"oid"`
+	ByteSize    int    `json:"byteSize"`
+	IsTruncated bool   `json:"isTruncated"`
+	// Text is nil for binary files.
+	Text *string `json:"text"`
+}
+
+// contents returns the text of the blob, or nil if b is nil or GitHub didn't
+// return all of it.
+func (b *githubGraphQLBlob) contents() []byte {
+	if b == nil || b.IsTruncated || b.Text == nil || len(*b.Text) != b.ByteSize {
+		return nil
+	}
+
+	return []byte(*b.Text)
+}
+
+//nolint:tagliatelle // GraphQL uses camelCase
+type githubOrgQueryResponse struct {
+	Data struct {
+		RepositoryOwner *struct {
+			Repositories struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []githubGraphQLRepository `json:"nodes"`
+			} `json:"repositories"`
+		} `json:"repositoryOwner"`
+	} `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// scanGroupGraphQL lists the repositories of orgName with one GraphQL query
+// per page and sends the ones ScanRepo would send, with their publiccode.yml.
+// Repositories it sent are added to sent, so the REST fallback can skip them.
+// It returns errGraphQLUnavailable for publishers with
+// publiccodeRef: latest-release, which are scanned with the REST API: the
+// release tag isn't known before the query.
+func (scanner GitHubScanner) scanGroupGraphQL(
+	orgName string, publisher common.Publisher, repositories chan common.Repository, sent map[string]bool,
+) error {
+	if scanner.graphql == nil || scanner.graphql.unavailable.Load() {
+		return errGraphQLUnavailable
+	}
+
+	ref := "HEAD"
+
+	switch publisher.PubliccodeRef {
+	case "":
+	case common.LatestReleaseRef:
+		// The latest release can't be asked for in the same query.
+		return fmt.Errorf("%w for publishers preferring the latest release", errGraphQLUnavailable)
+	default:
+		ref = publisher.PubliccodeRef
+	}
+
+	cursor := ""
+
+	for {
+		page, err := scanner.queryOrgRepositories(orgName, ref+":publiccode.yml", cursor)
+		if err != nil {
+			return err
+		}
+
+		if page.Data.RepositoryOwner == nil {
+			return fmt.Errorf("GitHub organization or user %s not found", orgName)
+		}
+
+		repos := page.Data.RepositoryOwner.Repositories
+
+		for _, r := range repos.Nodes {
+			if isDotGitHubRepoName(r.Name) {
+				log.Debugf("Skipping GitHub .github repository: %s", r.URL)
+
+				continue
+			}
+
+			if r.IsPrivate || r.IsArchived {
+				log.Debugf("skipping private or archived repo %s", r.NameWithOwner)
+
+				continue
+			}
+
+			repository, err := scanner.graphqlRepository(r, publisher)
+			if err != nil {
+				log.Errorf("can't scan repository %s: %s", r.URL, err.Error())
+
+				continue
+			}
+
+			sent[strings.ToLower(r.NameWithOwner)] = true
+			repositories <- repository
+		}
+
+		if !repos.PageInfo.HasNextPage {
+			return nil
+		}
+
+		cursor = repos.PageInfo.EndCursor
+	}
+}
+
+func (scanner GitHubScanner) queryOrgRepositories(
+	orgName, publiccodeExpression, cursor string,
+) (githubOrgQueryResponse, error) {
+	variables := map[string]any{
+		"login": orgName,
+		"first": githubGraphQLPageSize,
+		"ref":   publiccodeExpression,
+	}
+	if cursor != "" {
+		variables["cursor"] = cursor
+	}
+
+	body, err := json.Marshal(map[string]any{"query": githubOrgQuery, "variables": variables})
+	if err != nil {
+		return githubOrgQueryResponse{}, fmt.Errorf("can't encode GraphQL query: %w", err)
+	}
+
+	ctx := githubapp.WithOwner(scanner.ctx, orgName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scanner.graphqlURL, bytes.NewReader(body))
+	if err != nil {
+		return githubOrgQueryResponse{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := scanner.httpClient.Do(req)
+	if err != nil {
+		return githubOrgQueryResponse{}, fmt.Errorf("GraphQL query for %s failed: %w", orgName, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		_, _ = io.Copy(io.Discard, res.Body)
+		scanner.graphql.unavailable.Store(true)
+
+		return githubOrgQueryResponse{}, fmt.Errorf("%w: %s", errGraphQLUnavailable, res.Status)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, res.Body)
+
+		return githubOrgQueryResponse{}, fmt.Errorf("GraphQL query for %s failed: %s", orgName, res.Status)
+	}
+
+	var page githubOrgQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return githubOrgQueryResponse{}, fmt.Errorf("can't decode GraphQL response for %s: %w", orgName, err)
+	}
+
+	if len(page.Errors) > 0 {
+		if page.Errors[0].Type == "NOT_FOUND" {
+			return githubOrgQueryResponse{}, fmt.Errorf("GitHub organization or user %s not found", orgName)
+		}
+
+		return githubOrgQueryResponse{}, fmt.Errorf("GraphQL query for %s failed: %s %s",
+			orgName, page.Errors[0].Type, page.Errors[0].Message)
+	}
+
+	return page, nil
+}
+
+// graphqlRepository converts r as ScanRepo would a REST repository.
+func (scanner GitHubScanner) graphqlRepository(
+	r githubGraphQLRepository, publisher common.Publisher,
+) (common.Repository, error) {
+	repoURL, err := url.Parse(r.URL)
+	if err != nil {
+		return common.Repository{}, fmt.Errorf("can't parse URL %s: %w", r.URL, err)
+	}
+
+	canonicalURL, err := url.Parse(r.URL + ".git")
+	if err != nil {
+		return common.Repository{}, fmt.Errorf("failed to get canonical repo URL for %s: %w", r.URL, err)
+	}
+
+	defaultBranch := ""
+
+	var lastCommitAt time.Time
+
+	if r.DefaultBranchRef != nil {
+		defaultBranch = r.DefaultBranchRef.Name
+		lastCommitAt = r.DefaultBranchRef.Target.CommittedDate
+	}
+
+	ref := ""
+
+	var publiccode []byte
+
+	switch {
+	case r.Preferred != nil && publisher.PubliccodeRef != "":
+		ref = publisher.PubliccodeRef
+		publiccode = r.Preferred.contents()
+	case r.Publiccode != nil:
+		if publisher.PubliccodeRef != "" && publisher.PubliccodeRef != defaultBranch {
+			log.Infof("[%s]: publiccode.yml not found on %s, trying %s", r.NameWithOwner, publisher.PubliccodeRef, defaultBranch)
+		}
+
+		ref = defaultBranch
+		publiccode = r.Publiccode.contents()
+	default:
+		log.Warnf("[%s]: publiccode.yml not found on %s", r.NameWithOwner, orDefault(publisher.PubliccodeRef, defaultBranch))
+	}
+
+	fileRawURL := ""
+	if ref != "" {
+		fileRawURL = fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/publiccode.yml", r.NameWithOwner, ref)
+	}
+
+	repository := common.Repository{
+		Name:          r.NameWithOwner,
+		ProviderID:    strconv.FormatInt(r.DatabaseID, 10),
+		Title:         r.Name,
+		Description:   r.Description,
+		FileRawURL:    fileRawURL,
+		PubliccodeRef: ref,
+		URL:           *repoURL,
+		CanonicalURL:  *canonicalURL,
+		IsFork:        r.IsFork,
+		Languages:     graphqlLanguages(r),
+		Topics:        graphqlTopics(r),
+		GitBranch:     defaultBranch,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+		LastCommitAt:  lastCommitAt,
+		Publisher:     publisher,
+		Headers:       make(map[string]string),
+		Publiccode:    publiccode,
+	}
+
+	if r.LicenseInfo != nil {
+		repository.License = common.NormalizeSPDXID(r.LicenseInfo.SpdxID)
+	}
+
+	if r.IsFork && r.Parent != nil {
+		repository.UpstreamURL = r.Parent.URL + ".git"
+		repository.DivergedFromUpstream = scanner.githubForkDiverged(graphqlForkRepository(r, defaultBranch))
+	}
+
+	return repository, nil
+}
+
+// graphqlForkRepository returns the fields of fork r githubForkDiverged needs.
+func graphqlForkRepository(r githubGraphQLRepository, defaultBranch string) *github.Repository {
+	parent := &github.Repository{
+		Name:     github.String(r.Parent.Name),
+		FullName: github.String(r.Parent.NameWithOwner),
+		Owner:    &github.User{Login: github.String(r.Parent.Owner.Login)},
+	}
+
+	if r.Parent.DefaultBranchRef != nil {
+		parent.DefaultBranch = github.String(r.Parent.DefaultBranchRef.Name)
+	}
+
+	return &github.Repository{
+		FullName:      github.String(r.NameWithOwner),
+		DefaultBranch: github.String(defaultBranch),
+		Owner:         &github.User{Login: github.String(r.Owner.Login)},
+		Parent:        parent,
+	}
+}
+
+// graphqlLanguages returns the main languages of r, like githubLanguages.
+func graphqlLanguages(r githubGraphQLRepository) []string {
+	if len(r.Languages.Edges) == 0 {
+		if r.PrimaryLanguage == nil || r.PrimaryLanguage.Name == "" {
+			return nil
+		}
+
+		return []string{r.PrimaryLanguage.Name}
+	}
+
+	shares := make(map[string]float64, len(r.Languages.Edges))
+	for _, edge := range r.Languages.Edges {
+		shares[edge.Node.Name] = float64(edge.Size)
+	}
+
+	return common.MainLanguages(shares)
+}
+
+func graphqlTopics(r githubGraphQLRepository) []string {
+	if len(r.RepositoryTopics.Nodes) == 0 {
+		return nil
+	}
+
+	topics := make([]string, 0, len(r.RepositoryTopics.Nodes))
+	for _, node := range r.RepositoryTopics.Nodes {
+		topics = append(topics, node.Topic.Name)
+	}
+
+	return topics
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/google/go-github/v43/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const githubGraphQLPage1 = `{"data":{"repositoryOwner":{"repositories":{
+  "pageInfo":{"hasNextPage":true,"endCursor":"c1"},
+  "nodes":[
+    {"databaseId":1,"name":"zaken","nameWithOwner":"acme/zaken","description":"Zaaksysteem",
+     "url":"https://github.com/acme/zaken","isFork":false,"isArchived":false,"isPrivate":false,
+     "createdAt":"2020-01-02T03:04:05Z","updatedAt":"2024-01-02T03:04:05Z","owner":{"login":"acme"},
+     "licenseInfo":{"spdxId":"EUPL-1.2"},"primaryLanguage":{"name":"Go"},
+     "languages":{"edges":[{"size":900,"node":{"name":"Go"}},{"size":100,"node":{"name":"Shell"}}]},
+     "repositoryTopics":{"nodes":[{"topic":{"name":"zaken"}}]},
+     "parent":null,
+     "defaultBranchRef":{"name":"main","target":{"committedDate":"2024-05-06T07:08:09Z"}},
+     "preferred":{"oid":"abc","byteSize":22,"isTruncated":false,"text":"publiccodeYmlVersion: "},
+     "publiccode":{"oid":"abc","byteSize":22,"isTruncated":false,"text":"publiccodeYmlVersion: "}},
+    {"databaseId":2,"name":"archief","nameWithOwner":"acme/archief","url":"https://github.com/acme/archief",
+     "isArchived":true,"owner":{"login":"acme"},"languages":{"edges":[]},"repositoryTopics":{"nodes":[]},
+     "defaultBranchRef":{"name":"main","target":{}}}
+  ]}}}}`
+
+const githubGraphQLPage2 = `{"data":{"repositoryOwner":{"repositories":{
+  "pageInfo":{"hasNextPage":false,"endCursor":"c2"},
+  "nodes":[
+    {"databaseId":3,"name":".github","nameWithOwner":"acme/.github","url":"https://github.com/acme/.github",
+     "owner":{"login":"acme"},"languages":{"edges":[]},"repositoryTopics":{"nodes":[]}},
+    {"databaseId":4,"name":"tools","nameWithOwner":"acme/tools","url":"https://github.com/acme/tools",
+     "owner":{"login":"acme"},"languages":{"edges":[]},"repositoryTopics":{"nodes":[]},
+     "defaultBranchRef":{"name":"develop","target":{"committedDate":"2023-01-01T00:00:00Z"}},
+     "preferred":null,"publiccode":null}
+  ]}}}}`
+
+func newTestGitHubScanner(t *testing.T, mux *http.ServeMux) GitHubScanner {
+	t.Helper()
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(server.Client())
+	baseURL, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	client.BaseURL = baseURL
+
+	return GitHubScanner{
+		client:     client,
+		ctx:        context.Background(),
+		httpClient: server.Client(),
+		graphqlURL: server.URL + "/graphql",
+		graphql:    &graphqlSupport{},
+	}
+}
+
+func TestGitHubScanGroupOfReposWithGraphQL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			Variables map[string]any `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		assert.Equal(t, "acme", query.Variables["login"])
+		assert.Equal(t, "HEAD:publiccode.yml", query.Variables["ref"])
+
+		if query.Variables["cursor"] == "c1" {
+			_, _ = w.Write([]byte(githubGraphQLPage2))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(githubGraphQLPage1))
+	})
+	mux.HandleFunc("/", func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected REST request %s", r.URL.Path)
+	})
+
+	scanner := newTestGitHubScanner(t, mux)
+	repositories := make(chan common.Repository, 10)
+
+	orgURL, _ := url.Parse("https://github.com/acme")
+	require.NoError(t, scanner.ScanGroupOfRepos(*orgURL, common.Publisher{ID: "acme"}, repositories))
+	close(repositories)
+
+	var got []common.Repository
+	for repository := range repositories {
+		got = append(got, repository)
+	}
+
+	require.Len(t, got, 2)
+
+	zaken := got[0]
+	assert.Equal(t, "acme/zaken", zaken.Name)
+	assert.Equal(t, "1", zaken.ProviderID)
+	assert.Equal(t, "https://github.com/acme/zaken.git", zaken.CanonicalURL.String())
+	assert.Equal(t, "https://raw.githubusercontent.com/acme/zaken/main/publiccode.yml", zaken.FileRawURL)
+	assert.Equal(t, "main", zaken.PubliccodeRef)
+	assert.Equal(t, "publiccodeYmlVersion: ", string(zaken.Publiccode))
+	assert.Equal(t, "EUPL-1.2", zaken.License)
+	assert.Equal(t, []string{"zaken"}, zaken.Topics)
+	assert.Contains(t, zaken.Languages, "Go")
+	assert.Equal(t, time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), zaken.LastCommitAt)
+
+	tools := got[1]
+	assert.Equal(t, "acme/tools", tools.Name)
+	assert.Empty(t, tools.FileRawURL)
+	assert.Nil(t, tools.Publiccode)
+	assert.Equal(t, "develop", tools.GitBranch)
+}
+
+func TestGraphQLBlobContentsOnlyWhenComplete(t *testing.T) {
+	text := "publiccodeYmlVersion: \"0.4\"\n"
+
+	assert.Equal(t, []byte(text), (&githubGraphQLBlob{ByteSize: len(text), Text: &text}).contents())
+	assert.Nil(t, (&githubGraphQLBlob{ByteSize: len(text), IsTruncated: true, Text: &text}).contents())
+	assert.Nil(t, (&githubGraphQLBlob{ByteSize: 10}).contents())
+	assert.Nil(t, (*githubGraphQLBlob)(nil).contents())
+}
+
+func TestGitHubScanGroupOfReposFallsBackToREST(t *testing.T) {
+	restCalls := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("GET /orgs/acme/repos", func(w http.ResponseWriter, _ *http.Request) {
+		restCalls++
+
+		_, _ = w.Write([]byte(`[]`))
+	})
+
+	scanner := newTestGitHubScanner(t, mux)
+	orgURL, _ := url.Parse("https://github.com/acme")
+
+	for range 2 {
+		require.NoError(t, scanner.ScanGroupOfRepos(*orgURL, common.Publisher{}, make(chan common.Repository)))
+	}
+
+	assert.Equal(t, 2, restCalls)
+	assert.True(t, scanner.graphql.unavailable.Load())
+}
@@ -7,11 +7,14 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/developer-overheid-nl/don-crawler/internal/httpcache"
+	"github.com/hashicorp/go-retryablehttp"
 	log "github.com/sirupsen/logrus"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
@@ -158,7 +161,7 @@ func (scanner GitLabScanner) ScanGroupOfRepos(
 			}
 
 			for _, prj := range projects {
-				if err = addProject(nil, *prj, publisher, repositories); err != nil {
+				if err = addProject(nil, *prj, publisher, repositories, git); err != nil {
 					return err
 				}
 			}
@@ -191,14 +194,14 @@ func (scanner GitLabScanner) ScanRepo(
 		context.Background(),
 		"GetProject",
 		func() (*gitlab.Project, *gitlab.Response, error) {
-			return git.Projects.GetProject(projectName, &gitlab.GetProjectOptions{})
+			return git.Projects.GetProject(projectName, &gitlab.GetProjectOptions{License: gitlab.Ptr(true)})
 		},
 	)
 	if err != nil {
 		return err
 	}
 
-	return addProject(&url, *prj, publisher, repositories)
+	return addProject(&url, *prj, publisher, repositories, git)
 }
 
 // LastCommitTimeFromAPI returns the last commit time for a GitLab repository.
@@ -277,13 +280,15 @@ func gitlabUpdatedAt(project gitlab.Project) time.Time {
 }
 
 func newGitlabClient(u url.URL) (*gitlab.Client, error) {
+	httpClient := gitlab.WithHTTPClient(&http.Client{Transport: httpcache.New(nil)})
+
 	if u.Scheme == "" || u.Host == "" {
-		return gitlab.NewAuthSourceClient(gitlab.Unauthenticated{})
+		return gitlab.NewAuthSourceClient(gitlab.Unauthenticated{}, httpClient)
 	}
 
 	base := fmt.Sprintf("%s://%s/api/v4", u.Scheme, u.Host)
 
-	return gitlab.NewAuthSourceClient(gitlab.Unauthenticated{}, gitlab.WithBaseURL(base))
+	return gitlab.NewAuthSourceClient(gitlab.Unauthenticated{}, gitlab.WithBaseURL(base), httpClient)
 }
 
 func gitlabRateLimitReset(resp *gitlab.Response, err error) (time.Time, bool) {
@@ -312,13 +317,13 @@ func gitlabRateLimitReset(resp *gitlab.Response, err error) (time.Time, bool) {
 }
 
 // generateGitlabRawURL returns the file Gitlab specific file raw url.
-func generateGitlabRawURL(baseURL, defaultBranch string) (string, error) {
+func generateGitlabRawURL(baseURL, ref string) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
 	}
 
-	u.Path = path.Join(u.Path, "raw", defaultBranch, "publiccode.yml")
+	u.Path = path.Join(u.Path, "raw", ref, "publiccode.yml")
 
 	return u.String(), err
 }
@@ -347,7 +352,7 @@ func addGroupProjects(
 		}
 
 		for _, prj := range projects {
-			err = addProject(nil, *prj, publisher, repositories)
+			err = addProject(nil, *prj, publisher, repositories, client)
 			if err != nil {
 				return err
 			}
@@ -395,15 +400,21 @@ func addGroupProjects(
 
 // addGroupProjects sends the GitLab project the repositories channel.
 func addProject(
-	originalURL *url.URL, project gitlab.Project, publisher common.Publisher, repositories chan common.Repository,
+	originalURL *url.URL,
+	project gitlab.Project,
+	publisher common.Publisher,
+	repositories chan common.Repository,
+	client *gitlab.Client,
 ) error {
-	// Join file raw URL string.
-	rawURL, err := generateGitlabRawURL(project.WebURL, project.DefaultBranch)
-	if err != nil {
-		return err
-	}
-
 	if project.DefaultBranch != "" {
+		ref := gitlabPubliccodeRef(client, project, publisher)
+
+		// Join file raw URL string.
+		rawURL, err := generateGitlabRawURL(project.WebURL, ref.name)
+		if err != nil {
+			return err
+		}
+
 		canonicalURL, err := url.Parse(project.HTTPURLToRepo)
 		if err != nil {
 			return fmt.Errorf("failed to get canonical repo URL for %s: %w", project.WebURL, err)
@@ -413,24 +424,198 @@ func addProject(
 			originalURL = canonicalURL
 		}
 
+		upstreamURL := gitlabUpstreamURL(&project)
+
+		var diverged *bool
+		if upstreamURL != "" {
+			diverged = gitlabForkDiverged(client, project)
+		}
+
 		repositories <- common.Repository{
-			Name:         project.PathWithNamespace,
-			Title:        project.Name,
-			Description:  project.Description,
-			FileRawURL:   rawURL,
-			URL:          *originalURL,
-			CanonicalURL: *canonicalURL,
-			IsFork:       gitlabProjectIsFork(&project),
-			GitBranch:    project.DefaultBranch,
-			CreatedAt:    gitlabTime(project.CreatedAt),
-			UpdatedAt:    gitlabUpdatedAt(project),
-			Publisher:    publisher,
+			Name:                 project.PathWithNamespace,
+			ProviderID:           strconv.FormatInt(project.ID, 10),
+			Title:                project.Name,
+			Description:          project.Description,
+			FileRawURL:           rawURL,
+			PubliccodeRef:        ref.name,
+			Version:              ref.version,
+			URL:                  *originalURL,
+			CanonicalURL:         *canonicalURL,
+			IsFork:               gitlabProjectIsFork(&project),
+			UpstreamURL:          upstreamURL,
+			DivergedFromUpstream: diverged,
+			Languages:            gitlabLanguages(client, project),
+			License:              gitlabLicense(&project),
+			Topics:               project.Topics,
+			GitBranch:            project.DefaultBranch,
+			CreatedAt:            gitlabTime(project.CreatedAt),
+			UpdatedAt:            gitlabUpdatedAt(project),
+			Publisher:            publisher,
 		}
 	}
 
 	return nil
 }
 
+// gitlabPubliccodeRef returns the ref to read publiccode.yml from. Refs
+// preferred by the publisher are only used if they contain publiccode.yml; the
+// default branch is returned unchecked, the crawler verifies the raw URL later.
+func gitlabPubliccodeRef(client *gitlab.Client, project gitlab.Project, publisher common.Publisher) publiccodeRef {
+	refs := publiccodeRefs(publisher, project.DefaultBranch, func() (string, error) {
+		return gitlabLatestRelease(client, project)
+	})
+
+	for _, ref := range refs[:len(refs)-1] {
+		_, _, err := gitlabCallWithRateLimitRetry(
+			context.Background(),
+			"GetFileMetaData",
+			func() (*gitlab.File, *gitlab.Response, error) {
+				return client.RepositoryFiles.GetFileMetaData(
+					project.ID, "publiccode.yml", &gitlab.GetFileMetaDataOptions{Ref: gitlab.Ptr(ref.name)},
+				)
+			},
+		)
+		if err == nil {
+			return ref
+		}
+
+		log.Infof("[%s]: publiccode.yml not found on %s: %v", project.PathWithNamespace, ref.name, err)
+	}
+
+	return refs[len(refs)-1]
+}
+
+// gitlabLatestRelease returns the tag of the most recently released release
+// of project, or "" if it has no releases.
+func gitlabLatestRelease(client *gitlab.Client, project gitlab.Project) (string, error) {
+	releases, _, err := gitlabCallWithRateLimitRetry(
+		context.Background(),
+		"ListReleases",
+		func() ([]*gitlab.Release, *gitlab.Response, error) {
+			return client.Releases.ListReleases(project.ID, &gitlab.ListReleasesOptions{
+				ListOptions: gitlab.ListOptions{PerPage: 1},
+				OrderBy:     gitlab.Ptr("released_at"),
+				Sort:        gitlab.Ptr("desc"),
+			})
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", nil
+	}
+
+	return releases[0].TagName, nil
+}
+
 func gitlabProjectIsFork(project *gitlab.Project) bool {
 	return project != nil && project.ForkedFromProject != nil
 }
+
+// gitlabUpstreamURL returns the clone URL of the project the fork was created from.
+func gitlabUpstreamURL(project *gitlab.Project) string {
+	if !gitlabProjectIsFork(project) {
+		return ""
+	}
+
+	return project.ForkedFromProject.HTTPURLToRepo
+}
+
+// gitlabForkDiverged reports whether the fork's default branch has commits that
+// aren't in the parent's default branch. It returns nil if that can't be determined.
+func gitlabForkDiverged(client *gitlab.Client, project gitlab.Project) *bool {
+	if client == nil || !gitlabProjectIsFork(&project) {
+		return nil
+	}
+
+	parentID := project.ForkedFromProject.ID
+
+	parent, _, err := gitlabCallWithRateLimitRetry(
+		context.Background(),
+		"GetProject",
+		func() (*gitlab.Project, *gitlab.Response, error) {
+			return client.Projects.GetProject(parentID, &gitlab.GetProjectOptions{})
+		},
+	)
+	if err != nil || parent.DefaultBranch == "" {
+		log.Debugf("[%s] can't get upstream project %d: %v", project.PathWithNamespace, parentID, err)
+
+		return nil
+	}
+
+	// Compare the parent's default branch with the fork's, listing the
+	// commits only the fork has.
+	compare, _, err := gitlabCallWithRateLimitRetry(
+		context.Background(),
+		"Compare",
+		func() (*gitlab.Compare, *gitlab.Response, error) {
+			return client.Repositories.Compare(
+				project.ID,
+				&gitlab.CompareOptions{
+					From: &parent.DefaultBranch,
+					To:   &project.DefaultBranch,
+				},
+				gitlabWithQuery("from_project_id", strconv.FormatInt(parentID, 10)),
+			)
+		},
+	)
+	if err != nil {
+		log.Debugf("[%s] can't compare fork with %s: %v", project.PathWithNamespace, parent.PathWithNamespace, err)
+
+		return nil
+	}
+
+	diverged := len(compare.Commits) > 0
+
+	return &diverged
+}
+
+// gitlabWithQuery adds a query parameter the client library has no option for.
+func gitlabWithQuery(key, value string) gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		query := req.URL.Query()
+		query.Set(key, value)
+		req.URL.RawQuery = query.Encode()
+
+		return nil
+	}
+}
+
+// gitlabLanguages returns the project's main languages.
+func gitlabLanguages(client *gitlab.Client, project gitlab.Project) []string {
+	if client == nil {
+		return nil
+	}
+
+	languages, _, err := gitlabCallWithRateLimitRetry(
+		context.Background(),
+		"GetProjectLanguages",
+		func() (*gitlab.ProjectLanguages, *gitlab.Response, error) {
+			return client.Projects.GetProjectLanguages(project.ID)
+		},
+	)
+	if err != nil || languages == nil {
+		log.Debugf("[%s] can't get languages: %v", project.PathWithNamespace, err)
+
+		return nil
+	}
+
+	shares := make(map[string]float64, len(*languages))
+	for language, percentage := range *languages {
+		shares[language] = float64(percentage)
+	}
+
+	return common.MainLanguages(shares)
+}
+
+// gitlabLicense returns the SPDX identifier of the project's license. GitLab only
+// includes the license when a single project is requested with license=true.
+func gitlabLicense(project *gitlab.Project) string {
+	if project == nil || project.License == nil {
+		return ""
+	}
+
+	return common.NormalizeSPDXID(project.License.Key)
+}
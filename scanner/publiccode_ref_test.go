@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/developer-overheid-nl/don-crawler/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestPubliccodeRefs(t *testing.T) {
+	release := func(tag string, err error) func() (string, error) {
+		return func() (string, error) { return tag, err }
+	}
+
+	tests := []struct {
+		name          string
+		publiccodeRef string
+		latestRelease func() (string, error)
+		want          []publiccodeRef
+	}{
+		{
+			name: "default branch",
+			want: []publiccodeRef{{name: "main"}},
+		},
+		{
+			name:          "named branch",
+			publiccodeRef: "stable",
+			want:          []publiccodeRef{{name: "stable"}, {name: "main"}},
+		},
+		{
+			name:          "named branch is the default branch",
+			publiccodeRef: "main",
+			want:          []publiccodeRef{{name: "main"}},
+		},
+		{
+			name:          "latest release",
+			publiccodeRef: common.LatestReleaseRef,
+			latestRelease: release("v1.2.0", nil),
+			want:          []publiccodeRef{{name: "v1.2.0", version: "v1.2.0"}, {name: "main"}},
+		},
+		{
+			name:          "no releases",
+			publiccodeRef: common.LatestReleaseRef,
+			latestRelease: release("", nil),
+			want:          []publiccodeRef{{name: "main"}},
+		},
+		{
+			name:          "release lookup fails",
+			publiccodeRef: common.LatestReleaseRef,
+			latestRelease: release("", errors.New("boom")),
+			want:          []publiccodeRef{{name: "main"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := common.Publisher{PubliccodeRef: tt.publiccodeRef}
+
+			assert.Equal(t, tt.want, publiccodeRefs(publisher, "main", tt.latestRelease))
+		})
+	}
+}
+
+func TestGitLabPubliccodeRefFallsBackToDefaultBranch(t *testing.T) {
+	hasPubliccode := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v4/projects/2/releases":
+			assert.Equal(t, "released_at", r.URL.Query().Get("order_by"))
+			_, _ = w.Write([]byte(`[{"tag_name":"v2.0.0"}]`))
+		case "/api/v4/projects/2/repository/files/publiccode.yml":
+			if !hasPubliccode[r.URL.Query().Get("ref")] {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			w.Header().Set("X-Gitlab-File-Path", "publiccode.yml")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	client, err := newGitlabClient(*baseURL)
+	require.NoError(t, err)
+
+	project := gitlab.Project{ID: 2, DefaultBranch: "main", PathWithNamespace: "group/repo"}
+	publisher := common.Publisher{PubliccodeRef: common.LatestReleaseRef}
+
+	hasPubliccode["v2.0.0"] = true
+	assert.Equal(t, publiccodeRef{name: "v2.0.0", version: "v2.0.0"}, gitlabPubliccodeRef(client, project, publisher))
+
+	hasPubliccode["v2.0.0"] = false
+	assert.Equal(t, publiccodeRef{name: "main"}, gitlabPubliccodeRef(client, project, publisher))
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/developer-overheid-nl/don-crawler/common"
+	log "github.com/sirupsen/logrus"
 )
 
 var ErrPubliccodeNotFound = errors.New("publiccode.yml not found")
@@ -15,3 +16,38 @@ type Scanner interface {
 	ScanGroupOfRepos(url url.URL, publisher common.Publisher, repositories chan common.Repository) error
 	LastCommitTimeFromAPI(url url.URL) (time.Time, error)
 }
+
+// publiccodeRef is a git ref to look for publiccode.yml in. version is set when
+// the ref is a release tag.
+type publiccodeRef struct {
+	name    string
+	version string
+}
+
+// publiccodeRefs returns the refs to look for publiccode.yml in, in order: the
+// one preferred by the publisher, if any, followed by the default branch.
+// latestRelease is only called when the publisher prefers the latest release.
+func publiccodeRefs(
+	publisher common.Publisher, defaultBranch string, latestRelease func() (string, error),
+) []publiccodeRef {
+	refs := make([]publiccodeRef, 0, 2)
+
+	switch publisher.PubliccodeRef {
+	case "", defaultBranch:
+	case common.LatestReleaseRef:
+		tag, err := latestRelease()
+
+		switch {
+		case err != nil:
+			log.Warnf("can't get latest release, using branch %s: %v", defaultBranch, err)
+		case tag == "":
+			log.Debugf("no releases found, using branch %s", defaultBranch)
+		default:
+			refs = append(refs, publiccodeRef{name: tag, version: tag})
+		}
+	default:
+		refs = append(refs, publiccodeRef{name: publisher.PubliccodeRef})
+	}
+
+	return append(refs, publiccodeRef{name: defaultBranch})
+}